@@ -49,10 +49,14 @@ func DrawWithTexture(fb *tga.TGA, obj *model.Object, texture *tga.TGA) {
 
 	for _, face := range obj.Faces {
 		tri := util.NewTriangleFromFace(face, float64(fb.GetWidth()-1), float64(fb.GetHeight()-1))
+		if face.Points[0].Texture == nil || face.Points[1].Texture == nil || face.Points[2].Texture == nil {
+			// no texture coordinates, see mesh.Unwrap
+			continue
+		}
 		uvList := []tga.UV{
-			{face.Points[0].Texture.U, face.Points[0].Texture.V},
-			{face.Points[1].Texture.U, face.Points[1].Texture.V},
-			{face.Points[2].Texture.U, face.Points[2].Texture.V},
+			{U: face.Points[0].Texture.U, V: face.Points[0].Texture.V},
+			{U: face.Points[1].Texture.U, V: face.Points[1].Texture.V},
+			{U: face.Points[2].Texture.U, V: face.Points[2].Texture.V},
 		}
 		fb.DrawTriangleWithTexture(tri, zBuffer, texture, uvList)
 	}
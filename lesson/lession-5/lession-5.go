@@ -34,10 +34,14 @@ func DrawWithCamera(fb *tga.TGA, obj *model.Object, texture *tga.TGA) {
 
 		tri := &util.Triangle{Points: screenV[:]}
 
+		if face.Points[0].Texture == nil || face.Points[1].Texture == nil || face.Points[2].Texture == nil {
+			// no texture coordinates, see mesh.Unwrap
+			continue
+		}
 		uvList := []tga.UV{
-			{face.Points[0].Texture.U, face.Points[0].Texture.V},
-			{face.Points[1].Texture.U, face.Points[1].Texture.V},
-			{face.Points[2].Texture.U, face.Points[2].Texture.V},
+			{U: face.Points[0].Texture.U, V: face.Points[0].Texture.V},
+			{U: face.Points[1].Texture.U, V: face.Points[1].Texture.V},
+			{U: face.Points[2].Texture.U, V: face.Points[2].Texture.V},
 		}
 		fb.DrawTriangleWithTexture(tri, zBuffer, texture, uvList)
 	}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"time"
 	lession_5 "tinyrender-golang/lesson/lession-5"
+	"tinyrender-golang/mesh"
 	model "tinyrender-golang/model"
 	"tinyrender-golang/tga"
 )
@@ -23,6 +24,14 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	if len(obj.Surfaces) > 0 {
+		if obj, err = mesh.Tessellate(obj); err != nil {
+			panic(err)
+		}
+	}
+	if len(obj.Textures) == 0 {
+		mesh.Unwrap(obj)
+	}
 	textureFile, err := os.Open("./obj/african_head/african_head_diffuse.tga")
 	if err != nil {
 		panic(err)
@@ -0,0 +1,183 @@
+package mesh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/util"
+)
+
+// ErrTopologyMismatch is returned when a blend shape target does not share
+// the vertex order and faces of the base
+var ErrTopologyMismatch = errors.New("mesh: topology does not match")
+
+// BlendShape deforms a base object towards any number of targets, poses of
+// the same object with matching vertex order and faces
+type BlendShape struct {
+	base    *model.Object
+	targets []*model.Object
+}
+
+// NewBlendShape validates the targets against the base, errors wrap
+// ErrTopologyMismatch
+func NewBlendShape(base *model.Object, targets ...*model.Object) (*BlendShape, error) {
+	for i, t := range targets {
+		if err := sameTopology(base, t); err != nil {
+			return nil, fmt.Errorf("target %d: %w", i, err)
+		}
+	}
+	return &BlendShape{base: base, targets: targets}, nil
+}
+
+// LoadBlendShape reads the base and its targets from OBJ files
+func LoadBlendShape(base string, targets ...string) (*BlendShape, error) {
+	objects := make([]*model.Object, 0, len(targets)+1)
+	for _, path := range append([]string{base}, targets...) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		o, err := model.NewReader(f).Read()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		objects = append(objects, o)
+	}
+	return NewBlendShape(objects[0], objects[1:]...)
+}
+
+// Targets returns the number of targets
+func (b *BlendShape) Targets() int {
+	return len(b.targets)
+}
+
+// Blend returns a copy of the base where every vertex and normal moves by
+// weights[i] times its offset towards target i. Weights of 1 reach the
+// target, the weights need not sum to one. Normals are re-normalized and
+// tangents are recomputed if the base has them.
+func (b *BlendShape) Blend(weights ...float64) (*model.Object, error) {
+	if len(weights) != len(b.targets) {
+		return nil, fmt.Errorf("mesh: got %d weights for %d targets", len(weights), len(b.targets))
+	}
+
+	o := clone(b.base)
+	for i := range o.Vertices {
+		v := &o.Vertices[i]
+		p := util.NewVector3FromVertex(v)
+		for k, t := range b.targets {
+			if weights[k] != 0 {
+				p = p.Add(util.NewVector3FromVertex(&t.Vertices[i]).Sub(util.NewVector3FromVertex(&b.base.Vertices[i])).Scale(weights[k]))
+			}
+		}
+		v.X, v.Y, v.Z = p.X, p.Y, p.Z
+	}
+
+	normal := func(n *model.Normal) util.Vector3 {
+		return util.NewVec3(n.X, n.Y, n.Z)
+	}
+	for i := range o.Normals {
+		n := &o.Normals[i]
+		sum := normal(n)
+		for k, t := range b.targets {
+			if weights[k] != 0 {
+				sum = sum.Add(normal(&t.Normals[i]).Sub(normal(&b.base.Normals[i])).Scale(weights[k]))
+			}
+		}
+		if sum.Length() > 1e-12 {
+			sum = sum.Normalize()
+		} else {
+			sum = normal(n)
+		}
+		n.X, n.Y, n.Z = sum.X, sum.Y, sum.Z
+	}
+
+	if len(o.Tangents) > 0 {
+		ComputeTangents(o)
+	}
+	return o, nil
+}
+
+// sameTopology checks that both objects have the same attribute counts
+// and that every face uses the same indices
+func sameTopology(a, b *model.Object) error {
+	counts := []struct {
+		name string
+		a, b int
+	}{
+		{"vertices", len(a.Vertices), len(b.Vertices)},
+		{"normals", len(a.Normals), len(b.Normals)},
+		{"texture coordinates", len(a.Textures), len(b.Textures)},
+		{"faces", len(a.Faces), len(b.Faces)},
+	}
+	for _, c := range counts {
+		if c.a != c.b {
+			return fmt.Errorf("%w: %d %s instead of %d", ErrTopologyMismatch, c.b, c.name, c.a)
+		}
+	}
+
+	ra, rb := newResolver(a), newResolver(b)
+	for i := range a.Faces {
+		pa, pb := a.Faces[i].Points, b.Faces[i].Points
+		if len(pa) != len(pb) {
+			return fmt.Errorf("%w: face %d has %d points instead of %d", ErrTopologyMismatch, i, len(pb), len(pa))
+		}
+		for j := range pa {
+			if ra.corner(pa[j]) != rb.corner(pb[j]) {
+				return fmt.Errorf("%w: point %d of face %d differs", ErrTopologyMismatch, j, i)
+			}
+		}
+	}
+	return nil
+}
+
+// clone returns a deep copy of the object whose points reference its own
+// slices
+func clone(o *model.Object) *model.Object {
+	c := &model.Object{
+		Name:     o.Name,
+		Vertices: append([]model.Vertex(nil), o.Vertices...),
+		Normals:  append([]model.Normal(nil), o.Normals...),
+		Textures: append([]model.TextureCoord(nil), o.Textures...),
+		Tangents: append([]model.Tangent(nil), o.Tangents...),
+		Colors:   append([]model.VertexColor(nil), o.Colors...),
+		Weights:  append([]float64(nil), o.Weights...),
+		Faces:    make([]model.Face, len(o.Faces)),
+		Custom:   o.Custom,
+
+		ParamVertices: append([]model.ParamVertex(nil), o.ParamVertices...),
+		Curves:        append([]model.Curve(nil), o.Curves...),
+		Surfaces:      append([]model.Surface(nil), o.Surfaces...),
+	}
+
+	r := newResolver(o)
+	points := func(ps []*model.Point) []*model.Point {
+		out := make([]*model.Point, len(ps))
+		for j, p := range ps {
+			cr := r.corner(p)
+			np := &model.Point{}
+			if cr.v >= 0 {
+				np.Vertex = &c.Vertices[cr.v]
+			}
+			if cr.vt >= 0 {
+				np.Texture = &c.Textures[cr.vt]
+			}
+			if cr.vn >= 0 {
+				np.Normal = &c.Normals[cr.vn]
+			}
+			out[j] = np
+		}
+		return out
+	}
+	for i, f := range o.Faces {
+		c.Faces[i] = model.Face{Index: f.Index, Points: points(f.Points)}
+	}
+	for _, l := range o.Lines {
+		c.Lines = append(c.Lines, model.Line{Index: l.Index, Points: points(l.Points)})
+	}
+	for _, ps := range o.PointSets {
+		c.PointSets = append(c.PointSets, model.PointSet{Index: ps.Index, Points: points(ps.Points)})
+	}
+	return c
+}
@@ -0,0 +1,121 @@
+package mesh
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	model "tinyrender-golang/model"
+)
+
+// rotateY turns the vertices and normals of a copy of o by a quarter turn
+func rotateY(o *model.Object) *model.Object {
+	c := clone(o)
+	for i := range c.Vertices {
+		v := &c.Vertices[i]
+		v.X, v.Z = v.Z, -v.X
+	}
+	for i := range c.Normals {
+		n := &c.Normals[i]
+		n.X, n.Z = n.Z, -n.X
+	}
+	return c
+}
+
+func TestBlendShape(t *testing.T) {
+	base := UVSphere(1, 8)
+	big := clone(base)
+	for i := range big.Vertices {
+		big.Vertices[i].Y *= 2
+	}
+
+	b, err := NewBlendShape(base, big, rotateY(base))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Targets() != 2 {
+		t.Fatalf("got %d targets", b.Targets())
+	}
+
+	o, err := b.Blend(0.5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range o.Vertices {
+		if got, want := o.Vertices[i].Y, base.Vertices[i].Y*1.5; math.Abs(got-want) > 1e-12 {
+			t.Fatalf("vertex %d is at height %f, expected %f", i, got, want)
+		}
+	}
+	for _, f := range o.Faces {
+		for _, p := range f.Points {
+			if i := p.Vertex.Index - 1; p.Vertex != &o.Vertices[i] {
+				t.Fatalf("blended faces do not point at the blended vertices")
+			}
+		}
+	}
+	if top := base.Vertices[0].Y; math.Abs(top) != 1 {
+		t.Errorf("base is modified, top vertex is at %f", top)
+	}
+
+	half, err := b.Blend(0, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, n := range half.Normals {
+		if l := math.Sqrt(n.X*n.X + n.Y*n.Y + n.Z*n.Z); math.Abs(l-1) > 1e-9 {
+			t.Fatalf("normal %d has length %f", i, l)
+		}
+	}
+	if len(half.Tangents) != len(half.Normals) {
+		t.Errorf("tangents are not recomputed")
+	}
+
+	if _, err := b.Blend(1); err == nil {
+		t.Errorf("expected an error for a missing weight")
+	}
+}
+
+func TestBlendShapeTopology(t *testing.T) {
+	base := UVSphere(1, 8)
+	if _, err := NewBlendShape(base, Icosphere(1, 1)); !errors.Is(err, ErrTopologyMismatch) {
+		t.Errorf("got %v for a different mesh", err)
+	}
+
+	flipped := clone(base)
+	ps := flipped.Faces[3].Points
+	ps[0], ps[1] = ps[1], ps[0]
+	if _, err := NewBlendShape(base, flipped); !errors.Is(err, ErrTopologyMismatch) {
+		t.Errorf("got %v for a flipped face", err)
+	}
+}
+
+func TestLoadBlendShape(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, body string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	base := write("base.obj", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n")
+	smile := write("smile.obj", "v 0 0 0\nv 2 0 0\nv 0 1 0\nf 1 2 3\n")
+	broken := write("broken.obj", "v 0 0 0\nv 2 0 0\nv 0 1 0\nf 1 3 2\n")
+
+	b, err := LoadBlendShape(base, smile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := b.Blend(0.25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Vertices[1].X != 1.25 {
+		t.Errorf("got %f, expected 1.25", o.Vertices[1].X)
+	}
+
+	if _, err := LoadBlendShape(base, smile, broken); !errors.Is(err, ErrTopologyMismatch) {
+		t.Errorf("got %v for a target with other faces", err)
+	}
+}
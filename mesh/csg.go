@@ -0,0 +1,467 @@
+package mesh
+
+import (
+	"math"
+	"sort"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/util"
+)
+
+// The boolean operations follow the BSP tree approach of csg.js: each
+// operand is turned into a BSP tree, the trees clip each other and the
+// remaining polygons are merged. Inputs must be closed and oriented
+// counter-clockwise seen from outside, they are not modified.
+
+// csgEpsilon is the thickness of a plane when classifying points
+const csgEpsilon = 1e-7
+
+// Union returns the volume covered by a or b
+func Union(a, b *model.Object) *model.Object {
+	na, nb := newCSGNode(csgPolygons(a)), newCSGNode(csgPolygons(b))
+	na.clipTo(nb)
+	nb.clipTo(na)
+	nb.invert()
+	nb.clipTo(na)
+	nb.invert()
+	na.build(nb.allPolygons(nil))
+	return csgObject("union", na.allPolygons(nil))
+}
+
+// Intersection returns the volume covered by both a and b
+func Intersection(a, b *model.Object) *model.Object {
+	na, nb := newCSGNode(csgPolygons(a)), newCSGNode(csgPolygons(b))
+	na.invert()
+	nb.clipTo(na)
+	nb.invert()
+	na.clipTo(nb)
+	nb.clipTo(na)
+	na.build(nb.allPolygons(nil))
+	na.invert()
+	return csgObject("intersection", na.allPolygons(nil))
+}
+
+// Difference returns the volume of a which is not covered by b, e.g. a
+// wall with a window cut out of it
+func Difference(a, b *model.Object) *model.Object {
+	na, nb := newCSGNode(csgPolygons(a)), newCSGNode(csgPolygons(b))
+	na.invert()
+	na.clipTo(nb)
+	nb.clipTo(na)
+	nb.invert()
+	nb.clipTo(na)
+	nb.invert()
+	na.build(nb.allPolygons(nil))
+	na.invert()
+	return csgObject("difference", na.allPolygons(nil))
+}
+
+type csgVertex struct {
+	pos    util.Vector3
+	normal util.Vector3
+	u, v   float64
+}
+
+func (a csgVertex) lerp(b csgVertex, t float64) csgVertex {
+	return csgVertex{
+		pos:    a.pos.Add(b.pos.Sub(a.pos).Scale(t)),
+		normal: a.normal.Add(b.normal.Sub(a.normal).Scale(t)),
+		u:      a.u + (b.u-a.u)*t,
+		v:      a.v + (b.v-a.v)*t,
+	}
+}
+
+type csgPlane struct {
+	normal util.Vector3
+	w      float64
+}
+
+type csgPolygon struct {
+	vertices []csgVertex
+	plane    csgPlane
+}
+
+func newCSGPolygon(vs []csgVertex) csgPolygon {
+	n := vs[1].pos.Sub(vs[0].pos).CrossProduct(vs[2].pos.Sub(vs[0].pos)).Normalize()
+	return csgPolygon{vertices: vs, plane: csgPlane{normal: n, w: n.DotProduct(vs[0].pos)}}
+}
+
+func (p csgPolygon) flip() csgPolygon {
+	vs := make([]csgVertex, len(p.vertices))
+	for i, v := range p.vertices {
+		v.normal = v.normal.Scale(-1)
+		vs[len(vs)-1-i] = v
+	}
+	return csgPolygon{vertices: vs, plane: csgPlane{normal: p.plane.normal.Scale(-1), w: -p.plane.w}}
+}
+
+const (
+	csgCoplanar = 0
+	csgFront    = 1
+	csgBack     = 2
+	csgSpanning = 3
+)
+
+// split sorts the polygon into the lists by its side of the plane,
+// spanning polygons are cut in two
+func (pl csgPlane) split(p csgPolygon, coplanarFront, coplanarBack, front, back *[]csgPolygon) {
+	var kind int
+	types := make([]int, len(p.vertices))
+	for i, v := range p.vertices {
+		t := pl.normal.DotProduct(v.pos) - pl.w
+		switch {
+		case t < -csgEpsilon:
+			types[i] = csgBack
+		case t > csgEpsilon:
+			types[i] = csgFront
+		default:
+			types[i] = csgCoplanar
+		}
+		kind |= types[i]
+	}
+
+	switch kind {
+	case csgCoplanar:
+		if pl.normal.DotProduct(p.plane.normal) > 0 {
+			*coplanarFront = append(*coplanarFront, p)
+		} else {
+			*coplanarBack = append(*coplanarBack, p)
+		}
+	case csgFront:
+		*front = append(*front, p)
+	case csgBack:
+		*back = append(*back, p)
+	case csgSpanning:
+		var f, b []csgVertex
+		for i, vi := range p.vertices {
+			j := (i + 1) % len(p.vertices)
+			ti, tj := types[i], types[j]
+			vj := p.vertices[j]
+			if ti != csgBack {
+				f = append(f, vi)
+			}
+			if ti != csgFront {
+				b = append(b, vi)
+			}
+			if ti|tj == csgSpanning {
+				t := (pl.w - pl.normal.DotProduct(vi.pos)) / pl.normal.DotProduct(vj.pos.Sub(vi.pos))
+				v := vi.lerp(vj, t)
+				f = append(f, v)
+				b = append(b, v)
+			}
+		}
+		if len(f) >= 3 {
+			*front = append(*front, csgPolygon{vertices: f, plane: p.plane})
+		}
+		if len(b) >= 3 {
+			*back = append(*back, csgPolygon{vertices: b, plane: p.plane})
+		}
+	}
+}
+
+type csgNode struct {
+	plane    *csgPlane
+	front    *csgNode
+	back     *csgNode
+	polygons []csgPolygon
+}
+
+func newCSGNode(ps []csgPolygon) *csgNode {
+	n := &csgNode{}
+	n.build(ps)
+	return n
+}
+
+// invert turns solid space into empty space and the other way round
+func (n *csgNode) invert() {
+	for i := range n.polygons {
+		n.polygons[i] = n.polygons[i].flip()
+	}
+	if n.plane != nil {
+		n.plane.normal = n.plane.normal.Scale(-1)
+		n.plane.w = -n.plane.w
+	}
+	if n.front != nil {
+		n.front.invert()
+	}
+	if n.back != nil {
+		n.back.invert()
+	}
+	n.front, n.back = n.back, n.front
+}
+
+// clipPolygons removes the parts of ps inside the solid of this tree
+func (n *csgNode) clipPolygons(ps []csgPolygon) []csgPolygon {
+	if n.plane == nil {
+		return append([]csgPolygon(nil), ps...)
+	}
+	var front, back []csgPolygon
+	for _, p := range ps {
+		n.plane.split(p, &front, &back, &front, &back)
+	}
+	if n.front != nil {
+		front = n.front.clipPolygons(front)
+	}
+	if n.back != nil {
+		back = n.back.clipPolygons(back)
+	} else {
+		back = nil
+	}
+	return append(front, back...)
+}
+
+// clipTo removes the parts of this tree's polygons inside other
+func (n *csgNode) clipTo(other *csgNode) {
+	n.polygons = other.clipPolygons(n.polygons)
+	if n.front != nil {
+		n.front.clipTo(other)
+	}
+	if n.back != nil {
+		n.back.clipTo(other)
+	}
+}
+
+func (n *csgNode) allPolygons(out []csgPolygon) []csgPolygon {
+	out = append(out, n.polygons...)
+	if n.front != nil {
+		out = n.front.allPolygons(out)
+	}
+	if n.back != nil {
+		out = n.back.allPolygons(out)
+	}
+	return out
+}
+
+func (n *csgNode) build(ps []csgPolygon) {
+	if len(ps) == 0 {
+		return
+	}
+	if n.plane == nil {
+		pl := ps[0].plane
+		n.plane = &pl
+	}
+	var front, back []csgPolygon
+	for _, p := range ps {
+		n.plane.split(p, &n.polygons, &n.polygons, &front, &back)
+	}
+	if len(front) > 0 {
+		if n.front == nil {
+			n.front = &csgNode{}
+		}
+		n.front.build(front)
+	}
+	if len(back) > 0 {
+		if n.back == nil {
+			n.back = &csgNode{}
+		}
+		n.back.build(back)
+	}
+}
+
+// csgPolygons converts the triangles of an object, points without a
+// normal use the face normal and points without texture coordinates (0, 0)
+func csgPolygons(o *model.Object) []csgPolygon {
+	var ps []csgPolygon
+	for _, t := range triangles(o) {
+		var vs [3]csgVertex
+		for i, c := range t.c {
+			vs[i].pos = util.NewVector3FromVertex(&o.Vertices[c.v])
+		}
+		faceN := vs[1].pos.Sub(vs[0].pos).CrossProduct(vs[2].pos.Sub(vs[0].pos))
+		if faceN.Length() < 1e-14 {
+			continue
+		}
+		for i, c := range t.c {
+			vs[i].normal = faceN.Normalize()
+			if c.vn >= 0 {
+				n := o.Normals[c.vn]
+				vs[i].normal = util.NewVec3(n.X, n.Y, n.Z)
+			}
+			if c.vt >= 0 {
+				vs[i].u, vs[i].v = o.Textures[c.vt].U, o.Textures[c.vt].V
+			}
+		}
+		ps = append(ps, newCSGPolygon(vs[:]))
+	}
+	return ps
+}
+
+// csgObject welds the polygon vertices, inserts vertices where one polygon
+// ends in the middle of the edge of another (T-junctions) so the result is
+// watertight, and triangulates.
+func csgObject(name string, ps []csgPolygon) *model.Object {
+	b := &builder{name: name}
+	weld := newWelder(csgEpsilon * 10)
+
+	type welded struct {
+		ids []int
+		vs  []csgVertex
+	}
+	polys := make([]welded, 0, len(ps))
+	for _, p := range ps {
+		var w welded
+		for _, v := range p.vertices {
+			id := weld.add(v.pos)
+			if len(w.ids) > 0 && w.ids[len(w.ids)-1] == id {
+				continue
+			}
+			w.ids = append(w.ids, id)
+			w.vs = append(w.vs, v)
+		}
+		if len(w.ids) > 1 && w.ids[0] == w.ids[len(w.ids)-1] {
+			w.ids, w.vs = w.ids[:len(w.ids)-1], w.vs[:len(w.vs)-1]
+		}
+		if len(w.ids) >= 3 {
+			polys = append(polys, w)
+		}
+	}
+
+	for _, p := range weld.points {
+		b.vertex(p)
+	}
+	byX := weld.sortedByX()
+
+	textures := make(map[[2]float64]int)
+	normals := make(map[util.Vector3]int)
+	cornerOf := func(id int, v csgVertex) corner {
+		key := [2]float64{v.u, v.v}
+		vt, ok := textures[key]
+		if !ok {
+			vt = b.texture(v.u, v.v)
+			textures[key] = vt
+		}
+		n := v.normal.Normalize()
+		vn, ok := normals[n]
+		if !ok {
+			vn = b.normal(n)
+			normals[n] = vn
+		}
+		return corner{v: id, vt: vt, vn: vn}
+	}
+
+	for _, p := range polys {
+		var ids []int
+		var vs []csgVertex
+		inserted := false
+		for i := range p.ids {
+			j := (i + 1) % len(p.ids)
+			ids = append(ids, p.ids[i])
+			vs = append(vs, p.vs[i])
+			for _, on := range weld.onSegment(byX, p.ids[i], p.ids[j]) {
+				ids = append(ids, on.id)
+				vs = append(vs, p.vs[i].lerp(p.vs[j], on.t))
+				inserted = true
+			}
+		}
+
+		cs := make([]corner, len(ids))
+		for i := range ids {
+			cs[i] = cornerOf(ids[i], vs[i])
+		}
+		if !inserted {
+			for i := 1; i+1 < len(cs); i++ {
+				b.face(cs[0], cs[i], cs[i+1])
+			}
+			continue
+		}
+
+		// fan from the centroid, a fan from a corner would create
+		// degenerate triangles along the split edges
+		var center csgVertex
+		for _, v := range vs {
+			center.pos = center.pos.Add(v.pos)
+			center.normal = center.normal.Add(v.normal)
+			center.u += v.u
+			center.v += v.v
+		}
+		k := 1 / float64(len(vs))
+		center = csgVertex{pos: center.pos.Scale(k), normal: center.normal.Scale(k), u: center.u * k, v: center.v * k}
+		cc := cornerOf(b.vertex(center.pos), center)
+		for i := range cs {
+			b.face(cc, cs[i], cs[(i+1)%len(cs)])
+		}
+	}
+
+	return b.object()
+}
+
+// welder merges points closer than eps using a hash grid
+type welder struct {
+	eps    float64
+	points []util.Vector3
+	cells  map[[3]int64][]int
+}
+
+func newWelder(eps float64) *welder {
+	return &welder{eps: eps, cells: make(map[[3]int64][]int)}
+}
+
+func (w *welder) cell(p util.Vector3) [3]int64 {
+	return [3]int64{int64(math.Floor(p.X / w.eps)), int64(math.Floor(p.Y / w.eps)), int64(math.Floor(p.Z / w.eps))}
+}
+
+func (w *welder) add(p util.Vector3) int {
+	c := w.cell(p)
+	for dx := int64(-1); dx <= 1; dx++ {
+		for dy := int64(-1); dy <= 1; dy++ {
+			for dz := int64(-1); dz <= 1; dz++ {
+				for _, id := range w.cells[[3]int64{c[0] + dx, c[1] + dy, c[2] + dz}] {
+					if w.points[id].Sub(p).Length() <= w.eps {
+						return id
+					}
+				}
+			}
+		}
+	}
+	w.points = append(w.points, p)
+	w.cells[c] = append(w.cells[c], len(w.points)-1)
+	return len(w.points) - 1
+}
+
+func (w *welder) sortedByX() []int {
+	ids := make([]int, len(w.points))
+	for i := range ids {
+		ids[i] = i
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return w.points[ids[i]].X < w.points[ids[j]].X
+	})
+	return ids
+}
+
+type onSegment struct {
+	id int
+	t  float64
+}
+
+// onSegment returns the points strictly inside the segment a-b, ordered
+// from a to b
+func (w *welder) onSegment(byX []int, a, b int) []onSegment {
+	pa, pb := w.points[a], w.points[b]
+	d := pb.Sub(pa)
+	length2 := d.DotProduct(d)
+	if length2 == 0 {
+		return nil
+	}
+	lo, hi := math.Min(pa.X, pb.X)-w.eps, math.Max(pa.X, pb.X)+w.eps
+	start := sort.Search(len(byX), func(i int) bool { return w.points[byX[i]].X >= lo })
+
+	var out []onSegment
+	for _, id := range byX[start:] {
+		p := w.points[id]
+		if p.X > hi {
+			break
+		}
+		if id == a || id == b {
+			continue
+		}
+		t := p.Sub(pa).DotProduct(d) / length2
+		if t <= 0 || t >= 1 {
+			continue
+		}
+		if pa.Add(d.Scale(t)).Sub(p).Length() <= w.eps {
+			out = append(out, onSegment{id: id, t: t})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].t < out[j].t })
+	return out
+}
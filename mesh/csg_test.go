@@ -0,0 +1,97 @@
+package mesh
+
+import (
+	"math"
+	"testing"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/util"
+)
+
+// translate moves every vertex of the object by d
+func translate(o *model.Object, d util.Vector3) *model.Object {
+	for i := range o.Vertices {
+		o.Vertices[i].X += d.X
+		o.Vertices[i].Y += d.Y
+		o.Vertices[i].Z += d.Z
+	}
+	return o
+}
+
+// volume returns the signed volume enclosed by the triangles
+func volume(o *model.Object) float64 {
+	ps := Positions(o)
+	var v float64
+	for _, t := range Triangles(o) {
+		v += ps[t[0]].DotProduct(ps[t[1]].CrossProduct(ps[t[2]])) / 6
+	}
+	return v
+}
+
+// watertight reports whether every edge is matched by exactly one edge
+// running the other way
+func watertight(t *testing.T, o *model.Object) {
+	edges := make(map[[2]int]int)
+	for _, tri := range Triangles(o) {
+		for i := 0; i < 3; i++ {
+			edges[[2]int{tri[i], tri[(i+1)%3]}]++
+		}
+	}
+	for e, n := range edges {
+		if n != 1 || edges[[2]int{e[1], e[0]}] != 1 {
+			t.Fatalf("edge %v is used %d times and reversed %d times", e, n, edges[[2]int{e[1], e[0]}])
+		}
+	}
+}
+
+func TestCSG(t *testing.T) {
+	var tests = []struct {
+		Name   string
+		Op     func(a, b *model.Object) *model.Object
+		Volume float64
+	}{
+		{"union", Union, 1.71875},
+		{"intersection", Intersection, 0.28125},
+		{"difference", Difference, 0.71875},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			a := Cube(1, 1)
+			b := translate(Cube(1, 1), util.NewVec3(0.5, 0.25, 0.25))
+			o := test.Op(a, b)
+
+			if v := volume(o); math.Abs(v-test.Volume) > 1e-6 {
+				t.Errorf("got volume %f, expected %f", v, test.Volume)
+			}
+			watertight(t, o)
+
+			for _, f := range o.Faces {
+				for _, p := range f.Points {
+					if p.Normal == nil || p.Texture == nil {
+						t.Fatalf("face %d lost its attributes", f.Index)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCSGWindow(t *testing.T) {
+	wall := Cube(2, 1)
+	for i := range wall.Vertices {
+		wall.Vertices[i].Z *= 0.1
+	}
+	window := Cylinder(0.4, 1, 16)
+	for i := range window.Vertices {
+		window.Vertices[i].Y, window.Vertices[i].Z = -window.Vertices[i].Z, window.Vertices[i].Y
+	}
+	for i := range window.Normals {
+		window.Normals[i].Y, window.Normals[i].Z = -window.Normals[i].Z, window.Normals[i].Y
+	}
+
+	o := Difference(wall, window)
+	watertight(t, o)
+	if v, max := volume(o), volume(wall); v <= 0 || v >= max {
+		t.Errorf("got volume %f, expected less than the wall %f", v, max)
+	}
+}
@@ -0,0 +1,480 @@
+package mesh
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/util"
+)
+
+// ErrFreeForm is wrapped by the errors about curves and surfaces which
+// cannot be evaluated
+var ErrFreeForm = errors.New("mesh: invalid free-form geometry")
+
+// A TessellateOption is a functional option
+// which updates the tessellation settings
+type TessellateOption func(c *tessellateConfig)
+
+type tessellateConfig struct {
+	tolerance   float64
+	maxSegments int
+}
+
+// WithChordTolerance sets how far the tessellation may deviate from the
+// exact curve or surface, the default is 0.1% of the size of its control
+// points
+func WithChordTolerance(tolerance float64) TessellateOption {
+	return func(c *tessellateConfig) {
+		c.tolerance = tolerance
+	}
+}
+
+// WithMaxSpanSegments limits the segments per knot span and direction,
+// the default is 64
+func WithMaxSpanSegments(n int) TessellateOption {
+	return func(c *tessellateConfig) {
+		c.maxSegments = n
+	}
+}
+
+func newTessellateConfig(options []TessellateOption) tessellateConfig {
+	c := tessellateConfig{maxSegments: 64}
+	for _, opt := range options {
+		opt(&c)
+	}
+	c.maxSegments = atLeast(c.maxSegments, 1)
+	return c
+}
+
+// Tessellate returns a copy of the object where every Bezier, B-spline and
+// NURBS surface is replaced by triangles with normals and texture
+// coordinates spanning the surface's parameter range, and every curve by a
+// polyline in Lines. Every knot span is
+// split as often as its curvature needs, on a grid shared by the whole
+// surface so no cracks appear. Trimming curves and the bmatrix, cardinal
+// and taylor bases are not supported.
+func Tessellate(o *model.Object, options ...TessellateOption) (*model.Object, error) {
+	c := newTessellateConfig(options)
+
+	r := newResolver(o)
+	b := &builder{
+		name:     o.Name,
+		vertices: append([]model.Vertex(nil), o.Vertices...),
+		textures: append([]model.TextureCoord(nil), o.Textures...),
+		normals:  append([]model.Normal(nil), o.Normals...),
+	}
+	// elements with a point that does not resolve to a vertex are skipped
+	// like triangles does
+	corners := func(ps []*model.Point) ([]corner, bool) {
+		cs := make([]corner, len(ps))
+		for i, p := range ps {
+			cs[i] = r.corner(p)
+			if cs[i].v < 0 {
+				return nil, false
+			}
+		}
+		return cs, true
+	}
+	for _, f := range o.Faces {
+		if cs, ok := corners(f.Points); ok {
+			b.face(cs...)
+		}
+	}
+	for _, l := range o.Lines {
+		if cs, ok := corners(l.Points); ok {
+			b.lines = append(b.lines, cs)
+		}
+	}
+	for _, ps := range o.PointSets {
+		if cs, ok := corners(ps.Points); ok {
+			b.points = append(b.points, cs)
+		}
+	}
+
+	for i := range o.Surfaces {
+		s, err := newSurfaceEval(o, &o.Surfaces[i])
+		if err != nil {
+			return nil, fmt.Errorf("surface %d: %w", i, err)
+		}
+		s.tessellate(b, c)
+	}
+	for i := range o.Curves {
+		ps, err := CurvePoints(o, &o.Curves[i], options...)
+		if err != nil {
+			return nil, fmt.Errorf("curve %d: %w", i, err)
+		}
+		line := make([]corner, len(ps))
+		for k, p := range ps {
+			line[k] = corner{v: b.vertex(p), vt: -1, vn: -1}
+		}
+		b.lines = append(b.lines, line)
+	}
+
+	out := b.object()
+	out.Custom = o.Custom
+	out.ParamVertices = append([]model.ParamVertex(nil), o.ParamVertices...)
+	if len(o.Colors) > 0 {
+		out.Colors = append([]model.VertexColor(nil), o.Colors...)
+		for len(out.Colors) < len(out.Vertices) {
+			out.Colors = append(out.Colors, model.VertexColor{Index: int64(len(out.Colors) + 1), R: 1, G: 1, B: 1})
+		}
+	}
+	if len(o.Weights) > 0 {
+		out.Weights = append([]float64(nil), o.Weights...)
+		for len(out.Weights) < len(out.Vertices) {
+			out.Weights = append(out.Weights, 1)
+		}
+	}
+	if len(o.Tangents) > 0 {
+		ComputeTangents(out)
+	}
+	return out, nil
+}
+
+// CurvePoints evaluates a curve of the object into a polyline from U0 to U1
+func CurvePoints(o *model.Object, curve *model.Curve, options ...TessellateOption) ([]util.Vector3, error) {
+	c := newTessellateConfig(options)
+	ctrl := controlPoints(o, curve.Vertices, curve.Rational)
+	knots, err := knotVector(curve.Type, curve.Degree, len(ctrl), curve.Knots, curve.U0, curve.U1)
+	if err != nil {
+		return nil, err
+	}
+	at := func(t float64) util.Vector3 {
+		return dehomogenize(deBoor(curve.Degree, knots, ctrl, t))
+	}
+
+	tolerance := c.tolerance
+	if tolerance <= 0 {
+		tolerance = defaultTolerance(ctrl)
+	}
+	ts := sampleParameters(spans(knots, curve.U0, curve.U1), []func(float64) util.Vector3{at}, tolerance, c.maxSegments)
+	out := make([]util.Vector3, len(ts))
+	for i, t := range ts {
+		out[i] = at(t)
+	}
+	return out, nil
+}
+
+// controlPoints returns the homogeneous control points, rational curves
+// take their weights from Object.Weights
+func controlPoints(o *model.Object, vertices []int, rational bool) [][4]float64 {
+	ctrl := make([][4]float64, len(vertices))
+	for i, v := range vertices {
+		w := 1.0
+		if rational && v < len(o.Weights) {
+			w = o.Weights[v]
+		}
+		p := o.Vertices[v]
+		ctrl[i] = [4]float64{p.X * w, p.Y * w, p.Z * w, w}
+	}
+	return ctrl
+}
+
+func dehomogenize(h [4]float64) util.Vector3 {
+	if h[3] == 0 {
+		return util.NewVec3(h[0], h[1], h[2])
+	}
+	return util.NewVec3(h[0]/h[3], h[1]/h[3], h[2]/h[3])
+}
+
+func defaultTolerance(ctrl [][4]float64) float64 {
+	ps := make([]util.Vector3, len(ctrl))
+	for i, h := range ctrl {
+		ps[i] = dehomogenize(h)
+	}
+	min, max := bounds(ps)
+	if d := max.Sub(min).Length(); d > 0 {
+		return d * 1e-3
+	}
+	return 1e-3
+}
+
+// knotVector returns the B-spline knots of a curve with n control points.
+// Bezier curves are B-splines whose inner knots repeat degree times.
+// Missing `parm` values are spread evenly over lo to hi.
+func knotVector(typ model.CurveType, degree, n int, parm []float64, lo, hi float64) ([]float64, error) {
+	if degree < 1 {
+		return nil, fmt.Errorf("%w: degree %d", ErrFreeForm, degree)
+	}
+	if n < degree+1 {
+		return nil, fmt.Errorf("%w: %d control points for degree %d", ErrFreeForm, n, degree)
+	}
+
+	var knots []float64
+	switch typ {
+	case model.BSpline:
+		switch len(parm) {
+		case n + degree + 1:
+			knots = parm
+		case 0:
+			inner := n - degree
+			for i := 0; i <= degree; i++ {
+				knots = append(knots, lo)
+			}
+			for i := 1; i < inner; i++ {
+				knots = append(knots, lo+(hi-lo)*float64(i)/float64(inner))
+			}
+			for i := 0; i <= degree; i++ {
+				knots = append(knots, hi)
+			}
+		default:
+			return nil, fmt.Errorf("%w: %d knots for %d control points of degree %d", ErrFreeForm, len(parm), n, degree)
+		}
+	case model.Bezier:
+		if (n-1)%degree != 0 {
+			return nil, fmt.Errorf("%w: %d control points do not form Bezier segments of degree %d", ErrFreeForm, n, degree)
+		}
+		segments := (n - 1) / degree
+		breaks := parm
+		if len(breaks) == 0 {
+			for i := 0; i <= segments; i++ {
+				breaks = append(breaks, lo+(hi-lo)*float64(i)/float64(segments))
+			}
+		} else if len(breaks) != segments+1 {
+			return nil, fmt.Errorf("%w: %d parameters for %d Bezier segments", ErrFreeForm, len(breaks), segments)
+		}
+		for i, t := range breaks {
+			repeat := degree
+			if i == 0 || i == len(breaks)-1 {
+				repeat = degree + 1
+			}
+			for r := 0; r < repeat; r++ {
+				knots = append(knots, t)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported curve type %d", ErrFreeForm, typ)
+	}
+
+	for i := 1; i < len(knots); i++ {
+		if knots[i] < knots[i-1] {
+			return nil, fmt.Errorf("%w: knots decrease", ErrFreeForm)
+		}
+	}
+	return knots, nil
+}
+
+// deBoor evaluates a B-spline with homogeneous control points at t, t is
+// clamped to the valid parameter range
+func deBoor(degree int, knots []float64, ctrl [][4]float64, t float64) [4]float64 {
+	n := len(ctrl)
+	t = math.Max(knots[degree], math.Min(knots[n], t))
+	k := degree
+	for k+1 < n && knots[k+1] <= t {
+		k++
+	}
+
+	d := make([][4]float64, degree+1)
+	copy(d, ctrl[k-degree:k+1])
+	for r := 1; r <= degree; r++ {
+		for j := degree; j >= r; j-- {
+			i := j + k - degree
+			alpha := 0.0
+			if denom := knots[i+degree+1-r] - knots[i]; denom != 0 {
+				alpha = (t - knots[i]) / denom
+			}
+			for c := 0; c < 4; c++ {
+				d[j][c] = (1-alpha)*d[j-1][c] + alpha*d[j][c]
+			}
+		}
+	}
+	return d[degree]
+}
+
+// spans returns the distinct knots between lo and hi including both ends
+func spans(knots []float64, lo, hi float64) []float64 {
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	out := []float64{lo}
+	for _, k := range knots {
+		if k > lo && k < hi {
+			out = append(out, k)
+		}
+	}
+	out = append(out, hi)
+	sort.Float64s(out)
+
+	unique := out[:1]
+	for _, k := range out[1:] {
+		if k != unique[len(unique)-1] {
+			unique = append(unique, k)
+		}
+	}
+	return unique
+}
+
+// sampleParameters splits every span into the fewest equal segments, up to
+// max, which keep all curves within tolerance of their chords
+func sampleParameters(breaks []float64, curves []func(float64) util.Vector3, tolerance float64, max int) []float64 {
+	out := []float64{breaks[0]}
+	for s := 0; s+1 < len(breaks); s++ {
+		a, b := breaks[s], breaks[s+1]
+		n := 1
+		for n < max && !withinTolerance(a, b, n, curves, tolerance) {
+			n *= 2
+		}
+		if n > max {
+			n = max
+		}
+		for i := 1; i <= n; i++ {
+			out = append(out, a+(b-a)*float64(i)/float64(n))
+		}
+	}
+	return out
+}
+
+func withinTolerance(a, b float64, n int, curves []func(float64) util.Vector3, tolerance float64) bool {
+	for _, at := range curves {
+		for i := 0; i < n; i++ {
+			t0 := a + (b-a)*float64(i)/float64(n)
+			t1 := a + (b-a)*float64(i+1)/float64(n)
+			p0, p1 := at(t0), at(t1)
+			for _, f := range []float64{0.25, 0.5, 0.75} {
+				if segmentDistance(at(t0+(t1-t0)*f), p0, p1) > tolerance {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+func segmentDistance(p, a, b util.Vector3) float64 {
+	ab := b.Sub(a)
+	t := 0.0
+	if l := ab.DotProduct(ab); l > 0 {
+		t = math.Max(0, math.Min(1, p.Sub(a).DotProduct(ab)/l))
+	}
+	return p.Sub(a.Add(ab.Scale(t))).Length()
+}
+
+// surfaceEval evaluates a tensor product surface
+type surfaceEval struct {
+	surface *model.Surface
+	ctrl    [][4]float64
+	nu, nv  int
+	knotsU  []float64
+	knotsV  []float64
+}
+
+func newSurfaceEval(o *model.Object, s *model.Surface) (*surfaceEval, error) {
+	e := &surfaceEval{surface: s, ctrl: controlPoints(o, s.Vertices, s.Rational)}
+	if s.DegreeU < 1 || s.DegreeV < 1 {
+		return nil, fmt.Errorf("%w: degree %d x %d", ErrFreeForm, s.DegreeU, s.DegreeV)
+	}
+	if s.S0 == s.S1 || s.T0 == s.T1 {
+		return nil, fmt.Errorf("%w: empty parameter range", ErrFreeForm)
+	}
+
+	// the control points per row follow from the knots or segments in u
+	switch {
+	case s.Type == model.BSpline && len(s.KnotsU) > 0:
+		e.nu = len(s.KnotsU) - s.DegreeU - 1
+	case s.Type == model.Bezier && len(s.KnotsU) > 0:
+		e.nu = (len(s.KnotsU)-1)*s.DegreeU + 1
+	case s.Type == model.BSpline && len(s.KnotsV) > 0:
+		e.nu = len(s.Vertices) / (len(s.KnotsV) - s.DegreeV - 1)
+	case s.Type == model.Bezier && len(s.KnotsV) > 0:
+		e.nu = len(s.Vertices) / ((len(s.KnotsV)-1)*s.DegreeV + 1)
+	default:
+		e.nu = s.DegreeU + 1
+	}
+	if e.nu < 1 || len(s.Vertices)%e.nu != 0 {
+		return nil, fmt.Errorf("%w: %d control points do not form rows of %d", ErrFreeForm, len(s.Vertices), e.nu)
+	}
+	e.nv = len(s.Vertices) / e.nu
+
+	var err error
+	if e.knotsU, err = knotVector(s.Type, s.DegreeU, e.nu, s.KnotsU, s.S0, s.S1); err != nil {
+		return nil, err
+	}
+	if e.knotsV, err = knotVector(s.Type, s.DegreeV, e.nv, s.KnotsV, s.T0, s.T1); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *surfaceEval) at(u, v float64) util.Vector3 {
+	column := make([][4]float64, e.nv)
+	for j := range column {
+		column[j] = deBoor(e.surface.DegreeU, e.knotsU, e.ctrl[j*e.nu:(j+1)*e.nu], u)
+	}
+	return dehomogenize(deBoor(e.surface.DegreeV, e.knotsV, column, v))
+}
+
+// normal returns the unit normal su x sv, moving slightly inwards where
+// the derivatives vanish like at the poles of a sphere
+func (e *surfaceEval) normal(u, v float64) util.Vector3 {
+	s := e.surface
+	hu, hv := (s.S1-s.S0)*1e-6, (s.T1-s.T0)*1e-6
+	cu, cv := (s.S0+s.S1)/2, (s.T0+s.T1)/2
+	var n util.Vector3
+	for nudge := 0.0; nudge < 0.05; nudge = nudge*10 + 1e-4 {
+		pu, pv := u+(cu-u)*nudge, v+(cv-v)*nudge
+		du := e.at(math.Min(pu+hu, math.Max(s.S0, s.S1)), pv).Sub(e.at(math.Max(pu-hu, math.Min(s.S0, s.S1)), pv))
+		dv := e.at(pu, math.Min(pv+hv, math.Max(s.T0, s.T1))).Sub(e.at(pu, math.Max(pv-hv, math.Min(s.T0, s.T1))))
+		n = du.CrossProduct(dv)
+		if n.Length() > 1e-18 {
+			break
+		}
+	}
+	return n.Normalize()
+}
+
+func (e *surfaceEval) tessellate(b *builder, c tessellateConfig) {
+	s := e.surface
+	breaksU := spans(e.knotsU, s.S0, s.S1)
+	breaksV := spans(e.knotsV, s.T0, s.T1)
+
+	tolerance := c.tolerance
+	if tolerance <= 0 {
+		tolerance = defaultTolerance(e.ctrl)
+	}
+
+	// probe rows and columns at every knot and in the middle of each span
+	probes := func(breaks []float64) []float64 {
+		var out []float64
+		for i, t := range breaks {
+			out = append(out, t)
+			if i+1 < len(breaks) {
+				out = append(out, (t+breaks[i+1])/2)
+			}
+		}
+		return out
+	}
+	var rows, columns []func(float64) util.Vector3
+	for _, v := range probes(breaksV) {
+		v := v
+		rows = append(rows, func(u float64) util.Vector3 { return e.at(u, v) })
+	}
+	for _, u := range probes(breaksU) {
+		u := u
+		columns = append(columns, func(v float64) util.Vector3 { return e.at(u, v) })
+	}
+	us := sampleParameters(breaksU, rows, tolerance, c.maxSegments)
+	vs := sampleParameters(breaksV, columns, tolerance, c.maxSegments)
+
+	// the builder already holds the object's own attributes, so vertices,
+	// normals and texture coordinates have separate offsets
+	v0, vt0, vn0 := len(b.vertices), len(b.textures), len(b.normals)
+	for _, v := range vs {
+		for _, u := range us {
+			b.vertex(e.at(u, v))
+			b.normal(e.normal(u, v))
+			b.texture((u-s.S0)/(s.S1-s.S0), (v-s.T0)/(s.T1-s.T0))
+		}
+	}
+	at := func(i, j int) corner {
+		k := j*len(us) + i
+		return corner{v: v0 + k, vt: vt0 + k, vn: vn0 + k}
+	}
+	for j := 0; j+1 < len(vs); j++ {
+		for i := 0; i+1 < len(us); i++ {
+			b.face(at(i, j), at(i+1, j), at(i+1, j+1))
+			b.face(at(i, j), at(i+1, j+1), at(i, j+1))
+		}
+	}
+}
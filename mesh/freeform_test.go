@@ -0,0 +1,163 @@
+package mesh
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/util"
+)
+
+// quarterCylinder is a rational quadratic arc of radius 1 in XZ swept one
+// unit along Y
+const quarterCylinder = `
+v 1 0 0
+v 1 0 1 0.7071067811865476
+v 0 0 1
+v 1 1 0
+v 1 1 1 0.7071067811865476
+v 0 1 1
+cstype rat bspline
+deg 2 1
+surf 0 1 0 1 1 2 3 4 5 6
+parm u 0 0 0 1 1 1
+parm v 0 0 1 1
+end
+curv 0 1 1 2 3
+parm u 0 0 0 1 1 1
+end
+`
+
+func read(t *testing.T, body string) *model.Object {
+	o, err := model.NewReader(strings.NewReader(body)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func TestTessellateNURBS(t *testing.T) {
+	o := read(t, quarterCylinder)
+
+	coarse, err := Tessellate(o, WithChordTolerance(0.01))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fine, err := Tessellate(o, WithChordTolerance(0.0001))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(coarse.Surfaces) != 0 || len(coarse.Curves) != 0 || len(coarse.Lines) != 1 {
+		t.Errorf("got %d surfaces, %d curves and %d lines after tessellation", len(coarse.Surfaces), len(coarse.Curves), len(coarse.Lines))
+	}
+	if len(fine.Faces) <= len(coarse.Faces) {
+		t.Errorf("got %d faces for a finer tolerance and %d for a coarse one", len(fine.Faces), len(coarse.Faces))
+	}
+	// a flat direction needs no splitting
+	curve := len(coarse.Lines[0].Points)
+	if len(coarse.Faces)%2 != 0 || len(coarse.Vertices) != len(coarse.Faces)+2+6+curve {
+		t.Errorf("got %d vertices for %d faces, expected a single row of quads", len(coarse.Vertices), len(coarse.Faces))
+	}
+
+	for _, tess := range []*model.Object{coarse, fine} {
+		for i, v := range tess.Vertices[6:] {
+			// surface vertices and then the curve, all on the cylinder
+			if r := math.Hypot(v.X, v.Z); math.Abs(r-1) > 1e-12 {
+				t.Fatalf("vertex %d is at radius %f", i, r)
+			}
+		}
+		for i, n := range tess.Normals {
+			v := tess.Vertices[i+6]
+			if d := n.X*v.X + n.Z*v.Z; math.Abs(math.Abs(d)-1) > 1e-6 || math.Abs(n.Y) > 1e-6 {
+				t.Fatalf("normal %d is %v at %v", i, n, v)
+			}
+		}
+	}
+
+	// chords stay within the tolerance
+	for _, f := range coarse.Faces {
+		a, b := f.Points[0].Vertex, f.Points[1].Vertex
+		if r := math.Hypot((a.X+b.X)/2, (a.Z+b.Z)/2); 1-r > 0.01 {
+			t.Fatalf("chord deviates by %f", 1-r)
+		}
+	}
+
+	ps, err := CurvePoints(o, &o.Curves[0], WithChordTolerance(0.001))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) < 5 {
+		t.Errorf("got %d curve points", len(ps))
+	}
+	for _, p := range ps {
+		if r := math.Hypot(p.X, p.Z); math.Abs(r-1) > 1e-12 {
+			t.Fatalf("curve point %v is at radius %f", p, r)
+		}
+	}
+}
+
+func TestTessellateBezier(t *testing.T) {
+	// a flat bilinear patch next to a polygon face
+	o := read(t, "v 0 0 0\nv 1 0 0\nv 0 1 0\nv 1 1 0\nf 1 2 3\ncstype bezier\ndeg 1 1\nsurf 0 1 0 1 1 2 3 4\nend\n")
+	tess, err := Tessellate(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tess.Faces) != 3 || len(tess.Vertices) != 8 {
+		t.Errorf("got %d faces and %d vertices, expected 3 and 8", len(tess.Faces), len(tess.Vertices))
+	}
+	for _, n := range tess.Normals {
+		if n.Z != 1 {
+			t.Errorf("got normal %v, expected +Z", n)
+		}
+	}
+
+	// a cubic B-spline with default knots passes through its end points
+	curve := read(t, "v 0 0 0\nv 1 2 0\nv 2 -2 0\nv 3 1 0\nv 4 0 0\ncstype bspline\ndeg 3\ncurv 0 1 1 2 3 4 5\n")
+	ps, err := CurvePoints(curve, &curve.Curves[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ps[0] != (util.Vector3{}) || ps[len(ps)-1].Sub(util.NewVec3(4, 0, 0)).Length() > 1e-12 {
+		t.Errorf("curve runs from %v to %v", ps[0], ps[len(ps)-1])
+	}
+}
+
+func TestTessellateErrors(t *testing.T) {
+	bodies := []string{
+		"v 0 0 0\nv 1 0 0\nv 2 0 0\ncstype bezier\ndeg 2 2\nsurf 0 1 0 1 1 2 3 1 2 3\nend\n",
+		"v 0 0 0\nv 1 0 0\nv 2 0 0\ncstype bspline\ndeg 1 1\nsurf 0 1 0 1 1 2 3 1 2 3\nparm u 0 1\nend\n",
+		"v 0 0 0\nv 1 0 0\ncstype taylor\ndeg 1 1\nsurf 0 1 0 1 1 2 1 2\nend\n",
+		"v 0 0 0\nv 1 0 0\nsurf 0 1 0 1 1 2 1 2\nend\n",
+	}
+	for i, body := range bodies {
+		if _, err := Tessellate(read(t, body)); !errors.Is(err, ErrFreeForm) {
+			t.Errorf("body %d: got %v", i, err)
+		}
+	}
+
+	// the reader rejects empty parameter ranges, objects built in code may
+	// still have them
+	o := read(t, quarterCylinder)
+	o.Surfaces[0].T1 = o.Surfaces[0].T0
+	if _, err := Tessellate(o); !errors.Is(err, ErrFreeForm) {
+		t.Errorf("empty parameter range: got %v", err)
+	}
+}
+
+func TestTessellateSkipsUnresolvedPoints(t *testing.T) {
+	o := read(t, "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\nf 1 2 3\nl 1 2\np 1\n")
+	stray := &model.Point{Vertex: &model.Vertex{Index: 9}}
+	o.Faces[1].Points[2] = stray
+	o.Lines[0].Points[1] = stray
+	o.PointSets[0].Points[0] = stray
+
+	out, err := Tessellate(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Faces) != 1 || len(out.Lines) != 0 || len(out.PointSets) != 0 {
+		t.Errorf("got %d faces, %d lines and %d point sets", len(out.Faces), len(out.Lines), len(out.PointSets))
+	}
+}
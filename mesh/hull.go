@@ -0,0 +1,327 @@
+package mesh
+
+import (
+	"errors"
+	"math"
+	"sort"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/util"
+)
+
+// ErrDegenerateHull is returned when all points lie on a line, so the hull
+// has no area
+var ErrDegenerateHull = errors.New("mesh: points are collinear, the hull has no area")
+
+// ConvexHull returns the convex hull of the object's vertices, see
+// ConvexHullPoints
+func ConvexHull(o *model.Object) (*model.Object, error) {
+	return ConvexHullPoints(Positions(o))
+}
+
+// ConvexHullPoints returns the convex hull of a point cloud as a closed
+// triangle mesh with flat normals, computed with quickhull. Points on the
+// hull but not at a corner are left out. Coplanar input gives a flat
+// polygon with a face on each side.
+func ConvexHullPoints(points []util.Vector3) (*model.Object, error) {
+	ps := uniquePoints(points)
+	if len(ps) < 3 {
+		return nil, ErrDegenerateHull
+	}
+
+	min, max := bounds(ps)
+	extent := max.Sub(min)
+	eps := 1e-9 * math.Max(extent.X, math.Max(extent.Y, extent.Z))
+
+	h := &quickhull{ps: ps, eps: eps, edges: make(map[[2]int]int)}
+	simplex, ok := h.simplex()
+	if !ok {
+		return nil, ErrDegenerateHull
+	}
+	if len(simplex) == 3 {
+		return flatHull(ps, simplex), nil
+	}
+	h.run(simplex)
+	return h.object(), nil
+}
+
+func uniquePoints(points []util.Vector3) []util.Vector3 {
+	seen := make(map[util.Vector3]bool, len(points))
+	var out []util.Vector3
+	for _, p := range points {
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+type hullFace struct {
+	v       [3]int
+	normal  util.Vector3
+	offset  float64
+	outside []int
+	dead    bool
+}
+
+func (f *hullFace) distance(p util.Vector3) float64 {
+	return f.normal.DotProduct(p) - f.offset
+}
+
+type quickhull struct {
+	ps    []util.Vector3
+	eps   float64
+	faces []*hullFace
+	// edges maps the directed edges of live faces to their face
+	edges map[[2]int]int
+}
+
+// simplex picks four points spanning a tetrahedron, or three when all
+// points are coplanar. It fails for collinear points.
+func (h *quickhull) simplex() ([]int, bool) {
+	ps := h.ps
+
+	// the most distant pair among the extreme points along the axes
+	var extremes []int
+	for axis := 0; axis < 3; axis++ {
+		lo, hi := 0, 0
+		for i, p := range ps {
+			if axisValue(p, Axis(axis)) < axisValue(ps[lo], Axis(axis)) {
+				lo = i
+			}
+			if axisValue(p, Axis(axis)) > axisValue(ps[hi], Axis(axis)) {
+				hi = i
+			}
+		}
+		extremes = append(extremes, lo, hi)
+	}
+	a, b := extremes[0], extremes[1]
+	for _, i := range extremes {
+		for _, j := range extremes {
+			if ps[i].Sub(ps[j]).Length() > ps[a].Sub(ps[b]).Length() {
+				a, b = i, j
+			}
+		}
+	}
+
+	// the point furthest from the line
+	dir := ps[b].Sub(ps[a]).Normalize()
+	c, best := -1, h.eps
+	for i, p := range ps {
+		if d := p.Sub(ps[a]).CrossProduct(dir).Length(); d > best {
+			c, best = i, d
+		}
+	}
+	if c < 0 {
+		return nil, false
+	}
+
+	// the point furthest from the plane
+	n := ps[b].Sub(ps[a]).CrossProduct(ps[c].Sub(ps[a])).Normalize()
+	d, best := -1, h.eps
+	for i, p := range ps {
+		if dist := math.Abs(n.DotProduct(p.Sub(ps[a]))); dist > best {
+			d, best = i, dist
+		}
+	}
+	if d < 0 {
+		return []int{a, b, c}, true
+	}
+	return []int{a, b, c, d}, true
+}
+
+func (h *quickhull) addFace(a, b, c int) int {
+	pa, pb, pc := h.ps[a], h.ps[b], h.ps[c]
+	n := pb.Sub(pa).CrossProduct(pc.Sub(pa)).Normalize()
+	f := &hullFace{v: [3]int{a, b, c}, normal: n, offset: n.DotProduct(pa)}
+	id := len(h.faces)
+	h.faces = append(h.faces, f)
+	for k := 0; k < 3; k++ {
+		h.edges[[2]int{f.v[k], f.v[(k+1)%3]}] = id
+	}
+	return id
+}
+
+// assign puts every point into the outside set of the face it is furthest
+// above, points below all faces are inside the hull and dropped
+func (h *quickhull) assign(points []int, faces []int) {
+	for _, p := range points {
+		best, dist := -1, h.eps
+		for _, id := range faces {
+			if d := h.faces[id].distance(h.ps[p]); d > dist {
+				best, dist = id, d
+			}
+		}
+		if best >= 0 {
+			h.faces[best].outside = append(h.faces[best].outside, p)
+		}
+	}
+}
+
+func (h *quickhull) run(simplex []int) {
+	a, b, c, d := simplex[0], simplex[1], simplex[2], simplex[3]
+	// wind the base so the fourth point is behind it
+	n := h.ps[b].Sub(h.ps[a]).CrossProduct(h.ps[c].Sub(h.ps[a]))
+	if n.DotProduct(h.ps[d].Sub(h.ps[a])) > 0 {
+		b, c = c, b
+	}
+	faces := []int{h.addFace(a, b, c), h.addFace(a, d, b), h.addFace(b, d, c), h.addFace(c, d, a)}
+
+	rest := make([]int, 0, len(h.ps))
+	for i := range h.ps {
+		if i != a && i != b && i != c && i != d {
+			rest = append(rest, i)
+		}
+	}
+	h.assign(rest, faces)
+
+	for next := 0; next < len(h.faces); next++ {
+		f := h.faces[next]
+		if f.dead || len(f.outside) == 0 {
+			continue
+		}
+
+		// the furthest point becomes the apex of the new faces
+		apex := f.outside[0]
+		for _, p := range f.outside {
+			if f.distance(h.ps[p]) > f.distance(h.ps[apex]) {
+				apex = p
+			}
+		}
+
+		// flood the faces the apex can see
+		visible := map[int]bool{next: true}
+		stack := []int{next}
+		for len(stack) > 0 {
+			id := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			v := h.faces[id].v
+			for k := 0; k < 3; k++ {
+				other, ok := h.edges[[2]int{v[(k+1)%3], v[k]}]
+				if !ok || visible[other] {
+					continue
+				}
+				if h.faces[other].distance(h.ps[apex]) > h.eps {
+					visible[other] = true
+					stack = append(stack, other)
+				}
+			}
+		}
+
+		// edges between visible and hidden faces form the horizon
+		var horizon [][2]int
+		var orphans []int
+		for id := range visible {
+			v := h.faces[id].v
+			for k := 0; k < 3; k++ {
+				if other, ok := h.edges[[2]int{v[(k+1)%3], v[k]}]; ok && !visible[other] {
+					horizon = append(horizon, [2]int{v[k], v[(k+1)%3]})
+				}
+			}
+			orphans = append(orphans, h.faces[id].outside...)
+		}
+		for id := range visible {
+			dead := h.faces[id]
+			dead.dead = true
+			dead.outside = nil
+			for k := 0; k < 3; k++ {
+				e := [2]int{dead.v[k], dead.v[(k+1)%3]}
+				if h.edges[e] == id {
+					delete(h.edges, e)
+				}
+			}
+		}
+
+		// keep the output independent of map iteration order
+		sort.Slice(horizon, func(i, j int) bool {
+			if horizon[i][0] != horizon[j][0] {
+				return horizon[i][0] < horizon[j][0]
+			}
+			return horizon[i][1] < horizon[j][1]
+		})
+		sort.Ints(orphans)
+
+		created := make([]int, 0, len(horizon))
+		for _, e := range horizon {
+			created = append(created, h.addFace(e[0], e[1], apex))
+		}
+		h.assign(orphans, created)
+	}
+}
+
+func (h *quickhull) object() *model.Object {
+	b := &builder{name: "hull"}
+	ids := make(map[int]int)
+	for _, f := range h.faces {
+		if f.dead {
+			continue
+		}
+		n := b.normal(f.normal)
+		var cs [3]corner
+		for k, v := range f.v {
+			id, ok := ids[v]
+			if !ok {
+				id = b.vertex(h.ps[v])
+				ids[v] = id
+			}
+			cs[k] = corner{v: id, vt: -1, vn: n}
+		}
+		b.face(cs[:]...)
+	}
+	return b.object()
+}
+
+// flatHull returns the 2D hull of coplanar points in the plane of the
+// triangle a, b, c with one side facing each way
+func flatHull(ps []util.Vector3, tri []int) *model.Object {
+	origin := ps[tri[0]]
+	u := ps[tri[1]].Sub(origin).Normalize()
+	n := u.CrossProduct(ps[tri[2]].Sub(origin)).Normalize()
+	v := n.CrossProduct(u)
+
+	type planar struct {
+		x, y float64
+		i    int
+	}
+	pts := make([]planar, len(ps))
+	for i, p := range ps {
+		d := p.Sub(origin)
+		pts[i] = planar{d.DotProduct(u), d.DotProduct(v), i}
+	}
+	sort.Slice(pts, func(i, j int) bool {
+		if pts[i].x != pts[j].x {
+			return pts[i].x < pts[j].x
+		}
+		return pts[i].y < pts[j].y
+	})
+
+	// monotone chain, counter-clockwise around n
+	cross := func(o, a, b planar) float64 {
+		return (a.x-o.x)*(b.y-o.y) - (a.y-o.y)*(b.x-o.x)
+	}
+	var ring []planar
+	for pass := 0; pass < 2; pass++ {
+		start := len(ring)
+		for _, p := range pts {
+			for len(ring) >= start+2 && cross(ring[len(ring)-2], ring[len(ring)-1], p) <= 0 {
+				ring = ring[:len(ring)-1]
+			}
+			ring = append(ring, p)
+		}
+		ring = ring[:len(ring)-1]
+		for l, r := 0, len(pts)-1; l < r; l, r = l+1, r-1 {
+			pts[l], pts[r] = pts[r], pts[l]
+		}
+	}
+
+	b := &builder{name: "hull"}
+	for _, p := range ring {
+		b.vertex(ps[p.i])
+	}
+	front, back := b.normal(n), b.normal(n.Scale(-1))
+	for k := 1; k+1 < len(ring); k++ {
+		b.face(corner{v: 0, vt: -1, vn: front}, corner{v: k, vt: -1, vn: front}, corner{v: k + 1, vt: -1, vn: front})
+		b.face(corner{v: 0, vt: -1, vn: back}, corner{v: k + 1, vt: -1, vn: back}, corner{v: k, vt: -1, vn: back})
+	}
+	return b.object()
+}
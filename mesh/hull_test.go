@@ -0,0 +1,83 @@
+package mesh
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"tinyrender-golang/util"
+)
+
+func TestConvexHull(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var ps []util.Vector3
+	// corners, points on faces and edges, duplicates and interior points
+	for i := 0; i < 8; i++ {
+		p := util.NewVec3(float64(i&1)-0.5, float64(i>>1&1)-0.5, float64(i>>2&1)-0.5)
+		ps = append(ps, p, p)
+	}
+	for i := 0; i < 200; i++ {
+		p := util.NewVec3(r.Float64()-0.5, r.Float64()-0.5, r.Float64()-0.5)
+		switch i % 4 {
+		case 0:
+			p.X = 0.5
+		case 1:
+			p.Y, p.Z = -0.5, 0.5
+		}
+		ps = append(ps, p)
+	}
+
+	o, err := ConvexHullPoints(ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	watertight(t, o)
+	if len(o.Vertices) != 8 {
+		t.Errorf("got %d hull vertices, expected 8", len(o.Vertices))
+	}
+	if v := volume(o); math.Abs(v-1) > 1e-9 {
+		t.Errorf("got volume %f, expected 1", v)
+	}
+
+	sphere, err := ConvexHull(noisySphere())
+	if err != nil {
+		t.Fatal(err)
+	}
+	watertight(t, sphere)
+	hull, cloud := Positions(sphere), Positions(noisySphere())
+	for _, tri := range Triangles(sphere) {
+		a, b, c := hull[tri[0]], hull[tri[1]], hull[tri[2]]
+		n := b.Sub(a).CrossProduct(c.Sub(a)).Normalize()
+		for _, p := range cloud {
+			if d := n.DotProduct(p.Sub(a)); d > 1e-9 {
+				t.Fatalf("point %v is %g outside the hull", p, d)
+			}
+		}
+	}
+}
+
+func TestConvexHullDegenerate(t *testing.T) {
+	var flat []util.Vector3
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 5; j++ {
+			flat = append(flat, util.NewVec3(float64(i), 2, float64(j)))
+		}
+	}
+	o, err := ConvexHullPoints(flat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(o.Vertices) != 4 || len(o.Faces) != 4 {
+		t.Errorf("got %d vertices and %d faces, expected a double sided square", len(o.Vertices), len(o.Faces))
+	}
+	if len(o.Normals) != 2 || o.Normals[0].Y != -o.Normals[1].Y || math.Abs(o.Normals[0].Y) != 1 {
+		t.Errorf("got normals %v, expected one for each side", o.Normals)
+	}
+
+	line := []util.Vector3{util.NewVec3(0, 0, 0), util.NewVec3(1, 1, 1), util.NewVec3(2, 2, 2)}
+	if _, err := ConvexHullPoints(line); err != ErrDegenerateHull {
+		t.Errorf("got %v for collinear points", err)
+	}
+	if _, err := ConvexHullPoints(nil); err != ErrDegenerateHull {
+		t.Errorf("got %v for no points", err)
+	}
+}
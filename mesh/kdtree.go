@@ -0,0 +1,231 @@
+package mesh
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/util"
+)
+
+// KDTree is a spatial index over a fixed set of points. It is built once
+// and never changes afterwards, so any number of goroutines may query it
+// at the same time.
+type KDTree struct {
+	points []util.Vector3
+	// order is a balanced tree in implicit form: the point of the range
+	// lo..hi sits at its middle and splits it along axis[mid]
+	order []int
+	axis  []uint8
+}
+
+// Neighbor is a query result, Index refers to the points the tree was
+// built from
+type Neighbor struct {
+	Index    int
+	Distance float64
+}
+
+// NewKDTree builds a tree over a copy of the points in O(n log n)
+func NewKDTree(points []util.Vector3) *KDTree {
+	t := &KDTree{
+		points: append([]util.Vector3(nil), points...),
+		order:  make([]int, len(points)),
+		axis:   make([]uint8, len(points)),
+	}
+	for i := range t.order {
+		t.order[i] = i
+	}
+	t.build(0, len(t.order))
+	return t
+}
+
+// NewKDTreeFromObject builds a tree over the object's vertices, results
+// index into Object.Vertices
+func NewKDTreeFromObject(o *model.Object) *KDTree {
+	return NewKDTree(Positions(o))
+}
+
+// Len returns the number of points in the tree
+func (t *KDTree) Len() int {
+	return len(t.points)
+}
+
+// Point returns the position of point i
+func (t *KDTree) Point(i int) util.Vector3 {
+	return t.points[i]
+}
+
+func coordinate(p util.Vector3, axis uint8) float64 {
+	switch axis {
+	case 0:
+		return p.X
+	case 1:
+		return p.Y
+	}
+	return p.Z
+}
+
+func (t *KDTree) build(lo, hi int) {
+	if hi-lo <= 0 {
+		return
+	}
+
+	// split along the longest side of the range's bounds
+	min := t.points[t.order[lo]]
+	max := min
+	for _, i := range t.order[lo+1 : hi] {
+		p := t.points[i]
+		min = util.NewVec3(math.Min(min.X, p.X), math.Min(min.Y, p.Y), math.Min(min.Z, p.Z))
+		max = util.NewVec3(math.Max(max.X, p.X), math.Max(max.Y, p.Y), math.Max(max.Z, p.Z))
+	}
+	extent := max.Sub(min)
+	axis := uint8(0)
+	if extent.Y > extent.X && extent.Y >= extent.Z {
+		axis = 1
+	} else if extent.Z > extent.X && extent.Z > extent.Y {
+		axis = 2
+	}
+
+	mid := (lo + hi) / 2
+	t.selectNth(lo, hi, mid, axis)
+	t.axis[mid] = axis
+	t.build(lo, mid)
+	t.build(mid+1, hi)
+}
+
+// selectNth partially sorts order[lo:hi] so the element at n is in place
+// and smaller ones come before it
+func (t *KDTree) selectNth(lo, hi, n int, axis uint8) {
+	key := func(i int) float64 {
+		return coordinate(t.points[t.order[i]], axis)
+	}
+	for hi-lo > 1 {
+		// median of three as pivot
+		a, b, c := lo, (lo+hi)/2, hi-1
+		if key(a) > key(b) {
+			a, b = b, a
+		}
+		if key(b) > key(c) {
+			b = c
+			if key(a) > key(b) {
+				b = a
+			}
+		}
+		pivot := key(b)
+
+		// three way partition keeps runs of equal keys fast
+		lt, i, gt := lo, lo, hi
+		for i < gt {
+			switch k := key(i); {
+			case k < pivot:
+				t.order[lt], t.order[i] = t.order[i], t.order[lt]
+				lt++
+				i++
+			case k > pivot:
+				gt--
+				t.order[gt], t.order[i] = t.order[i], t.order[gt]
+			default:
+				i++
+			}
+		}
+		switch {
+		case n < lt:
+			hi = lt
+		case n >= gt:
+			lo = gt
+		default:
+			return
+		}
+	}
+}
+
+// neighborHeap is a max-heap on distance holding the best candidates
+type neighborHeap []Neighbor
+
+func (h neighborHeap) Len() int            { return len(h) }
+func (h neighborHeap) Less(i, j int) bool  { return h[i].Distance > h[j].Distance }
+func (h neighborHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *neighborHeap) Push(x interface{}) { *h = append(*h, x.(Neighbor)) }
+func (h *neighborHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// Nearest returns up to k points closest to p, closest first
+func (t *KDTree) Nearest(p util.Vector3, k int) []Neighbor {
+	if k <= 0 {
+		return nil
+	}
+	h := make(neighborHeap, 0, k)
+
+	var search func(lo, hi int)
+	search = func(lo, hi int) {
+		if hi-lo <= 0 {
+			return
+		}
+		mid := (lo + hi) / 2
+		i := t.order[mid]
+		if d := t.points[i].Sub(p).Length(); len(h) < k {
+			heap.Push(&h, Neighbor{i, d})
+		} else if d < h[0].Distance {
+			h[0] = Neighbor{i, d}
+			heap.Fix(&h, 0)
+		}
+
+		diff := coordinate(p, t.axis[mid]) - coordinate(t.points[i], t.axis[mid])
+		near, far := [2]int{lo, mid}, [2]int{mid + 1, hi}
+		if diff > 0 {
+			near, far = far, near
+		}
+		search(near[0], near[1])
+		if len(h) < k || math.Abs(diff) < h[0].Distance {
+			search(far[0], far[1])
+		}
+	}
+	search(0, len(t.order))
+
+	out := []Neighbor(h)
+	sortNeighbors(out)
+	return out
+}
+
+// Radius returns all points within distance r of p, closest first
+func (t *KDTree) Radius(p util.Vector3, r float64) []Neighbor {
+	var out []Neighbor
+
+	var search func(lo, hi int)
+	search = func(lo, hi int) {
+		if hi-lo <= 0 {
+			return
+		}
+		mid := (lo + hi) / 2
+		i := t.order[mid]
+		if d := t.points[i].Sub(p).Length(); d <= r {
+			out = append(out, Neighbor{i, d})
+		}
+
+		diff := coordinate(p, t.axis[mid]) - coordinate(t.points[i], t.axis[mid])
+		if diff <= r {
+			search(lo, mid)
+		}
+		if diff >= -r {
+			search(mid+1, hi)
+		}
+	}
+	search(0, len(t.order))
+
+	sortNeighbors(out)
+	return out
+}
+
+func sortNeighbors(ns []Neighbor) {
+	sort.Slice(ns, func(i, j int) bool {
+		if ns[i].Distance != ns[j].Distance {
+			return ns[i].Distance < ns[j].Distance
+		}
+		return ns[i].Index < ns[j].Index
+	})
+}
@@ -0,0 +1,99 @@
+package mesh
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+	"tinyrender-golang/util"
+)
+
+func bruteForce(ps []util.Vector3, p util.Vector3) []Neighbor {
+	out := make([]Neighbor, len(ps))
+	for i, q := range ps {
+		out[i] = Neighbor{i, q.Sub(p).Length()}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Distance < out[j].Distance })
+	return out
+}
+
+func TestKDTree(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	ps := make([]util.Vector3, 2000)
+	for i := range ps {
+		ps[i] = util.NewVec3(r.Float64(), r.Float64(), r.Float64()*0.1)
+	}
+	// duplicates and points sharing coordinates
+	for i := 0; i < 100; i++ {
+		ps[i+100] = ps[i]
+		ps[i+200].X = ps[i].X
+	}
+
+	tree := NewKDTree(ps)
+	if tree.Len() != len(ps) {
+		t.Fatalf("got %d points, expected %d", tree.Len(), len(ps))
+	}
+
+	for q := 0; q < 50; q++ {
+		p := util.NewVec3(r.Float64()*1.2-0.1, r.Float64()*1.2-0.1, r.Float64()*0.2-0.05)
+		expected := bruteForce(ps, p)
+
+		got := tree.Nearest(p, 7)
+		if len(got) != 7 {
+			t.Fatalf("got %d neighbours, expected 7", len(got))
+		}
+		for i, n := range got {
+			if n.Distance != expected[i].Distance {
+				t.Fatalf("neighbour %d of %v is at %f, expected %f", i, p, n.Distance, expected[i].Distance)
+			}
+		}
+
+		within := tree.Radius(p, 0.1)
+		count := 0
+		for _, n := range expected {
+			if n.Distance <= 0.1 {
+				count++
+			}
+		}
+		if len(within) != count {
+			t.Fatalf("got %d points within 0.1 of %v, expected %d", len(within), p, count)
+		}
+		for i := 1; i < len(within); i++ {
+			if within[i].Distance < within[i-1].Distance {
+				t.Fatalf("radius results are not sorted")
+			}
+		}
+	}
+
+	if n := len(tree.Nearest(ps[0], len(ps)+10)); n != len(ps) {
+		t.Errorf("got %d neighbours when asking for more than all points", n)
+	}
+	if n := len(NewKDTree(nil).Nearest(ps[0], 3)); n != 0 {
+		t.Errorf("got %d neighbours in an empty tree", n)
+	}
+}
+
+func TestKDTreeConcurrent(t *testing.T) {
+	o := Icosphere(1, 3)
+	tree := NewKDTreeFromObject(o)
+	ps := Positions(o)
+
+	var wg sync.WaitGroup
+	errs := make(chan int, len(ps))
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(ps); i += 8 {
+				if n := tree.Nearest(ps[i], 1); n[0].Distance != 0 {
+					errs <- i
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for i := range errs {
+		t.Errorf("vertex %d is not its own nearest neighbour", i)
+	}
+}
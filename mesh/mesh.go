@@ -0,0 +1,377 @@
+// Package mesh implements geometry processing on top of model objects:
+// procedural generators, normal and tangent computation and other
+// operations which read and write a model.Object.
+package mesh
+
+import (
+	"math"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/util"
+)
+
+// corner references the vertex, texture coordinate and normal of a face
+// corner, -1 means the attribute is missing
+type corner struct {
+	v  int
+	vt int
+	vn int
+}
+
+// same returns a corner which uses index i for every attribute
+func same(i int) corner {
+	return corner{v: i, vt: i, vn: i}
+}
+
+// builder accumulates vertex attributes and faces and turns them into an
+// object whose points reference the object's own slices.
+type builder struct {
+	name     string
+	vertices []model.Vertex
+	textures []model.TextureCoord
+	normals  []model.Normal
+	faces    [][]corner
+	lines    [][]corner
+	points   [][]corner
+}
+
+func (b *builder) vertex(p util.Vector3) int {
+	b.vertices = append(b.vertices, model.Vertex{X: p.X, Y: p.Y, Z: p.Z})
+	return len(b.vertices) - 1
+}
+
+func (b *builder) texture(u, v float64) int {
+	b.textures = append(b.textures, model.TextureCoord{U: u, V: v})
+	return len(b.textures) - 1
+}
+
+func (b *builder) normal(n util.Vector3) int {
+	b.normals = append(b.normals, model.Normal{X: n.X, Y: n.Y, Z: n.Z})
+	return len(b.normals) - 1
+}
+
+// point adds a vertex with its own normal and texture coordinate, all
+// three share the returned index
+func (b *builder) point(p util.Vector3, n util.Vector3, u, v float64) int {
+	b.vertex(p)
+	b.texture(u, v)
+	return b.normal(n)
+}
+
+func (b *builder) face(cs ...corner) {
+	b.faces = append(b.faces, cs)
+}
+
+// triangle adds a face made from three points added by point
+func (b *builder) triangle(i, j, k int) {
+	b.face(same(i), same(j), same(k))
+}
+
+// quad adds two triangles for the counter-clockwise quad i, j, k, l
+func (b *builder) quad(i, j, k, l int) {
+	b.triangle(i, j, k)
+	b.triangle(i, k, l)
+}
+
+func (b *builder) object() *model.Object {
+	o := &model.Object{
+		Name:     b.name,
+		Vertices: b.vertices,
+		Textures: b.textures,
+		Normals:  b.normals,
+		Faces:    make([]model.Face, len(b.faces)),
+	}
+
+	for i := range o.Vertices {
+		o.Vertices[i].Index = int64(i + 1)
+	}
+	for i := range o.Textures {
+		o.Textures[i].Index = int64(i + 1)
+	}
+	for i := range o.Normals {
+		o.Normals[i].Index = int64(i + 1)
+	}
+
+	points := func(cs []corner) []*model.Point {
+		ps := make([]*model.Point, len(cs))
+		for j, c := range cs {
+			p := &model.Point{Vertex: &o.Vertices[c.v]}
+			if c.vt >= 0 && c.vt < len(o.Textures) {
+				p.Texture = &o.Textures[c.vt]
+			}
+			if c.vn >= 0 && c.vn < len(o.Normals) {
+				p.Normal = &o.Normals[c.vn]
+			}
+			ps[j] = p
+		}
+		return ps
+	}
+	for i, cs := range b.faces {
+		o.Faces[i] = model.Face{Index: int64(i + 1), Points: points(cs)}
+	}
+	for i, cs := range b.lines {
+		o.Lines = append(o.Lines, model.Line{Index: int64(i + 1), Points: points(cs)})
+	}
+	for i, cs := range b.points {
+		o.PointSets = append(o.PointSets, model.PointSet{Index: int64(i + 1), Points: points(cs)})
+	}
+
+	return o
+}
+
+// resolver maps the pointers stored in face points back to slice indices.
+// Points built by hand may point into the object's slices, points read by
+// model.NewReader carry the 1-based OBJ index.
+type resolver struct {
+	o        *model.Object
+	vertices map[*model.Vertex]int
+	textures map[*model.TextureCoord]int
+	normals  map[*model.Normal]int
+}
+
+func newResolver(o *model.Object) *resolver {
+	r := &resolver{
+		o:        o,
+		vertices: make(map[*model.Vertex]int, len(o.Vertices)),
+		textures: make(map[*model.TextureCoord]int, len(o.Textures)),
+		normals:  make(map[*model.Normal]int, len(o.Normals)),
+	}
+	for i := range o.Vertices {
+		r.vertices[&o.Vertices[i]] = i
+	}
+	for i := range o.Textures {
+		r.textures[&o.Textures[i]] = i
+	}
+	for i := range o.Normals {
+		r.normals[&o.Normals[i]] = i
+	}
+	return r
+}
+
+func lookup(index int64, length int) int {
+	if index >= 1 && index <= int64(length) {
+		return int(index - 1)
+	}
+	return -1
+}
+
+func (r *resolver) corner(p *model.Point) corner {
+	c := corner{v: -1, vt: -1, vn: -1}
+	if p == nil {
+		return c
+	}
+	if p.Vertex != nil {
+		if i, ok := r.vertices[p.Vertex]; ok {
+			c.v = i
+		} else {
+			c.v = lookup(p.Vertex.Index, len(r.o.Vertices))
+		}
+	}
+	if p.Texture != nil {
+		if i, ok := r.textures[p.Texture]; ok {
+			c.vt = i
+		} else {
+			c.vt = lookup(p.Texture.Index, len(r.o.Textures))
+		}
+	}
+	if p.Normal != nil {
+		if i, ok := r.normals[p.Normal]; ok {
+			c.vn = i
+		} else {
+			c.vn = lookup(p.Normal.Index, len(r.o.Normals))
+		}
+	}
+	return c
+}
+
+// triangle is a triangulated face, face is the index into Object.Faces
+type triangle struct {
+	face int
+	c    [3]corner
+}
+
+// triangles fan-triangulates every face of the object, faces with fewer
+// than three points or unresolvable vertices are skipped
+func triangles(o *model.Object) []triangle {
+	r := newResolver(o)
+	var tris []triangle
+
+	for fi, f := range o.Faces {
+		if len(f.Points) < 3 {
+			continue
+		}
+		cs := make([]corner, len(f.Points))
+		valid := true
+		for i, p := range f.Points {
+			cs[i] = r.corner(p)
+			valid = valid && cs[i].v >= 0
+		}
+		if !valid {
+			continue
+		}
+		for i := 1; i+1 < len(cs); i++ {
+			tris = append(tris, triangle{face: fi, c: [3]corner{cs[0], cs[i], cs[i+1]}})
+		}
+	}
+
+	return tris
+}
+
+// Positions returns the vertices of the object as vectors
+func Positions(o *model.Object) []util.Vector3 {
+	ps := make([]util.Vector3, len(o.Vertices))
+	for i := range o.Vertices {
+		ps[i] = util.NewVector3FromVertex(&o.Vertices[i])
+	}
+	return ps
+}
+
+// Triangles returns the vertex indices of the fan-triangulated faces
+func Triangles(o *model.Object) [][3]int {
+	tris := triangles(o)
+	out := make([][3]int, len(tris))
+	for i, t := range tris {
+		out[i] = [3]int{t.c[0].v, t.c[1].v, t.c[2].v}
+	}
+	return out
+}
+
+// RecomputeNormals replaces the normals of the object by area weighted
+// vertex normals, one per vertex, and points every face point at the
+// normal of its vertex. Vertices sharing a position get the same normal.
+// Tangents are dropped since they no longer match.
+func RecomputeNormals(o *model.Object) {
+	ps := Positions(o)
+	group := make([]int, len(ps))
+	seen := make(map[util.Vector3]int)
+	for i, p := range ps {
+		id, ok := seen[p]
+		if !ok {
+			id = len(seen)
+			seen[p] = id
+		}
+		group[i] = id
+	}
+	acc := make([]util.Vector3, len(seen))
+
+	for _, t := range Triangles(o) {
+		p0, p1, p2 := ps[t[0]], ps[t[1]], ps[t[2]]
+		n := p1.Sub(p0).CrossProduct(p2.Sub(p0))
+		for _, i := range t {
+			acc[group[i]] = acc[group[i]].Add(n)
+		}
+	}
+
+	r := newResolver(o)
+	o.Normals = make([]model.Normal, len(ps))
+	o.Tangents = nil
+	for i := range ps {
+		n := acc[group[i]]
+		if n.Length() > 0 {
+			n = n.Normalize()
+		}
+		o.Normals[i] = model.Normal{Index: int64(i + 1), X: n.X, Y: n.Y, Z: n.Z}
+	}
+
+	for _, f := range o.Faces {
+		for _, p := range f.Points {
+			if c := r.corner(p); c.v >= 0 {
+				p.Normal = &o.Normals[c.v]
+			}
+		}
+	}
+}
+
+// ComputeTangents fills Object.Tangents from the texture coordinates of the
+// faces, one tangent per normal. Normals without usable texture coordinates
+// get an arbitrary tangent perpendicular to the normal.
+func ComputeTangents(o *model.Object) {
+	tan := make([]util.Vector3, len(o.Normals))
+	bitan := make([]util.Vector3, len(o.Normals))
+
+	for _, t := range triangles(o) {
+		var p [3]util.Vector3
+		var uv [3]model.TextureCoord
+		valid := true
+		for i, c := range t.c {
+			if c.vt < 0 || c.vn < 0 {
+				valid = false
+				break
+			}
+			p[i] = util.NewVector3FromVertex(&o.Vertices[c.v])
+			uv[i] = o.Textures[c.vt]
+		}
+		if !valid {
+			continue
+		}
+
+		e1, e2 := p[1].Sub(p[0]), p[2].Sub(p[0])
+		du1, dv1 := uv[1].U-uv[0].U, uv[1].V-uv[0].V
+		du2, dv2 := uv[2].U-uv[0].U, uv[2].V-uv[0].V
+		det := du1*dv2 - du2*dv1
+		if math.Abs(det) < 1e-12 {
+			continue
+		}
+		r := 1 / det
+		sdir := e1.Scale(dv2 * r).Sub(e2.Scale(dv1 * r))
+		tdir := e2.Scale(du1 * r).Sub(e1.Scale(du2 * r))
+		for _, c := range t.c {
+			tan[c.vn] = tan[c.vn].Add(sdir)
+			bitan[c.vn] = bitan[c.vn].Add(tdir)
+		}
+	}
+
+	o.Tangents = make([]model.Tangent, len(o.Normals))
+	for i := range o.Normals {
+		n := util.NewVec3(o.Normals[i].X, o.Normals[i].Y, o.Normals[i].Z)
+		t := tan[i].Sub(n.Scale(n.DotProduct(tan[i])))
+		if t.Length() < 1e-12 {
+			t = orthogonal(n)
+		}
+		t = t.Normalize()
+		w := 1.0
+		if n.CrossProduct(t).DotProduct(bitan[i]) < 0 {
+			w = -1
+		}
+		o.Tangents[i] = model.Tangent{Index: int64(i + 1), X: t.X, Y: t.Y, Z: t.Z, W: w}
+	}
+}
+
+// orthogonal returns some unit vector perpendicular to n
+func orthogonal(n util.Vector3) util.Vector3 {
+	axis := util.NewVec3(1, 0, 0)
+	if math.Abs(n.X) > 0.9 {
+		axis = util.NewVec3(0, 1, 0)
+	}
+	return n.CrossProduct(axis).Normalize()
+}
+
+// relink points every face point at the current entries of the object's
+// slices. Readers may leave points referring to copies of earlier slices
+// when the slices grew after the face was read.
+func relink(o *model.Object) {
+	r := newResolver(o)
+	var elements [][]*model.Point
+	for _, f := range o.Faces {
+		elements = append(elements, f.Points)
+	}
+	for _, l := range o.Lines {
+		elements = append(elements, l.Points)
+	}
+	for _, ps := range o.PointSets {
+		elements = append(elements, ps.Points)
+	}
+	for _, ps := range elements {
+		for _, p := range ps {
+			c := r.corner(p)
+			if c.v >= 0 {
+				p.Vertex = &o.Vertices[c.v]
+			}
+			if c.vt >= 0 {
+				p.Texture = &o.Textures[c.vt]
+			}
+			if c.vn >= 0 {
+				p.Normal = &o.Normals[c.vn]
+			}
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package mesh
+
+import (
+	"math"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/util"
+)
+
+// The generators below build objects centered on the origin with Y up.
+// Faces are counter-clockwise triangles seen from outside, every point has
+// a vertex, a normal and a texture coordinate and Object.Tangents is filled.
+// Subdivision counts below the useful minimum are raised to it.
+
+// Plane returns a square in the XZ plane facing +Y, split into
+// subdivisions x subdivisions cells.
+func Plane(size float64, subdivisions int) *model.Object {
+	b := &builder{name: "plane"}
+	h := size / 2
+	b.grid(util.NewVec3(-h, 0, h), util.NewVec3(size, 0, 0), util.NewVec3(0, 0, -size), atLeast(subdivisions, 1))
+	return finish(b)
+}
+
+// Cube returns an axis aligned cube, every side is split into
+// subdivisions x subdivisions cells and mapped to the full texture.
+func Cube(size float64, subdivisions int) *model.Object {
+	b := &builder{name: "cube"}
+	h := size / 2
+	n := atLeast(subdivisions, 1)
+	b.grid(util.NewVec3(h, -h, h), util.NewVec3(0, 0, -size), util.NewVec3(0, size, 0), n)
+	b.grid(util.NewVec3(-h, -h, -h), util.NewVec3(0, 0, size), util.NewVec3(0, size, 0), n)
+	b.grid(util.NewVec3(-h, h, h), util.NewVec3(size, 0, 0), util.NewVec3(0, 0, -size), n)
+	b.grid(util.NewVec3(-h, -h, -h), util.NewVec3(size, 0, 0), util.NewVec3(0, 0, size), n)
+	b.grid(util.NewVec3(-h, -h, h), util.NewVec3(size, 0, 0), util.NewVec3(0, size, 0), n)
+	b.grid(util.NewVec3(h, -h, -h), util.NewVec3(-size, 0, 0), util.NewVec3(0, size, 0), n)
+	return finish(b)
+}
+
+// UVSphere returns a latitude/longitude sphere with subdivisions rings
+// and twice as many segments.
+func UVSphere(radius float64, subdivisions int) *model.Object {
+	b := &builder{name: "uvsphere"}
+	rings := atLeast(subdivisions, 2)
+	rows := make([]latheRow, rings+1)
+	for r := range rows {
+		theta := math.Pi * (1 - float64(r)/float64(rings))
+		rows[r] = latheRow{
+			radius:  radius * math.Sin(theta),
+			y:       radius * math.Cos(theta),
+			normalR: math.Sin(theta),
+			normalY: math.Cos(theta),
+			v:       float64(r) / float64(rings),
+		}
+	}
+	b.lathe(rows, 2*rings)
+	return finish(b)
+}
+
+// Icosphere returns an icosahedron whose triangles are split into four
+// new ones subdivisions times, projected onto the sphere.
+func Icosphere(radius float64, subdivisions int) *model.Object {
+	t := (1 + math.Sqrt(5)) / 2
+	dirs := []util.Vector3{
+		{X: -1, Y: t}, {X: 1, Y: t}, {X: -1, Y: -t}, {X: 1, Y: -t},
+		{Y: -1, Z: t}, {Y: 1, Z: t}, {Y: -1, Z: -t}, {Y: 1, Z: -t},
+		{X: t, Z: -1}, {X: t, Z: 1}, {X: -t, Z: -1}, {X: -t, Z: 1},
+	}
+	for i := range dirs {
+		dirs[i] = dirs[i].Normalize()
+	}
+	faces := [][3]int{
+		{0, 11, 5}, {0, 5, 1}, {0, 1, 7}, {0, 7, 10}, {0, 10, 11},
+		{1, 5, 9}, {5, 11, 4}, {11, 10, 2}, {10, 7, 6}, {7, 1, 8},
+		{3, 9, 4}, {3, 4, 2}, {3, 2, 6}, {3, 6, 8}, {3, 8, 9},
+		{4, 9, 5}, {2, 4, 11}, {6, 2, 10}, {8, 6, 7}, {9, 8, 1},
+	}
+
+	for s := 0; s < subdivisions; s++ {
+		mid := make(map[[2]int]int)
+		midpoint := func(i, j int) int {
+			key := [2]int{i, j}
+			if i > j {
+				key = [2]int{j, i}
+			}
+			if k, ok := mid[key]; ok {
+				return k
+			}
+			dirs = append(dirs, dirs[i].Add(dirs[j]).Normalize())
+			mid[key] = len(dirs) - 1
+			return len(dirs) - 1
+		}
+		next := make([][3]int, 0, 4*len(faces))
+		for _, f := range faces {
+			a, c, e := midpoint(f[0], f[1]), midpoint(f[1], f[2]), midpoint(f[2], f[0])
+			next = append(next, [3]int{f[0], a, e}, [3]int{f[1], c, a}, [3]int{f[2], e, c}, [3]int{a, c, e})
+		}
+		faces = next
+	}
+
+	b := &builder{name: "icosphere"}
+	for _, d := range dirs {
+		b.vertex(d.Scale(radius))
+		b.normal(d)
+	}
+
+	// texture coordinates are shared per vertex except across the seam
+	// and at the poles, where each face gets its own
+	uvs := make(map[[2]float64]int)
+	texture := func(u, v float64) int {
+		key := [2]float64{u, v}
+		if i, ok := uvs[key]; ok {
+			return i
+		}
+		uvs[key] = b.texture(u, v)
+		return uvs[key]
+	}
+	for _, f := range faces {
+		var u, v [3]float64
+		for i, vi := range f {
+			u[i], v[i] = sphereUV(dirs[vi])
+		}
+		if math.Max(u[0], math.Max(u[1], u[2]))-math.Min(u[0], math.Min(u[1], u[2])) > 0.5 {
+			for i := range u {
+				if u[i] < 0.5 {
+					u[i]++
+				}
+			}
+		}
+		for i, vi := range f {
+			if math.Abs(dirs[vi].Y) > 1-1e-9 {
+				// pole, use the middle of the other two corners
+				u[i] = (u[(i+1)%3] + u[(i+2)%3]) / 2
+			}
+		}
+		var cs [3]corner
+		for i, vi := range f {
+			cs[i] = corner{v: vi, vt: texture(u[i], v[i]), vn: vi}
+		}
+		b.face(cs[:]...)
+	}
+
+	return finish(b)
+}
+
+// Cylinder returns a capped cylinder along Y with subdivisions segments
+// around its axis.
+func Cylinder(radius, height float64, subdivisions int) *model.Object {
+	b := &builder{name: "cylinder"}
+	segments := atLeast(subdivisions, 3)
+	h := height / 2
+	b.lathe([]latheRow{
+		{radius: radius, y: -h, normalR: 1, v: 0},
+		{radius: radius, y: h, normalR: 1, v: 1},
+	}, segments)
+	b.disc(h, radius, segments, true)
+	b.disc(-h, radius, segments, false)
+	return finish(b)
+}
+
+// Cone returns a cone along Y with its apex at the top and subdivisions
+// segments around its axis.
+func Cone(radius, height float64, subdivisions int) *model.Object {
+	b := &builder{name: "cone"}
+	segments := atLeast(subdivisions, 3)
+	h := height / 2
+	slope := util.NewVec3(height, radius, 0).Normalize()
+	b.lathe([]latheRow{
+		{radius: radius, y: -h, normalR: slope.X, normalY: slope.Y, v: 0},
+		{radius: 0, y: h, normalR: slope.X, normalY: slope.Y, v: 1},
+	}, segments)
+	b.disc(-h, radius, segments, false)
+	return finish(b)
+}
+
+// Torus returns a torus around the Y axis, the tube has subdivisions
+// segments and the ring twice as many.
+func Torus(majorRadius, minorRadius float64, subdivisions int) *model.Object {
+	b := &builder{name: "torus"}
+	sides := atLeast(subdivisions, 3)
+	segments := 2 * sides
+
+	for i := 0; i <= segments; i++ {
+		phi := 2 * math.Pi * float64(i) / float64(segments)
+		for j := 0; j <= sides; j++ {
+			theta := 2 * math.Pi * float64(j) / float64(sides)
+			d := util.NewVec3(math.Cos(theta)*math.Sin(phi), math.Sin(theta), math.Cos(theta)*math.Cos(phi))
+			c := util.NewVec3(majorRadius*math.Sin(phi), 0, majorRadius*math.Cos(phi))
+			b.point(c.Add(d.Scale(minorRadius)), d, float64(i)/float64(segments), float64(j)/float64(sides))
+		}
+	}
+
+	at := func(i, j int) int {
+		return i*(sides+1) + j
+	}
+	for i := 0; i < segments; i++ {
+		for j := 0; j < sides; j++ {
+			b.quad(at(i, j), at(i+1, j), at(i+1, j+1), at(i, j+1))
+		}
+	}
+
+	return finish(b)
+}
+
+// Capsule returns a cylinder of the given height capped by two
+// hemispheres, each hemisphere has subdivisions rings.
+func Capsule(radius, height float64, subdivisions int) *model.Object {
+	b := &builder{name: "capsule"}
+	rings := atLeast(subdivisions, 1)
+	h := height / 2
+	length := math.Pi*radius + height
+
+	var rows []latheRow
+	for r := 0; r <= rings; r++ {
+		theta := math.Pi * (1 - float64(r)/float64(rings)/2)
+		rows = append(rows, latheRow{
+			radius:  radius * math.Sin(theta),
+			y:       radius*math.Cos(theta) - h,
+			normalR: math.Sin(theta),
+			normalY: math.Cos(theta),
+			v:       radius * (math.Pi - theta) / length,
+		})
+	}
+	for r := 0; r <= rings; r++ {
+		theta := math.Pi / 2 * (1 - float64(r)/float64(rings))
+		rows = append(rows, latheRow{
+			radius:  radius * math.Sin(theta),
+			y:       radius*math.Cos(theta) + h,
+			normalR: math.Sin(theta),
+			normalY: math.Cos(theta),
+			v:       (radius*(math.Pi-theta) + height) / length,
+		})
+	}
+	b.lathe(rows, 2*rings+2)
+	return finish(b)
+}
+
+func atLeast(n, min int) int {
+	if n < min {
+		return min
+	}
+	return n
+}
+
+func finish(b *builder) *model.Object {
+	o := b.object()
+	ComputeTangents(o)
+	return o
+}
+
+// grid adds a patch spanned by u and v starting at origin, facing u x v
+func (b *builder) grid(origin, u, v util.Vector3, n int) {
+	normal := u.CrossProduct(v).Normalize()
+	first := len(b.vertices)
+	for j := 0; j <= n; j++ {
+		for i := 0; i <= n; i++ {
+			s, t := float64(i)/float64(n), float64(j)/float64(n)
+			b.point(origin.Add(u.Scale(s)).Add(v.Scale(t)), normal, s, t)
+		}
+	}
+
+	at := func(i, j int) int {
+		return first + j*(n+1) + i
+	}
+	for j := 0; j < n; j++ {
+		for i := 0; i < n; i++ {
+			b.quad(at(i, j), at(i+1, j), at(i+1, j+1), at(i, j+1))
+		}
+	}
+}
+
+// latheRow is a ring of a surface of revolution around Y
+type latheRow struct {
+	radius  float64
+	y       float64
+	normalR float64
+	normalY float64
+	v       float64
+}
+
+// lathe sweeps the rows, ordered bottom to top, around the Y axis.
+// Rows of zero radius are poles and only get triangles on one side.
+func (b *builder) lathe(rows []latheRow, segments int) {
+	first := len(b.vertices)
+	for _, row := range rows {
+		for s := 0; s <= segments; s++ {
+			phi := 2 * math.Pi * float64(s) / float64(segments)
+			u := float64(s) / float64(segments)
+			if isPole(row) {
+				// spread the pole over the segment it closes
+				phi += math.Pi / float64(segments)
+				u += 0.5 / float64(segments)
+			}
+			sin, cos := math.Sin(phi), math.Cos(phi)
+			p := util.NewVec3(row.radius*sin, row.y, row.radius*cos)
+			n := util.NewVec3(row.normalR*sin, row.normalY, row.normalR*cos)
+			b.point(p, n, u, row.v)
+		}
+	}
+
+	at := func(r, s int) int {
+		return first + r*(segments+1) + s
+	}
+	for r := 0; r+1 < len(rows); r++ {
+		bottom, top := isPole(rows[r]), isPole(rows[r+1])
+		for s := 0; s < segments; s++ {
+			ll, lr, ur, ul := at(r, s), at(r, s+1), at(r+1, s+1), at(r+1, s)
+			switch {
+			case bottom && top:
+			case bottom:
+				b.triangle(ll, ur, ul)
+			case top:
+				b.triangle(ll, lr, ul)
+			default:
+				b.quad(ll, lr, ur, ul)
+			}
+		}
+	}
+}
+
+// disc adds a flat cap at height y facing up or down
+func (b *builder) disc(y, radius float64, segments int, up bool) {
+	normal := util.NewVec3(0, -1, 0)
+	if up {
+		normal.Y = 1
+	}
+	center := b.point(util.NewVec3(0, y, 0), normal, 0.5, 0.5)
+	for s := 0; s <= segments; s++ {
+		phi := 2 * math.Pi * float64(s) / float64(segments)
+		sin, cos := math.Sin(phi), math.Cos(phi)
+		v := 0.5 + 0.5*cos
+		if up {
+			v = 0.5 - 0.5*cos
+		}
+		b.point(util.NewVec3(radius*sin, y, radius*cos), normal, 0.5+0.5*sin, v)
+	}
+	for s := 0; s < segments; s++ {
+		if up {
+			b.triangle(center, center+1+s, center+2+s)
+		} else {
+			b.triangle(center, center+2+s, center+1+s)
+		}
+	}
+}
+
+// sphereUV returns the equirectangular coordinates of a unit direction
+func sphereUV(d util.Vector3) (u, v float64) {
+	u = math.Atan2(d.X, d.Z) / (2 * math.Pi)
+	if u < 0 {
+		u++
+	}
+	v = 0.5 + math.Asin(math.Max(-1, math.Min(1, d.Y)))/math.Pi
+	return
+}
+
+func isPole(row latheRow) bool {
+	return math.Abs(row.radius) < 1e-12
+}
@@ -0,0 +1,126 @@
+package mesh
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/util"
+)
+
+var primitiveTests = []struct {
+	Name   string
+	Object *model.Object
+	Closed bool
+	Convex bool
+}{
+	{"plane", Plane(2, 4), false, false},
+	{"cube", Cube(2, 3), true, true},
+	{"uvsphere", UVSphere(1, 8), true, true},
+	{"icosphere", Icosphere(1, 2), true, true},
+	{"cylinder", Cylinder(1, 2, 12), true, true},
+	{"cone", Cone(1, 2, 12), true, true},
+	{"torus", Torus(1, 0.25, 8), true, false},
+	{"capsule", Capsule(0.5, 1, 6), true, true},
+}
+
+// positionKey rounds a vertex so that duplicated seam vertices compare equal
+func positionKey(v *model.Vertex) [3]int64 {
+	return [3]int64{int64(math.Round(v.X * 1e6)), int64(math.Round(v.Y * 1e6)), int64(math.Round(v.Z * 1e6))}
+}
+
+func TestPrimitives(t *testing.T) {
+	for _, test := range primitiveTests {
+		t.Run(test.Name, func(t *testing.T) {
+			o := test.Object
+			if len(o.Faces) == 0 {
+				t.Fatalf("no faces")
+			}
+			if len(o.Tangents) != len(o.Normals) {
+				t.Errorf("got %d tangents for %d normals", len(o.Tangents), len(o.Normals))
+			}
+
+			for i, f := range o.Faces {
+				if f.Index != int64(i+1) {
+					t.Fatalf("face %d has index %d, expected 1-based indices", i, f.Index)
+				}
+			}
+
+			edges := make(map[[2][3]int64]int)
+			for _, f := range o.Faces {
+				if len(f.Points) != 3 {
+					t.Fatalf("face %d has %d points", f.Index, len(f.Points))
+				}
+				for _, p := range f.Points {
+					if p.Vertex == nil || p.Normal == nil || p.Texture == nil {
+						t.Fatalf("face %d has an incomplete point %v", f.Index, p)
+					}
+					n := util.NewVec3(p.Normal.X, p.Normal.Y, p.Normal.Z)
+					if math.Abs(n.Length()-1) > 1e-9 {
+						t.Errorf("face %d: normal %v is not unit length", f.Index, n)
+					}
+				}
+
+				v0 := util.NewVector3FromVertex(f.Points[0].Vertex)
+				v1 := util.NewVector3FromVertex(f.Points[1].Vertex)
+				v2 := util.NewVector3FromVertex(f.Points[2].Vertex)
+				n := v1.Sub(v0).CrossProduct(v2.Sub(v0))
+				if n.Length() < 1e-12 {
+					t.Errorf("face %d is degenerate", f.Index)
+					continue
+				}
+				if test.Convex {
+					if c := v0.Add(v1).Add(v2); n.DotProduct(c) <= 0 {
+						t.Errorf("face %d is facing inwards", f.Index)
+					}
+				}
+
+				for i := 0; i < 3; i++ {
+					a, b := positionKey(f.Points[i].Vertex), positionKey(f.Points[(i+1)%3].Vertex)
+					edges[[2][3]int64{a, b}]++
+				}
+			}
+
+			if test.Closed {
+				for e, count := range edges {
+					if count != 1 || edges[[2][3]int64{e[1], e[0]}] != 1 {
+						t.Fatalf("edge %v is used %d times, reverse %d times", e, count, edges[[2][3]int64{e[1], e[0]}])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPrimitiveSubdivisions(t *testing.T) {
+	for n := 1; n <= 3; n++ {
+		t.Run(fmt.Sprintf("icosphere(%d)", n), func(t *testing.T) {
+			if got, want := len(Icosphere(1, n).Faces), 20<<(2*uint(n)); got != want {
+				t.Errorf("got %d faces, expected %d", got, want)
+			}
+		})
+		t.Run(fmt.Sprintf("plane(%d)", n), func(t *testing.T) {
+			if got, want := len(Plane(1, n).Faces), 2*n*n; got != want {
+				t.Errorf("got %d faces, expected %d", got, want)
+			}
+		})
+	}
+}
+
+func TestRecomputeNormals(t *testing.T) {
+	o := Icosphere(1, 1)
+	RecomputeNormals(o)
+
+	if len(o.Normals) != len(o.Vertices) {
+		t.Fatalf("got %d normals for %d vertices", len(o.Normals), len(o.Vertices))
+	}
+	for _, f := range o.Faces {
+		for _, p := range f.Points {
+			v := util.NewVector3FromVertex(p.Vertex)
+			n := util.NewVec3(p.Normal.X, p.Normal.Y, p.Normal.Z)
+			if n.DotProduct(v) < 0.9 {
+				t.Errorf("normal %v of vertex %v points away from the surface", n, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package mesh
+
+import (
+	"math"
+	"sync"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/util"
+)
+
+// ScalarField holds values at the nodes of a regular grid, node i, j, k is
+// at Origin + Size*(i, j, k)
+type ScalarField struct {
+	Origin util.Vector3
+	Size   float64
+	Nx     int
+	Ny     int
+	Nz     int
+	Values []float64
+}
+
+// NewScalarField returns a field of nx*ny*nz nodes, all zero
+func NewScalarField(origin util.Vector3, size float64, nx, ny, nz int) *ScalarField {
+	return &ScalarField{
+		Origin: origin,
+		Size:   size,
+		Nx:     nx,
+		Ny:     ny,
+		Nz:     nz,
+		Values: make([]float64, nx*ny*nz),
+	}
+}
+
+// SampleField evaluates f on a grid covering min to max with resolution
+// cells along the longest side, e.g. to model implicit surfaces
+func SampleField(min, max util.Vector3, resolution int,
+	f func(p util.Vector3) float64) *ScalarField {
+	field := newFieldForBounds(min, max, resolution, 0)
+	for k := 0; k < field.Nz; k++ {
+		for j := 0; j < field.Ny; j++ {
+			for i := 0; i < field.Nx; i++ {
+				field.Set(i, j, k, f(field.Position(i, j, k)))
+			}
+		}
+	}
+	return field
+}
+
+func newFieldForBounds(min, max util.Vector3, resolution int, padding float64) *ScalarField {
+	min = min.Sub(util.NewVec3(padding, padding, padding))
+	max = max.Add(util.NewVec3(padding, padding, padding))
+	extent := max.Sub(min)
+	size := math.Max(extent.X, math.Max(extent.Y, extent.Z)) / float64(atLeast(resolution, 1))
+	if size == 0 {
+		size = 1
+	}
+	nodes := func(e float64) int {
+		return atLeast(int(math.Ceil(e/size-1e-9)), 1) + 1
+	}
+	return NewScalarField(min, size, nodes(extent.X), nodes(extent.Y), nodes(extent.Z))
+}
+
+func (f *ScalarField) index(i, j, k int) int {
+	return (k*f.Ny+j)*f.Nx + i
+}
+
+// At returns the value of a node
+func (f *ScalarField) At(i, j, k int) float64 {
+	return f.Values[f.index(i, j, k)]
+}
+
+// Set changes the value of a node
+func (f *ScalarField) Set(i, j, k int, v float64) {
+	f.Values[f.index(i, j, k)] = v
+}
+
+// Position returns the position of a node
+func (f *ScalarField) Position(i, j, k int) util.Vector3 {
+	return f.Origin.Add(util.NewVec3(float64(i), float64(j), float64(k)).Scale(f.Size))
+}
+
+// gradient returns the central difference gradient at a node
+func (f *ScalarField) gradient(i, j, k int) util.Vector3 {
+	diff := func(a, n int, at func(x int) float64) float64 {
+		lo, hi := a-1, a+1
+		if lo < 0 {
+			lo = a
+		}
+		if hi >= n {
+			hi = a
+		}
+		if lo == hi {
+			return 0
+		}
+		return (at(hi) - at(lo)) / float64(hi-lo)
+	}
+	return util.NewVec3(
+		diff(i, f.Nx, func(x int) float64 { return f.At(x, j, k) }),
+		diff(j, f.Ny, func(y int) float64 { return f.At(i, y, k) }),
+		diff(k, f.Nz, func(z int) float64 { return f.At(i, j, z) }),
+	)
+}
+
+// SignedDistanceField returns the distance from every node to the closest
+// triangle of a closed object, negative inside. The grid has resolution
+// cells along the longest side of the bounding box grown by padding.
+// Distances are computed exactly, which costs nodes*triangles in the worst
+// case.
+func SignedDistanceField(o *model.Object, resolution int, padding float64) *ScalarField {
+	ps := Positions(o)
+	tris := triangles(o)
+	min, max := bounds(ps)
+	f := newFieldForBounds(min, max, resolution, padding)
+
+	type sphere struct {
+		center util.Vector3
+		radius float64
+	}
+	spheres := make([]sphere, len(tris))
+	for i, t := range tris {
+		a, b, c := ps[t.c[0].v], ps[t.c[1].v], ps[t.c[2].v]
+		center := a.Add(b).Add(c).Scale(1.0 / 3)
+		r := math.Max(a.Sub(center).Length(), math.Max(b.Sub(center).Length(), c.Sub(center).Length()))
+		spheres[i] = sphere{center, r}
+	}
+
+	last := 0
+	for k := 0; k < f.Nz; k++ {
+		for j := 0; j < f.Ny; j++ {
+			for i := 0; i < f.Nx; i++ {
+				p := f.Position(i, j, k)
+				best := math.Inf(1)
+				// start with the closest triangle of the previous node
+				order := func(n int) int {
+					if n == 0 {
+						return last
+					}
+					if n <= last {
+						return n - 1
+					}
+					return n
+				}
+				for n := range tris {
+					ti := order(n)
+					s := spheres[ti]
+					if d := p.Sub(s.center).Length() - s.radius; d >= best {
+						continue
+					}
+					t := tris[ti]
+					a, b, c := ps[t.c[0].v], ps[t.c[1].v], ps[t.c[2].v]
+					w := closestBarycentric(p, a, b, c)
+					q := a.Scale(w.X).Add(b.Scale(w.Y)).Add(c.Scale(w.Z))
+					if d := q.Sub(p).Length(); d < best {
+						best = d
+						last = ti
+					}
+				}
+				f.Set(i, j, k, best)
+			}
+		}
+	}
+
+	// nodes inside by the winding rule get a negative sign
+	columns := columnCrossings(ps, tris, f.Origin, f.Size, f.Ny, f.Nz, 0)
+	for key, cs := range columns {
+		for _, span := range insideSpans(cs, FillWinding) {
+			first := int(math.Ceil((span[0] - f.Origin.X) / f.Size))
+			end := int(math.Floor((span[1] - f.Origin.X) / f.Size))
+			for i := first; i <= end; i++ {
+				if i >= 0 && i < f.Nx {
+					f.Set(i, key[0], key[1], -math.Abs(f.At(i, key[0], key[1])))
+				}
+			}
+		}
+	}
+
+	return f
+}
+
+// MarchingCubes extracts the surface where the field equals iso. Values
+// below iso are inside, faces are counter-clockwise seen from outside and
+// normals follow the field gradient. With a signed distance field, an iso
+// above zero gives an offset (thickened) surface.
+func MarchingCubes(f *ScalarField, iso float64) *model.Object {
+	b := &builder{name: "isosurface"}
+	edgeVertex := make(map[[2]int]int)
+
+	// vertex on the grid edge from node (i, j, k) along axis
+	vertex := func(i, j, k, axis int) int {
+		key := [2]int{f.index(i, j, k), axis}
+		if id, ok := edgeVertex[key]; ok {
+			return id
+		}
+		i2, j2, k2 := i, j, k
+		switch axis {
+		case 0:
+			i2++
+		case 1:
+			j2++
+		default:
+			k2++
+		}
+		v0, v1 := f.At(i, j, k), f.At(i2, j2, k2)
+		t := 0.5
+		if v1 != v0 {
+			t = (iso - v0) / (v1 - v0)
+		}
+		p0, p1 := f.Position(i, j, k), f.Position(i2, j2, k2)
+		g0, g1 := f.gradient(i, j, k), f.gradient(i2, j2, k2)
+		id := b.vertex(p0.Add(p1.Sub(p0).Scale(t)))
+		b.normal(g0.Add(g1.Sub(g0).Scale(t)).Normalize())
+		edgeVertex[key] = id
+		return id
+	}
+
+	table := marchingCubesTable()
+	for k := 0; k+1 < f.Nz; k++ {
+		for j := 0; j+1 < f.Ny; j++ {
+			for i := 0; i+1 < f.Nx; i++ {
+				config := 0
+				for c := 0; c < 8; c++ {
+					if f.At(i+c&1, j+(c>>1)&1, k+(c>>2)&1) < iso {
+						config |= 1 << uint(c)
+					}
+				}
+				for _, tri := range table[config] {
+					var cs [3]corner
+					for n, e := range tri {
+						a := mcEdges[e][0]
+						axis := mcEdges[e][2]
+						id := vertex(i+a&1, j+(a>>1)&1, k+(a>>2)&1, axis)
+						cs[n] = corner{v: id, vt: -1, vn: id}
+					}
+					b.face(cs[:]...)
+				}
+			}
+		}
+	}
+
+	return b.object()
+}
+
+// mcEdges lists the cube edges as first corner, second corner and axis.
+// Corner c sits at offset (c&1, c>>1&1, c>>2&1).
+var mcEdges = [12][3]int{
+	{0, 1, 0}, {2, 3, 0}, {4, 5, 0}, {6, 7, 0},
+	{0, 2, 1}, {1, 3, 1}, {4, 6, 1}, {5, 7, 1},
+	{0, 4, 2}, {1, 5, 2}, {2, 6, 2}, {3, 7, 2},
+}
+
+// mcFaces lists the corners of every cube face counter-clockwise seen from
+// outside the cube
+var mcFaces = [6][4]int{
+	{0, 4, 6, 2}, // -X
+	{1, 3, 7, 5}, // +X
+	{0, 1, 5, 4}, // -Y
+	{2, 6, 7, 3}, // +Y
+	{0, 2, 3, 1}, // -Z
+	{4, 5, 7, 6}, // +Z
+}
+
+var (
+	mcTableOnce sync.Once
+	mcTable     [][][3]int
+)
+
+// marchingCubesTable returns the triangles of all 256 corner configurations,
+// built once for all callers
+func marchingCubesTable() [][][3]int {
+	mcTableOnce.Do(func() {
+		mcTable = buildMarchingCubesTable()
+	})
+	return mcTable
+}
+
+// buildMarchingCubesTable builds the triangles of all 256 corner
+// configurations instead of spelling out the classic table. Every face
+// connects the edge crossings around its inside corners, diagonal faces
+// keep the inside corners apart, so neighbouring cubes always agree and the
+// surface is closed. The loops are then fanned and oriented away from the
+// inside.
+func buildMarchingCubesTable() [][][3]int {
+	edgeOf := func(a, b int) int {
+		for e, edge := range mcEdges {
+			if (edge[0] == a && edge[1] == b) || (edge[0] == b && edge[1] == a) {
+				return e
+			}
+		}
+		return -1
+	}
+	cornerPos := func(c int) util.Vector3 {
+		return util.NewVec3(float64(c&1), float64(c>>1&1), float64(c>>2&1))
+	}
+	edgeMid := func(e int) util.Vector3 {
+		return cornerPos(mcEdges[e][0]).Add(cornerPos(mcEdges[e][1])).Scale(0.5)
+	}
+
+	table := make([][][3]int, 256)
+	for config := 0; config < 256; config++ {
+		inside := func(c int) bool { return config&(1<<uint(c)) != 0 }
+
+		// neighbours of every crossed edge through the faces
+		links := make(map[int][]int)
+		for _, face := range mcFaces {
+			var crossed []int
+			for n := 0; n < 4; n++ {
+				a, b := face[n], face[(n+1)%4]
+				if inside(a) != inside(b) {
+					crossed = append(crossed, edgeOf(a, b))
+				}
+			}
+			switch len(crossed) {
+			case 2:
+				links[crossed[0]] = append(links[crossed[0]], crossed[1])
+				links[crossed[1]] = append(links[crossed[1]], crossed[0])
+			case 4:
+				// pair the two edges next to each inside corner
+				for n := 0; n < 4; n++ {
+					if !inside(face[n]) {
+						continue
+					}
+					e1 := edgeOf(face[(n+3)%4], face[n])
+					e2 := edgeOf(face[n], face[(n+1)%4])
+					links[e1] = append(links[e1], e2)
+					links[e2] = append(links[e2], e1)
+				}
+			}
+		}
+
+		visited := make(map[int]bool)
+		for e := 0; e < 12; e++ {
+			if _, ok := links[e]; !ok || visited[e] {
+				continue
+			}
+			loop := []int{e}
+			visited[e] = true
+			prev, cur := -1, e
+			for {
+				next := -1
+				for _, n := range links[cur] {
+					if n != prev && !visited[n] {
+						next = n
+						break
+					}
+				}
+				if next < 0 {
+					break
+				}
+				visited[next] = true
+				loop = append(loop, next)
+				prev, cur = cur, next
+			}
+
+			// orient the loop so its normal points away from the inside
+			// corners of its edges
+			var normal, center, in util.Vector3
+			for n := range loop {
+				a, b := edgeMid(loop[n]), edgeMid(loop[(n+1)%len(loop)])
+				normal = normal.Add(a.CrossProduct(b))
+				center = center.Add(a)
+				c0, c1 := mcEdges[loop[n]][0], mcEdges[loop[n]][1]
+				if inside(c0) {
+					in = in.Add(cornerPos(c0))
+				} else {
+					in = in.Add(cornerPos(c1))
+				}
+			}
+			center = center.Scale(1 / float64(len(loop)))
+			in = in.Scale(1 / float64(len(loop)))
+			if in.Sub(center).DotProduct(normal) > 0 {
+				for l, r := 0, len(loop)-1; l < r; l, r = l+1, r-1 {
+					loop[l], loop[r] = loop[r], loop[l]
+				}
+			}
+
+			for n := 1; n+1 < len(loop); n++ {
+				table[config] = append(table[config], [3]int{loop[0], loop[n], loop[n+1]})
+			}
+		}
+	}
+
+	return table
+}
@@ -0,0 +1,92 @@
+package mesh
+
+import (
+	"math"
+	"testing"
+	"tinyrender-golang/util"
+)
+
+func TestSignedDistanceField(t *testing.T) {
+	f := SignedDistanceField(Icosphere(1, 3), 16, 0.5)
+	for k := 0; k < f.Nz; k++ {
+		for j := 0; j < f.Ny; j++ {
+			for i := 0; i < f.Nx; i++ {
+				p := f.Position(i, j, k)
+				if got, want := f.At(i, j, k), p.Length()-1; math.Abs(got-want) > 0.03 {
+					t.Fatalf("distance at %v is %f, expected %f", p, got, want)
+				}
+			}
+		}
+	}
+
+	o := MarchingCubes(f, 0)
+	watertight(t, o)
+	if v, want := volume(o), 4*math.Pi/3; math.Abs(v-want) > 0.05*want {
+		t.Errorf("got volume %f, expected about %f", v, want)
+	}
+
+	thick := MarchingCubes(f, 0.25)
+	watertight(t, thick)
+	if v, want := volume(thick), 4*math.Pi/3*math.Pow(1.25, 3); math.Abs(v-want) > 0.05*want {
+		t.Errorf("got offset volume %f, expected about %f", v, want)
+	}
+}
+
+func TestMarchingCubes(t *testing.T) {
+	// two overlapping spheres exercise the ambiguous cases
+	f := SampleField(util.NewVec3(-2, -1.5, -1.5), util.NewVec3(2, 1.5, 1.5), 23, func(p util.Vector3) float64 {
+		a := p.Sub(util.NewVec3(-0.6, 0, 0)).Length() - 0.9
+		b := p.Sub(util.NewVec3(0.7, 0.1, 0)).Length() - 0.8
+		return math.Min(a, b)
+	})
+	o := MarchingCubes(f, 0)
+	watertight(t, o)
+	if volume(o) <= 0 {
+		t.Errorf("got volume %f, faces point inwards", volume(o))
+	}
+
+	ps := Positions(o)
+	for i, n := range o.Normals {
+		if got := (util.Vector3{X: n.X, Y: n.Y, Z: n.Z}).Length(); math.Abs(got-1) > 1e-9 {
+			t.Fatalf("normal %d has length %f", i, got)
+		}
+	}
+	if len(ps) != len(o.Normals) {
+		t.Errorf("got %d normals for %d vertices", len(o.Normals), len(ps))
+	}
+
+	// random fields hit every configuration, the result must stay closed
+	seed := uint32(1)
+	random := SampleField(util.Vector3{}, util.NewVec3(1, 1, 1), 12, func(util.Vector3) float64 {
+		seed = seed*1664525 + 1013904223
+		return float64(seed>>8)/float64(1<<24) - 0.5
+	})
+	for k := 0; k < random.Nz; k++ {
+		for j := 0; j < random.Ny; j++ {
+			for i := 0; i < random.Nx; i++ {
+				if i == 0 || j == 0 || k == 0 || i == random.Nx-1 || j == random.Ny-1 || k == random.Nz-1 {
+					random.Set(i, j, k, 1)
+				}
+			}
+		}
+	}
+	watertight(t, MarchingCubes(random, 0))
+}
+
+func TestMarchingCubesConcurrently(t *testing.T) {
+	// the first calls race to build the configuration table, run with -race
+	f := SignedDistanceField(Icosphere(1, 2), 8, 0.5)
+
+	done := make(chan int)
+	for i := 0; i < 4; i++ {
+		go func() {
+			done <- len(MarchingCubes(f, 0).Faces)
+		}()
+	}
+	want := <-done
+	for i := 1; i < 4; i++ {
+		if got := <-done; got != want {
+			t.Errorf("got %d faces, expected %d", got, want)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package mesh
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/util"
+)
+
+// ErrInvalidRig is wrapped by the errors about malformed rigs
+var ErrInvalidRig = errors.New("mesh: invalid rig")
+
+// Rig is a bone hierarchy with the vertex weights binding an object to it.
+// It is stored as JSON next to the OBJ file:
+//
+//	{
+//	  "bones": [
+//	    {"name": "hip", "bind": [1,0,0,0, 0,1,0,0, 0,0,1,0, 0,0,0,1]},
+//	    {"name": "knee", "parent": "hip", "bind": [1,0,0,0, 0,1,0,-1, 0,0,1,0, 0,0,0,1]}
+//	  ],
+//	  "weights": [
+//	    {"vertex": 0, "influences": {"hip": 0.25, "knee": 0.75}}
+//	  ]
+//	}
+//
+// Bind matrices are row major and place the bone in model space when the
+// object is in its rest shape. Vertices are indices into Object.Vertices
+// starting at 0. Weights are normalized when skinning, vertices without
+// weights do not move.
+type Rig struct {
+	Bones   []Bone          `json:"bones"`
+	Weights []VertexWeights `json:"weights"`
+}
+
+// Bone is a joint of a rig, bones without a parent are roots
+type Bone struct {
+	Name   string      `json:"name"`
+	Parent string      `json:"parent,omitempty"`
+	Bind   [16]float64 `json:"bind"`
+}
+
+// VertexWeights binds a vertex to bones by name
+type VertexWeights struct {
+	Vertex     int                `json:"vertex"`
+	Influences map[string]float64 `json:"influences"`
+}
+
+// Pose holds the transform of bones relative to their parent, or to model
+// space for roots, keyed by bone name. Bones missing from a pose keep
+// their bind transform relative to the parent.
+type Pose map[string]*util.Matrix
+
+// ReadRig decodes and validates a rig
+func ReadRig(r io.Reader) (*Rig, error) {
+	var rig Rig
+	if err := json.NewDecoder(r).Decode(&rig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRig, err)
+	}
+	if err := rig.Validate(); err != nil {
+		return nil, err
+	}
+	return &rig, nil
+}
+
+// LoadRig reads a rig from a JSON file
+func LoadRig(path string) (*Rig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadRig(f)
+}
+
+// Write encodes the rig as indented JSON
+func (r *Rig) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Validate checks that bone names are unique, parents exist without
+// forming cycles, bind matrices can be inverted and weights refer to
+// bones and are not negative
+func (r *Rig) Validate() error {
+	bones := make(map[string]int, len(r.Bones))
+	for i, b := range r.Bones {
+		if _, ok := bones[b.Name]; ok {
+			return fmt.Errorf("%w: bone %q is defined twice", ErrInvalidRig, b.Name)
+		}
+		bones[b.Name] = i
+		if _, ok := bindMatrix(b.Bind).Inverse(); !ok {
+			return fmt.Errorf("%w: bind matrix of bone %q is singular", ErrInvalidRig, b.Name)
+		}
+	}
+	for _, b := range r.Bones {
+		seen := map[string]bool{b.Name: true}
+		for p := b.Parent; p != ""; p = r.Bones[bones[p]].Parent {
+			if _, ok := bones[p]; !ok {
+				return fmt.Errorf("%w: parent %q of bone %q does not exist", ErrInvalidRig, p, b.Name)
+			}
+			if seen[p] {
+				return fmt.Errorf("%w: bone %q is its own ancestor", ErrInvalidRig, b.Name)
+			}
+			seen[p] = true
+		}
+	}
+	for _, w := range r.Weights {
+		if w.Vertex < 0 {
+			return fmt.Errorf("%w: negative vertex index %d", ErrInvalidRig, w.Vertex)
+		}
+		for name, v := range w.Influences {
+			if _, ok := bones[name]; !ok {
+				return fmt.Errorf("%w: vertex %d refers to unknown bone %q", ErrInvalidRig, w.Vertex, name)
+			}
+			if v < 0 {
+				return fmt.Errorf("%w: vertex %d has a negative weight for bone %q", ErrInvalidRig, w.Vertex, name)
+			}
+		}
+	}
+	return nil
+}
+
+func bindMatrix(m [16]float64) *util.Matrix {
+	return util.NewFromSlice([][]float64{
+		{m[0], m[1], m[2], m[3]},
+		{m[4], m[5], m[6], m[7]},
+		{m[8], m[9], m[10], m[11]},
+		{m[12], m[13], m[14], m[15]},
+	})
+}
+
+// Skin returns a copy of the object deformed by the pose with linear blend
+// skinning. Normals follow the bones of the first vertex using them through
+// the inverse transpose, so scaling keeps them perpendicular, and are
+// re-normalized. Tangents are recomputed if the object has them.
+func (r *Rig) Skin(o *model.Object, pose Pose) (*model.Object, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	for name, m := range pose {
+		if !r.hasBone(name) {
+			return nil, fmt.Errorf("%w: pose refers to unknown bone %q", ErrInvalidRig, name)
+		}
+		if m == nil || m.Row != 4 || m.Col != 4 {
+			return nil, fmt.Errorf("%w: pose of bone %q is not a 4x4 matrix", ErrInvalidRig, name)
+		}
+	}
+
+	skinning := r.skinningMatrices(pose)
+	blended := make([]*util.Matrix, len(o.Vertices))
+	for _, w := range r.Weights {
+		if w.Vertex >= len(o.Vertices) {
+			return nil, fmt.Errorf("%w: vertex %d is out of range", ErrInvalidRig, w.Vertex)
+		}
+
+		names := make([]string, 0, len(w.Influences))
+		var total float64
+		for name, v := range w.Influences {
+			names = append(names, name)
+			total += v
+		}
+		if total == 0 {
+			continue
+		}
+		sort.Strings(names)
+
+		m := util.NewEmpty(4, 4)
+		for _, name := range names {
+			s := skinning[name]
+			f := w.Influences[name] / total
+			for i := 0; i < 4; i++ {
+				for j := 0; j < 4; j++ {
+					m.Data[i][j] += f * s.Data[i][j]
+				}
+			}
+		}
+		blended[w.Vertex] = m
+	}
+
+	out := clone(o)
+	for i, m := range blended {
+		if m == nil {
+			continue
+		}
+		v := &out.Vertices[i]
+		p := m.Mul(util.NewFromVector3(util.NewVector3FromVertex(v))).ToVector3()
+		v.X, v.Y, v.Z = p.X, p.Y, p.Z
+	}
+
+	// every normal follows the first vertex it is used with
+	normalVertex := make([]int, len(o.Normals))
+	for i := range normalVertex {
+		normalVertex[i] = -1
+	}
+	res := newResolver(o)
+	for _, f := range o.Faces {
+		for _, p := range f.Points {
+			if c := res.corner(p); c.vn >= 0 && c.v >= 0 && normalVertex[c.vn] < 0 {
+				normalVertex[c.vn] = c.v
+			}
+		}
+	}
+	for i, v := range normalVertex {
+		if v < 0 || blended[v] == nil {
+			continue
+		}
+		// normals follow the inverse transpose, the cofactors differ from
+		// it by the determinant, whose sign keeps mirrored normals outside
+		m, det := cofactors(blended[v].Data)
+		n := &out.Normals[i]
+		t := util.NewVec3(
+			m[0][0]*n.X+m[0][1]*n.Y+m[0][2]*n.Z,
+			m[1][0]*n.X+m[1][1]*n.Y+m[1][2]*n.Z,
+			m[2][0]*n.X+m[2][1]*n.Y+m[2][2]*n.Z,
+		)
+		if det < 0 {
+			t = t.Scale(-1)
+		}
+		if t.Length() > 1e-12 {
+			t = t.Normalize()
+			n.X, n.Y, n.Z = t.X, t.Y, t.Z
+		}
+	}
+
+	if len(out.Tangents) > 0 {
+		ComputeTangents(out)
+	}
+	return out, nil
+}
+
+// cofactors returns the cofactor matrix of the upper left 3x3 of m and its
+// determinant
+func cofactors(m [][]float64) (c [3][3]float64, det float64) {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			i1, i2, j1, j2 := (i+1)%3, (i+2)%3, (j+1)%3, (j+2)%3
+			c[i][j] = m[i1][j1]*m[i2][j2] - m[i1][j2]*m[i2][j1]
+		}
+	}
+	det = m[0][0]*c[0][0] + m[0][1]*c[0][1] + m[0][2]*c[0][2]
+	return
+}
+
+func (r *Rig) hasBone(name string) bool {
+	for _, b := range r.Bones {
+		if b.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// skinningMatrices returns the posed model space transform of every bone
+// times its inverse bind matrix, which moves rest vertices along with it
+func (r *Rig) skinningMatrices(pose Pose) map[string]*util.Matrix {
+	index := make(map[string]int, len(r.Bones))
+	for i, b := range r.Bones {
+		index[b.Name] = i
+	}
+
+	world := make(map[string]*util.Matrix, len(r.Bones))
+	var posed func(b Bone) *util.Matrix
+	posed = func(b Bone) *util.Matrix {
+		if m, ok := world[b.Name]; ok {
+			return m
+		}
+		bind := bindMatrix(b.Bind)
+		local, ok := pose[b.Name]
+		if !ok {
+			local = bind
+			if b.Parent != "" {
+				parentInv, _ := bindMatrix(r.Bones[index[b.Parent]].Bind).Inverse()
+				local = parentInv.Mul(bind)
+			}
+		}
+		m := local
+		if b.Parent != "" {
+			m = posed(r.Bones[index[b.Parent]]).Mul(local)
+		}
+		world[b.Name] = m
+		return m
+	}
+
+	skinning := make(map[string]*util.Matrix, len(r.Bones))
+	for _, b := range r.Bones {
+		inv, _ := bindMatrix(b.Bind).Inverse()
+		skinning[b.Name] = posed(b).Mul(inv)
+	}
+	return skinning
+}
@@ -0,0 +1,139 @@
+package mesh
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"tinyrender-golang/util"
+)
+
+// legRig has a hip at the origin and a knee one unit above it
+func legRig() *Rig {
+	identity := [16]float64{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+	knee := identity
+	knee[7] = 1
+	return &Rig{Bones: []Bone{{Name: "hip", Bind: identity}, {Name: "knee", Parent: "hip", Bind: knee}}}
+}
+
+func TestSkin(t *testing.T) {
+	o := translate(Cylinder(0.1, 2, 8), util.NewVec3(0, 1, 0))
+	rig := legRig()
+	pose := Pose{"knee": util.NewTranslation(util.NewVec3(0, 1, 0)).Mul(util.NewRotation(util.NewVec3(0, 0, 1), math.Pi/2))}
+	for i, v := range o.Vertices {
+		w := VertexWeights{Vertex: i, Influences: map[string]float64{"hip": 1}}
+		if v.Y > 1.5 {
+			w.Influences = map[string]float64{"knee": 2}
+		} else if v.Y > 0.5 {
+			w.Influences = map[string]float64{"hip": 1, "knee": 1}
+		}
+		rig.Weights = append(rig.Weights, w)
+	}
+
+	var buf bytes.Buffer
+	if err := rig.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rig, err := ReadRig(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rest, err := rig.Skin(o, Pose{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range o.Vertices {
+		a, b := util.NewVector3FromVertex(&o.Vertices[i]), util.NewVector3FromVertex(&rest.Vertices[i])
+		if a.Sub(b).Length() > 1e-12 {
+			t.Fatalf("vertex %d moves in the rest pose", i)
+		}
+	}
+
+	bent, err := rig.Skin(o, pose)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range o.Vertices {
+		p := util.NewVector3FromVertex(&bent.Vertices[i])
+		switch {
+		case v.Y > 1.5:
+			// a quarter turn around the knee
+			want := util.NewVec3(-(v.Y - 1), 1+v.X, v.Z)
+			if p.Sub(want).Length() > 1e-9 {
+				t.Fatalf("vertex %d is at %v, expected %v", i, p, want)
+			}
+		case v.Y < 0.5:
+			if p.Sub(util.NewVector3FromVertex(&v)).Length() > 1e-12 {
+				t.Fatalf("vertex %d below the knee moves", i)
+			}
+		}
+	}
+	for i, n := range bent.Normals {
+		if l := math.Sqrt(n.X*n.X + n.Y*n.Y + n.Z*n.Z); math.Abs(l-1) > 1e-9 {
+			t.Fatalf("normal %d has length %f", i, l)
+		}
+	}
+	// the top cap faces +Y in the rest shape and -X when bent
+	for i, n := range o.Normals {
+		if n.Y == 1 && math.Abs(bent.Normals[i].X+1) > 1e-9 {
+			t.Fatalf("cap normal %d is %v", i, bent.Normals[i])
+		}
+	}
+
+	if _, err := rig.Skin(o, Pose{"ankle": util.NewIdentity(4)}); !errors.Is(err, ErrInvalidRig) {
+		t.Errorf("got %v for an unknown bone in the pose", err)
+	}
+	if _, err := rig.Skin(o, Pose{"knee": nil}); !errors.Is(err, ErrInvalidRig) {
+		t.Errorf("got %v for a nil matrix in the pose", err)
+	}
+}
+
+func TestSkinScaledNormals(t *testing.T) {
+	// a slanted triangle stretched along X tilts its normal towards Y
+	o := read(t, "v 0 0 0\nv 1 -1 0\nv 0 0 1\nvn 1 1 0\nf 1//1 2//1 3//1\n")
+	identity := [16]float64{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+	rig := &Rig{Bones: []Bone{{Name: "root", Bind: identity}}}
+	for i := range o.Vertices {
+		rig.Weights = append(rig.Weights, VertexWeights{Vertex: i, Influences: map[string]float64{"root": 1}})
+	}
+	scale := util.NewIdentity(4)
+	scale.Data[0][0] = 2
+
+	out, err := rig.Skin(o, Pose{"root": scale})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := out.Normals[0]
+	want := util.NewVec3(1, 2, 0).Normalize()
+	if util.NewVec3(n.X, n.Y, n.Z).Sub(want).Length() > 1e-9 {
+		t.Errorf("normal is %v, expected %v", n, want)
+	}
+}
+
+func TestRigValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"syntax", `{"bones": [`},
+		{"duplicate", `{"bones": [{"name": "a", "bind": [1,0,0,0,0,1,0,0,0,0,1,0,0,0,0,1]}, {"name": "a", "bind": [1,0,0,0,0,1,0,0,0,0,1,0,0,0,0,1]}]}`},
+		{"parent", `{"bones": [{"name": "a", "parent": "b", "bind": [1,0,0,0,0,1,0,0,0,0,1,0,0,0,0,1]}]}`},
+		{"cycle", `{"bones": [{"name": "a", "parent": "b", "bind": [1,0,0,0,0,1,0,0,0,0,1,0,0,0,0,1]}, {"name": "b", "parent": "a", "bind": [1,0,0,0,0,1,0,0,0,0,1,0,0,0,0,1]}]}`},
+		{"singular", `{"bones": [{"name": "a", "bind": [0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0]}]}`},
+		{"bone", `{"bones": [{"name": "a", "bind": [1,0,0,0,0,1,0,0,0,0,1,0,0,0,0,1]}], "weights": [{"vertex": 0, "influences": {"b": 1}}]}`},
+		{"weight", `{"bones": [{"name": "a", "bind": [1,0,0,0,0,1,0,0,0,0,1,0,0,0,0,1]}], "weights": [{"vertex": 0, "influences": {"a": -1}}]}`},
+	}
+	for _, test := range tests {
+		if _, err := ReadRig(strings.NewReader(test.json)); !errors.Is(err, ErrInvalidRig) {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+	}
+
+	rig := legRig()
+	rig.Weights = []VertexWeights{{Vertex: 100, Influences: map[string]float64{"hip": 1}}}
+	if _, err := rig.Skin(Cube(1, 1), Pose{}); !errors.Is(err, ErrInvalidRig) {
+		t.Errorf("got %v for a vertex out of range", err)
+	}
+}
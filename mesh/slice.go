@@ -0,0 +1,367 @@
+package mesh
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/tga"
+	"tinyrender-golang/util"
+)
+
+// Axis selects a coordinate axis
+type Axis int
+
+const (
+	// AxisX is the X axis, slices map Y and Z to the plane
+	AxisX Axis = iota
+	// AxisY is the Y axis, slices map X and -Z to the plane
+	AxisY
+	// AxisZ is the Z axis, slices map X and Y to the plane
+	AxisZ
+)
+
+// A SliceOption is a functional option
+// which updates the slicing settings
+type SliceOption func(c *sliceConfig)
+
+type sliceConfig struct {
+	axis Axis
+}
+
+// WithSliceAxis sets the axis the planes are stacked along, the default is
+// AxisY which is up for the models in this repository
+func WithSliceAxis(axis Axis) SliceOption {
+	return func(c *sliceConfig) {
+		c.axis = axis
+	}
+}
+
+// Contour is a closed polyline in the plane of a layer, the last point
+// connects back to the first one
+type Contour struct {
+	Points [][2]float64
+	// Outer is true for the boundary of an island and false for a hole.
+	// Outer contours run counter-clockwise and holes clockwise.
+	Outer bool
+	// Parent is the index of the closest contour around this one in the
+	// layer, -1 for top level islands
+	Parent int
+}
+
+// Area returns the signed area, positive for outer contours
+func (c *Contour) Area() float64 {
+	var a float64
+	for i, p := range c.Points {
+		q := c.Points[(i+1)%len(c.Points)]
+		a += p[0]*q[1] - q[0]*p[1]
+	}
+	return a / 2
+}
+
+// contains reports whether p lies inside the contour by the even-odd rule
+func (c *Contour) contains(p [2]float64) bool {
+	inside := false
+	for i, a := range c.Points {
+		b := c.Points[(i+1)%len(c.Points)]
+		if (a[1] > p[1]) != (b[1] > p[1]) {
+			x := a[0] + (p[1]-a[1])/(b[1]-a[1])*(b[0]-a[0])
+			if p[0] < x {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+// Layer is the cross-section of an object with one plane
+type Layer struct {
+	Height   float64
+	Contours []Contour
+}
+
+// Slice intersects the object with planes at the given heights along the
+// slicing axis. Vertices lying exactly on a plane count as above it, so
+// every layer consists of closed contours as long as the object is closed.
+// Open meshes give contours which close straight across the gap.
+func Slice(o *model.Object, heights []float64, options ...SliceOption) []Layer {
+	c := sliceConfig{axis: AxisY}
+	for _, opt := range options {
+		opt(&c)
+	}
+
+	g := newWeldedGraph(o)
+	layers := make([]Layer, len(heights))
+	for i, h := range heights {
+		layers[i] = Layer{Height: h, Contours: sliceLayer(g, h, c.axis)}
+	}
+	return layers
+}
+
+// SliceEvery slices the object into layers of the given thickness, the
+// planes run through the middle of every layer
+func SliceEvery(o *model.Object, thickness float64, options ...SliceOption) []Layer {
+	c := sliceConfig{axis: AxisY}
+	for _, opt := range options {
+		opt(&c)
+	}
+
+	ps := Positions(o)
+	if len(ps) == 0 || thickness <= 0 {
+		return nil
+	}
+	min, max := bounds(ps)
+	lo, hi := axisValue(min, c.axis), axisValue(max, c.axis)
+	var heights []float64
+	for h := lo + thickness/2; h < hi; h += thickness {
+		heights = append(heights, h)
+	}
+	return Slice(o, heights, options...)
+}
+
+func axisValue(p util.Vector3, axis Axis) float64 {
+	switch axis {
+	case AxisX:
+		return p.X
+	case AxisZ:
+		return p.Z
+	}
+	return p.Y
+}
+
+// project maps a point to the plane coordinates, u x v always points
+// along the axis so contours keep their orientation
+func project(p util.Vector3, axis Axis) [2]float64 {
+	switch axis {
+	case AxisX:
+		return [2]float64{p.Y, p.Z}
+	case AxisZ:
+		return [2]float64{p.X, p.Y}
+	}
+	return [2]float64{p.X, -p.Z}
+}
+
+type sliceSegment struct {
+	from, to [2]int
+	a, b     [2]float64
+}
+
+func sliceLayer(g *weldedGraph, h float64, axis Axis) []Contour {
+	ps := g.positions
+
+	// crossing of a welded edge, computed from the ordered pair so both
+	// triangles of the edge agree on the point
+	crossing := func(i, j int) ([2]int, [2]float64) {
+		if i > j {
+			i, j = j, i
+		}
+		di, dj := axisValue(ps[i], axis)-h, axisValue(ps[j], axis)-h
+		t := di / (di - dj)
+		return [2]int{i, j}, project(ps[i].Add(ps[j].Sub(ps[i]).Scale(t)), axis)
+	}
+
+	var segments []sliceSegment
+	for _, t := range g.tris {
+		var above [3]bool
+		count := 0
+		for k := 0; k < 3; k++ {
+			above[k] = axisValue(ps[t[k]], axis) >= h
+			if above[k] {
+				count++
+			}
+		}
+		if count == 0 || count == 3 {
+			continue
+		}
+
+		var keys [][2]int
+		var points [][2]float64
+		for k := 0; k < 3; k++ {
+			if above[k] != above[(k+1)%3] {
+				key, p := crossing(t[k], t[(k+1)%3])
+				keys = append(keys, key)
+				points = append(points, p)
+			}
+		}
+
+		// the solid lies left of the segment, against the face normal
+		n := project(ps[t[1]].Sub(ps[t[0]]).CrossProduct(ps[t[2]].Sub(ps[t[0]])), axis)
+		d := [2]float64{points[1][0] - points[0][0], points[1][1] - points[0][1]}
+		s := sliceSegment{from: keys[0], to: keys[1], a: points[0], b: points[1]}
+		if d[1]*n[0]-d[0]*n[1] < 0 {
+			s = sliceSegment{from: keys[1], to: keys[0], a: points[1], b: points[0]}
+		}
+		segments = append(segments, s)
+	}
+
+	starts := make(map[[2]int][]int)
+	ends := make(map[[2]int]bool)
+	for i, s := range segments {
+		starts[s.from] = append(starts[s.from], i)
+		ends[s.to] = true
+	}
+
+	used := make([]bool, len(segments))
+	var contours []Contour
+	follow := func(first int) {
+		var points [][2]float64
+		for cur := first; cur >= 0; {
+			used[cur] = true
+			s := segments[cur]
+			if len(points) == 0 || points[len(points)-1] != s.a {
+				points = append(points, s.a)
+			}
+			cur = -1
+			for _, next := range starts[s.to] {
+				if !used[next] {
+					cur = next
+					break
+				}
+			}
+			if cur < 0 && s.b != points[0] && s.b != points[len(points)-1] {
+				points = append(points, s.b)
+			}
+		}
+		if len(points) >= 3 {
+			contours = append(contours, Contour{Points: points, Parent: -1})
+		}
+	}
+	// open chains first so they are not split in the middle
+	for i, s := range segments {
+		if !used[i] && !ends[s.from] {
+			follow(i)
+		}
+	}
+	for i := range segments {
+		if !used[i] {
+			follow(i)
+		}
+	}
+
+	classify(contours)
+	return contours
+}
+
+// classify sets Outer and Parent from the nesting of the contours and
+// fixes their orientation, so faces with a wrong winding do not turn
+// islands into holes
+func classify(contours []Contour) {
+	areas := make([]float64, len(contours))
+	for i := range contours {
+		areas[i] = math.Abs(contours[i].Area())
+	}
+
+	for i := range contours {
+		depth := 0
+		parent := -1
+		for j := range contours {
+			if i == j || areas[j] <= areas[i] || !contours[j].contains(contours[i].Points[0]) {
+				continue
+			}
+			depth++
+			if parent < 0 || areas[j] < areas[parent] {
+				parent = j
+			}
+		}
+		c := &contours[i]
+		c.Outer = depth%2 == 0
+		c.Parent = parent
+		if (c.Area() > 0) != c.Outer {
+			for l, r := 0, len(c.Points)-1; l < r; l, r = l+1, r-1 {
+				c.Points[l], c.Points[r] = c.Points[r], c.Points[l]
+			}
+		}
+	}
+}
+
+// Bounds returns the corners of the rectangle around all contours
+func (l *Layer) Bounds() (min, max [2]float64) {
+	min = [2]float64{math.Inf(1), math.Inf(1)}
+	max = [2]float64{math.Inf(-1), math.Inf(-1)}
+	for _, c := range l.Contours {
+		for _, p := range c.Points {
+			for k := 0; k < 2; k++ {
+				min[k] = math.Min(min[k], p[k])
+				max[k] = math.Max(max[k], p[k])
+			}
+		}
+	}
+	return min, max
+}
+
+// WriteSVG writes the layer as an SVG document showing the rectangle from
+// min to max, e.g. the bounds of the whole object so all layers line up.
+// Every island is one path together with its holes.
+func (l *Layer) WriteSVG(w io.Writer, min, max [2]float64) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<svg xmlns=\"http://www.w3.org/2000/svg\" viewBox=\"%g %g %g %g\">\n",
+		min[0], -max[1], max[0]-min[0], max[1]-min[1])
+
+	path := func(c *Contour) {
+		for i, p := range c.Points {
+			op := "L"
+			if i == 0 {
+				op = "M"
+			}
+			fmt.Fprintf(bw, "%s%g %g ", op, p[0], -p[1])
+		}
+		bw.WriteString("Z ")
+	}
+
+	// sorted by area, so enclosing islands are drawn first
+	order := make([]int, len(l.Contours))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return l.Contours[order[a]].Area() > l.Contours[order[b]].Area()
+	})
+	for _, i := range order {
+		c := &l.Contours[i]
+		if !c.Outer {
+			continue
+		}
+		bw.WriteString("<path fill=\"#cccccc\" fill-rule=\"evenodd\" stroke=\"#000000\" vector-effect=\"non-scaling-stroke\" d=\"")
+		path(c)
+		for j := range l.Contours {
+			if l.Contours[j].Parent == i {
+				path(&l.Contours[j])
+			}
+		}
+		bw.WriteString("\"/>\n")
+	}
+
+	bw.WriteString("</svg>\n")
+	return bw.Flush()
+}
+
+// Draw draws the contours with DrawLine, fitting the rectangle from min to
+// max into the image. Y grows upwards like in the renderer, so flip the
+// image before saving.
+func (l *Layer) Draw(img *tga.TGA, min, max [2]float64, outer, inner tga.Color) {
+	w, h := img.GetWidth()-1, img.GetHeight()-1
+	if w < 1 || h < 1 {
+		return
+	}
+	scale := math.Min(float64(w)/(max[0]-min[0]), float64(h)/(max[1]-min[1]))
+	if math.IsInf(scale, 0) || math.IsNaN(scale) {
+		return
+	}
+	pixel := func(p [2]float64) util.Point {
+		x := int(math.Round((p[0] - min[0]) * scale))
+		y := int(math.Round((p[1] - min[1]) * scale))
+		return util.Point{X: tga.Max(0, tga.Min(w, x)), Y: tga.Max(0, tga.Min(h, y))}
+	}
+
+	for _, c := range l.Contours {
+		color := inner
+		if c.Outer {
+			color = outer
+		}
+		for i, p := range c.Points {
+			img.DrawLine(pixel(p), pixel(c.Points[(i+1)%len(c.Points)]), color)
+		}
+	}
+}
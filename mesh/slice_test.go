@@ -0,0 +1,101 @@
+package mesh
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"tinyrender-golang/tga"
+)
+
+func TestSlice(t *testing.T) {
+	// a block with a round hole and a small island inside the hole
+	ring := Difference(Cube(1, 1), Cylinder(0.3, 2, 24))
+	o := Union(ring, Cube(0.2, 1))
+
+	layers := Slice(o, []float64{0, 0.05, 0.2, 0.7})
+	if len(layers) != 4 {
+		t.Fatalf("got %d layers, expected 4", len(layers))
+	}
+	if n := len(layers[3].Contours); n != 0 {
+		t.Errorf("got %d contours above the object", n)
+	}
+
+	hole := 24 * 0.3 * 0.3 * math.Sin(2*math.Pi/24) / 2
+	for _, l := range layers[:2] {
+		if len(l.Contours) != 3 {
+			t.Fatalf("height %f: got %d contours, expected 3", l.Height, len(l.Contours))
+		}
+		var areas []float64
+		for i, c := range l.Contours {
+			if c.Outer != (c.Area() > 0) {
+				t.Errorf("height %f: contour %d has the wrong orientation", l.Height, i)
+			}
+			areas = append(areas, c.Area())
+			switch {
+			case math.Abs(c.Area()-1) < 1e-9:
+				if !c.Outer || c.Parent != -1 {
+					t.Errorf("height %f: block is not a top level island", l.Height)
+				}
+			case math.Abs(c.Area()+hole) < 1e-9:
+				if c.Outer || c.Parent < 0 || math.Abs(l.Contours[c.Parent].Area()-1) > 1e-9 {
+					t.Errorf("height %f: hole is not inside the block", l.Height)
+				}
+			case math.Abs(c.Area()-0.04) < 1e-9:
+				if !c.Outer || c.Parent < 0 || l.Contours[c.Parent].Outer {
+					t.Errorf("height %f: island is not inside the hole", l.Height)
+				}
+			default:
+				t.Errorf("height %f: unexpected contour area %f", l.Height, c.Area())
+			}
+		}
+	}
+
+	if n := len(layers[2].Contours); n != 2 {
+		t.Errorf("got %d contours above the island, expected 2", n)
+	}
+
+	if n := len(SliceEvery(o, 0.1)); n != 10 {
+		t.Errorf("got %d layers of 0.1, expected 10", n)
+	}
+	if n := len(SliceEvery(o, 0.25, WithSliceAxis(AxisZ))[0].Contours); n != 1 {
+		t.Errorf("got %d contours across the hole, expected 1", n)
+	}
+}
+
+func TestSliceExport(t *testing.T) {
+	layers := Slice(Difference(Cube(1, 1), Cylinder(0.3, 2, 24)), []float64{0})
+	min, max := layers[0].Bounds()
+	if min != [2]float64{-0.5, -0.5} || max != [2]float64{0.5, 0.5} {
+		t.Errorf("got bounds %v %v", min, max)
+	}
+
+	var buf bytes.Buffer
+	if err := layers[0].WriteSVG(&buf, min, max); err != nil {
+		t.Fatal(err)
+	}
+	svg := buf.String()
+	if strings.Count(svg, "<path") != 1 || strings.Count(svg, "Z") != 2 {
+		t.Errorf("expected one path with two contours, got %s", svg)
+	}
+
+	img := tga.CreateTga(64, 64)
+	white := tga.NewColor(255, 255, 255, 255)
+	red := tga.NewColor(255, 0, 0, 255)
+	layers[0].Draw(img, min, max, white, red)
+	if img.GetPixel(0, 32) != white || img.GetPixel(63, 32) != white {
+		t.Errorf("outer contour is not drawn along the image border")
+	}
+	if img.GetPixel(32, 32) == red {
+		t.Errorf("hole is drawn at the center")
+	}
+	found := false
+	for x := 0; x < 64; x++ {
+		if img.GetPixel(x, 32) == red {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("hole is not drawn")
+	}
+}
@@ -0,0 +1,264 @@
+package mesh
+
+import (
+	"math"
+	"sort"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/util"
+)
+
+// Weighting selects how neighbours contribute to a smoothing step
+type Weighting int
+
+const (
+	// UniformWeights averages all neighbours equally
+	UniformWeights Weighting = iota
+	// CotangentWeights weights neighbours by the cotangents of the angles
+	// opposite to their edge, which keeps the triangles from sliding
+	// across the surface
+	CotangentWeights
+)
+
+// A SmoothOption is a functional option
+// which updates the smoothing settings
+type SmoothOption func(c *smoothConfig)
+
+type smoothConfig struct {
+	iterations  int
+	weighting   Weighting
+	pinBoundary bool
+	selected    bool
+	selection   []int
+}
+
+// WithIterations sets the number of smoothing passes, the default is 1
+func WithIterations(n int) SmoothOption {
+	return func(c *smoothConfig) {
+		c.iterations = n
+	}
+}
+
+// WithWeighting selects the neighbour weights, the default is uniform
+func WithWeighting(w Weighting) SmoothOption {
+	return func(c *smoothConfig) {
+		c.weighting = w
+	}
+}
+
+// WithPinnedBoundary keeps vertices on open edges in place
+func WithPinnedBoundary() SmoothOption {
+	return func(c *smoothConfig) {
+		c.pinBoundary = true
+	}
+}
+
+// WithSelection restricts smoothing to the given indices into
+// Object.Vertices, all other vertices stay in place. An empty selection
+// moves nothing.
+func WithSelection(vertices ...int) SmoothOption {
+	return func(c *smoothConfig) {
+		c.selected = true
+		c.selection = vertices
+	}
+}
+
+// Laplacian moves every vertex by lambda towards the weighted average of
+// its neighbours. Vertices sharing a position move together so seams of
+// split texture coordinates stay closed. Normals are recomputed afterwards.
+func Laplacian(o *model.Object, lambda float64, options ...SmoothOption) {
+	smooth(o, []float64{lambda}, options)
+}
+
+// Taubin alternates a shrinking Laplacian step of lambda with an inflating
+// step of mu, where mu is negative and slightly larger in magnitude than
+// lambda (e.g. 0.5 and -0.53), which smooths without shrinking the mesh.
+func Taubin(o *model.Object, lambda, mu float64, options ...SmoothOption) {
+	smooth(o, []float64{lambda, mu}, options)
+}
+
+func smooth(o *model.Object, steps []float64, options []SmoothOption) {
+	c := smoothConfig{iterations: 1}
+	for _, opt := range options {
+		opt(&c)
+	}
+
+	relink(o)
+	g := newWeldedGraph(o)
+
+	movable := make([]bool, len(g.positions))
+	if !c.selected {
+		for i := range movable {
+			movable[i] = true
+		}
+	} else {
+		for _, v := range c.selection {
+			if v >= 0 && v < len(g.group) {
+				movable[g.group[v]] = true
+			}
+		}
+	}
+	if c.pinBoundary {
+		for i, b := range g.boundary() {
+			movable[i] = movable[i] && !b
+		}
+	}
+
+	ps := g.positions
+	next := make([]util.Vector3, len(ps))
+	for it := 0; it < c.iterations; it++ {
+		for _, step := range steps {
+			weights := g.uniform
+			if c.weighting == CotangentWeights {
+				weights = g.cotangent(ps)
+			}
+			for i, p := range ps {
+				next[i] = p
+				if !movable[i] {
+					continue
+				}
+				var sum util.Vector3
+				var total float64
+				for _, n := range weights[i] {
+					sum = sum.Add(ps[n.j].Scale(n.w))
+					total += n.w
+				}
+				if total > 0 {
+					next[i] = p.Add(sum.Scale(1 / total).Sub(p).Scale(step))
+				}
+			}
+			ps, next = next, ps
+		}
+	}
+
+	for i := range o.Vertices {
+		p := ps[g.group[i]]
+		o.Vertices[i].X, o.Vertices[i].Y, o.Vertices[i].Z = p.X, p.Y, p.Z
+	}
+
+	hadTangents := len(o.Tangents) > 0
+	RecomputeNormals(o)
+	if hadTangents {
+		ComputeTangents(o)
+	}
+}
+
+// weldedGraph is the vertex adjacency of a mesh where vertices at the
+// same position are merged into one group
+type weldedGraph struct {
+	group     []int
+	positions []util.Vector3
+	tris      [][3]int
+	// uniform lists the neighbours of every group sorted by group, so
+	// weighted sums always add up in the same order
+	uniform [][]neighbour
+}
+
+// neighbour is an adjacent group and its weight
+type neighbour struct {
+	j int
+	w float64
+}
+
+func newWeldedGraph(o *model.Object) *weldedGraph {
+	g := &weldedGraph{group: make([]int, len(o.Vertices))}
+	seen := make(map[[3]float64]int)
+	for i, v := range o.Vertices {
+		key := [3]float64{v.X, v.Y, v.Z}
+		id, ok := seen[key]
+		if !ok {
+			id = len(g.positions)
+			seen[key] = id
+			g.positions = append(g.positions, util.NewVector3FromVertex(&o.Vertices[i]))
+		}
+		g.group[i] = id
+	}
+
+	adjacent := make([]map[int]bool, len(g.positions))
+	for i := range adjacent {
+		adjacent[i] = make(map[int]bool)
+	}
+	for _, t := range Triangles(o) {
+		wt := [3]int{g.group[t[0]], g.group[t[1]], g.group[t[2]]}
+		if wt[0] == wt[1] || wt[1] == wt[2] || wt[2] == wt[0] {
+			continue
+		}
+		g.tris = append(g.tris, wt)
+		for k := 0; k < 3; k++ {
+			a, b := wt[k], wt[(k+1)%3]
+			adjacent[a][b] = true
+			adjacent[b][a] = true
+		}
+	}
+
+	g.uniform = make([][]neighbour, len(g.positions))
+	for i, js := range adjacent {
+		for j := range js {
+			g.uniform[i] = append(g.uniform[i], neighbour{j, 1})
+		}
+		sort.Slice(g.uniform[i], func(a, b int) bool {
+			return g.uniform[i][a].j < g.uniform[i][b].j
+		})
+	}
+
+	return g
+}
+
+// boundary reports for every group whether it lies on an edge used by a
+// single triangle
+func (g *weldedGraph) boundary() []bool {
+	count := make(map[[2]int]int)
+	for _, t := range g.tris {
+		for k := 0; k < 3; k++ {
+			a, b := t[k], t[(k+1)%3]
+			if a > b {
+				a, b = b, a
+			}
+			count[[2]int{a, b}]++
+		}
+	}
+
+	out := make([]bool, len(g.positions))
+	for e, n := range count {
+		if n == 1 {
+			out[e[0]] = true
+			out[e[1]] = true
+		}
+	}
+	return out
+}
+
+// cotangent returns the cotangent weights for the current positions,
+// negative weights of obtuse triangles are clamped to zero
+func (g *weldedGraph) cotangent(ps []util.Vector3) [][]neighbour {
+	w := make([][]neighbour, len(ps))
+	for i := range w {
+		w[i] = make([]neighbour, len(g.uniform[i]))
+		for n, u := range g.uniform[i] {
+			w[i][n].j = u.j
+		}
+	}
+	add := func(a, b int, cot float64) {
+		ns := w[a]
+		n := sort.Search(len(ns), func(n int) bool { return ns[n].j >= b })
+		ns[n].w += cot
+	}
+	for _, t := range g.tris {
+		for k := 0; k < 3; k++ {
+			i, a, b := t[k], t[(k+1)%3], t[(k+2)%3]
+			e1, e2 := ps[a].Sub(ps[i]), ps[b].Sub(ps[i])
+			cross := e1.CrossProduct(e2).Length()
+			if cross < 1e-12 {
+				continue
+			}
+			cot := e1.DotProduct(e2) / cross / 2
+			add(a, b, cot)
+			add(b, a, cot)
+		}
+	}
+	for i := range w {
+		for n := range w[i] {
+			w[i][n].w = math.Max(w[i][n].w, 0)
+		}
+	}
+	return w
+}
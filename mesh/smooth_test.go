@@ -0,0 +1,123 @@
+package mesh
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/util"
+)
+
+// noisySphere returns an icosphere with every vertex pushed along its
+// normal by a random amount
+func noisySphere() *model.Object {
+	o := Icosphere(1, 3)
+	r := rand.New(rand.NewSource(1))
+	for i := range o.Vertices {
+		v := &o.Vertices[i]
+		s := 1 + (r.Float64()-0.5)*0.1
+		v.X, v.Y, v.Z = v.X*s, v.Y*s, v.Z*s
+	}
+	return o
+}
+
+// radii returns the mean distance of the vertices from the origin and
+// its standard deviation
+func radii(o *model.Object) (mean, deviation float64) {
+	for i := range o.Vertices {
+		mean += util.NewVector3FromVertex(&o.Vertices[i]).Length()
+	}
+	mean /= float64(len(o.Vertices))
+	for i := range o.Vertices {
+		d := util.NewVector3FromVertex(&o.Vertices[i]).Length() - mean
+		deviation += d * d
+	}
+	return mean, math.Sqrt(deviation / float64(len(o.Vertices)))
+}
+
+func TestSmoothing(t *testing.T) {
+	_, noise := radii(noisySphere())
+
+	laplacian := noisySphere()
+	Laplacian(laplacian, 0.5, WithIterations(10))
+	lMean, lDev := radii(laplacian)
+
+	cotangent := noisySphere()
+	Laplacian(cotangent, 0.5, WithIterations(10), WithWeighting(CotangentWeights))
+	_, cDev := radii(cotangent)
+
+	taubin := noisySphere()
+	Taubin(taubin, 0.5, -0.53, WithIterations(10))
+	tMean, tDev := radii(taubin)
+
+	for name, dev := range map[string]float64{"laplacian": lDev, "cotangent": cDev, "taubin": tDev} {
+		if dev >= noise/2 {
+			t.Errorf("%s: deviation %f is not below half the noise %f", name, dev, noise)
+		}
+	}
+	if math.Abs(1-tMean) >= math.Abs(1-lMean) {
+		t.Errorf("taubin shrank the sphere to %f, laplacian to %f", tMean, lMean)
+	}
+
+	for _, f := range taubin.Faces {
+		for _, p := range f.Points {
+			if p.Normal.X*p.Vertex.X+p.Normal.Y*p.Vertex.Y+p.Normal.Z*p.Vertex.Z <= 0 {
+				t.Fatalf("normal of %v was not recomputed", p.Vertex)
+			}
+		}
+	}
+}
+
+func TestSmoothingConstraints(t *testing.T) {
+	o := Plane(2, 4)
+	r := rand.New(rand.NewSource(1))
+	for i := range o.Vertices {
+		o.Vertices[i].Y = r.Float64()
+	}
+	before := append([]model.Vertex(nil), o.Vertices...)
+
+	Laplacian(o, 1, WithPinnedBoundary(), WithSelection(0, 6, 12), WithIterations(3))
+
+	for i, v := range o.Vertices {
+		moved := v != before[i]
+		border := math.Abs(v.X) == 1 || math.Abs(v.Z) == 1
+		switch {
+		case moved && border:
+			t.Errorf("boundary vertex %d moved", i)
+		case moved && i != 6 && i != 12:
+			t.Errorf("unselected vertex %d moved", i)
+		case !moved && (i == 6 || i == 12):
+			t.Errorf("selected vertex %d did not move", i)
+		}
+	}
+}
+
+func TestSmoothingEmptySelection(t *testing.T) {
+	o := noisySphere()
+	before := append([]model.Vertex(nil), o.Vertices...)
+
+	Laplacian(o, 1, WithSelection())
+	Taubin(o, 0.5, -0.53, WithSelection(nil...), WithIterations(3))
+
+	for i, v := range o.Vertices {
+		if v != before[i] {
+			t.Fatalf("vertex %d moved without being selected", i)
+		}
+	}
+}
+
+func TestSmoothingIsReproducible(t *testing.T) {
+	for _, w := range []Weighting{UniformWeights, CotangentWeights} {
+		want := noisySphere()
+		Laplacian(want, 0.5, WithIterations(5), WithWeighting(w))
+		for run := 0; run < 5; run++ {
+			got := noisySphere()
+			Laplacian(got, 0.5, WithIterations(5), WithWeighting(w))
+			for i := range want.Vertices {
+				if got.Vertices[i] != want.Vertices[i] {
+					t.Fatalf("weighting %d: vertex %d is %v, then %v", w, i, want.Vertices[i], got.Vertices[i])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package mesh
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/tga"
+	"tinyrender-golang/util"
+)
+
+// ErrHeightmapSize is returned for heightmaps smaller than 2x2 pixels
+var ErrHeightmapSize = errors.New("mesh: heightmap must be at least 2x2 pixels")
+
+// A TerrainOption is a functional option
+// which updates the terrain settings
+type TerrainOption func(c *terrainConfig)
+
+type terrainConfig struct {
+	width       float64
+	depth       float64
+	heightScale float64
+	adaptive    bool
+	tolerance   float64
+}
+
+// WithExtent sets the size of the terrain along X and Z, the default
+// is 2 x 2 to fit the lesson renderers
+func WithExtent(width, depth float64) TerrainOption {
+	return func(c *terrainConfig) {
+		c.width = width
+		c.depth = depth
+	}
+}
+
+// WithHeightScale sets the height of a white pixel, black is always 0
+func WithHeightScale(scale float64) TerrainOption {
+	return func(c *terrainConfig) {
+		c.heightScale = scale
+	}
+}
+
+// WithAdaptive merges grid cells as long as the merged surface stays
+// within tolerance (in heightmap units, 0..1) of every covered pixel
+func WithAdaptive(tolerance float64) TerrainOption {
+	return func(c *terrainConfig) {
+		c.adaptive = true
+		c.tolerance = tolerance
+	}
+}
+
+// Terrain turns a grayscale heightmap into a grid facing +Y. Pixel (0, 0)
+// is at the -X, -Z corner and has texture coordinate (0, 0), so a texture
+// stored like the heightmap lines up with it. Heights are read with 16 bits
+// per channel, so a *tga.TGA works as well as an *image.Gray16 with finer
+// steps.
+func Terrain(img image.Image, options ...TerrainOption) (*model.Object, error) {
+	c := terrainConfig{width: 2, depth: 2, heightScale: 1}
+	for _, o := range options {
+		o(&c)
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w < 2 || h < 2 {
+		return nil, ErrHeightmapSize
+	}
+
+	t := &terrain{
+		config:  c,
+		w:       w,
+		h:       h,
+		heights: make([]float64, w*h),
+		points:  make(map[int]int),
+		b:       &builder{name: "terrain"},
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := color.NRGBA64Model.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA64)
+			t.heights[y*w+x] = (float64(p.R) + float64(p.G) + float64(p.B)) / (3 * 0xffff)
+		}
+	}
+
+	if c.adaptive {
+		t.adaptive()
+	} else {
+		for y := 0; y+1 < h; y++ {
+			for x := 0; x+1 < w; x++ {
+				t.b.quad(t.point(x, y), t.point(x, y+1), t.point(x+1, y+1), t.point(x+1, y))
+			}
+		}
+	}
+
+	return finish(t.b), nil
+}
+
+type terrain struct {
+	config  terrainConfig
+	w       int
+	h       int
+	heights []float64
+	points  map[int]int
+	b       *builder
+}
+
+type cell struct {
+	x0, y0, x1, y1 int
+}
+
+func (t *terrain) height(x, y int) float64 {
+	return t.heights[y*t.w+x]
+}
+
+// position returns the terrain position of the (possibly fractional)
+// pixel coordinate x, y with height in heightmap units
+func (t *terrain) position(x, y, height float64) util.Vector3 {
+	return util.NewVec3(
+		(x/float64(t.w-1)-0.5)*t.config.width,
+		height*t.config.heightScale,
+		(y/float64(t.h-1)-0.5)*t.config.depth,
+	)
+}
+
+// normal returns the heightmap normal from central differences
+func (t *terrain) normal(x, y int) util.Vector3 {
+	x0, x1 := tga.Max(x-1, 0), tga.Min(x+1, t.w-1)
+	y0, y1 := tga.Max(y-1, 0), tga.Min(y+1, t.h-1)
+	dx := t.position(float64(x1), 0, t.height(x1, y)).Sub(t.position(float64(x0), 0, t.height(x0, y)))
+	dz := t.position(0, float64(y1), t.height(x, y1)).Sub(t.position(0, float64(y0), t.height(x, y0)))
+	return dz.CrossProduct(dx).Normalize()
+}
+
+// point returns the builder index of the grid vertex for pixel x, y
+func (t *terrain) point(x, y int) int {
+	key := y*t.w + x
+	if i, ok := t.points[key]; ok {
+		return i
+	}
+	p := t.position(float64(x), float64(y), t.height(x, y))
+	i := t.b.point(p, t.normal(x, y), float64(x)/float64(t.w-1), float64(y)/float64(t.h-1))
+	t.points[key] = i
+	return i
+}
+
+// flat reports whether the bilinear patch over the corners of the cell
+// is within tolerance of every pixel inside it
+func (t *terrain) flat(c cell) bool {
+	h00, h10 := t.height(c.x0, c.y0), t.height(c.x1, c.y0)
+	h01, h11 := t.height(c.x0, c.y1), t.height(c.x1, c.y1)
+	for y := c.y0; y <= c.y1; y++ {
+		v := float64(y-c.y0) / float64(c.y1-c.y0)
+		for x := c.x0; x <= c.x1; x++ {
+			u := float64(x-c.x0) / float64(c.x1-c.x0)
+			patch := (h00*(1-u)+h10*u)*(1-v) + (h01*(1-u)+h11*u)*v
+			if math.Abs(patch-t.height(x, y)) > t.config.tolerance+1e-9 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (t *terrain) split(c cell, leaves []cell) []cell {
+	if (c.x1-c.x0 <= 1 && c.y1-c.y0 <= 1) || t.flat(c) {
+		return append(leaves, c)
+	}
+	xs := []int{c.x0, c.x1}
+	if c.x1-c.x0 > 1 {
+		xs = []int{c.x0, (c.x0 + c.x1) / 2, c.x1}
+	}
+	ys := []int{c.y0, c.y1}
+	if c.y1-c.y0 > 1 {
+		ys = []int{c.y0, (c.y0 + c.y1) / 2, c.y1}
+	}
+	for j := 0; j+1 < len(ys); j++ {
+		for i := 0; i+1 < len(xs); i++ {
+			leaves = t.split(cell{xs[i], ys[j], xs[i+1], ys[j+1]}, leaves)
+		}
+	}
+	return leaves
+}
+
+// adaptive triangulates a quadtree of cells. Corners of smaller neighbours
+// that lie on the edge of a larger cell are fanned from the cell center so
+// the surface stays free of cracks.
+func (t *terrain) adaptive() {
+	leaves := t.split(cell{0, 0, t.w - 1, t.h - 1}, nil)
+
+	rows := make(map[int][]int)
+	cols := make(map[int][]int)
+	used := make(map[int]bool)
+	for _, c := range leaves {
+		for _, p := range [][2]int{{c.x0, c.y0}, {c.x1, c.y0}, {c.x0, c.y1}, {c.x1, c.y1}} {
+			if key := p[1]*t.w + p[0]; !used[key] {
+				used[key] = true
+				rows[p[1]] = append(rows[p[1]], p[0])
+				cols[p[0]] = append(cols[p[0]], p[1])
+			}
+		}
+	}
+	for _, r := range rows {
+		sort.Ints(r)
+	}
+	for _, c := range cols {
+		sort.Ints(c)
+	}
+
+	// between returns the sorted values of list strictly inside (a, b)
+	between := func(list []int, a, b int) []int {
+		lo := sort.SearchInts(list, a+1)
+		hi := sort.SearchInts(list, b)
+		return list[lo:hi]
+	}
+
+	for _, c := range leaves {
+		// boundary loop, counter-clockwise seen from +Y
+		loop := []int{t.point(c.x0, c.y0)}
+		for _, y := range between(cols[c.x0], c.y0, c.y1) {
+			loop = append(loop, t.point(c.x0, y))
+		}
+		loop = append(loop, t.point(c.x0, c.y1))
+		for _, x := range between(rows[c.y1], c.x0, c.x1) {
+			loop = append(loop, t.point(x, c.y1))
+		}
+		loop = append(loop, t.point(c.x1, c.y1))
+		ys := between(cols[c.x1], c.y0, c.y1)
+		for i := len(ys) - 1; i >= 0; i-- {
+			loop = append(loop, t.point(c.x1, ys[i]))
+		}
+		loop = append(loop, t.point(c.x1, c.y0))
+		xs := between(rows[c.y0], c.x0, c.x1)
+		for i := len(xs) - 1; i >= 0; i-- {
+			loop = append(loop, t.point(xs[i], c.y0))
+		}
+
+		if len(loop) == 4 {
+			t.b.quad(loop[0], loop[1], loop[2], loop[3])
+			continue
+		}
+
+		var n util.Vector3
+		var height float64
+		for _, p := range [][2]int{{c.x0, c.y0}, {c.x1, c.y0}, {c.x0, c.y1}, {c.x1, c.y1}} {
+			n = n.Add(t.normal(p[0], p[1]))
+			height += t.height(p[0], p[1]) / 4
+		}
+		cx, cy := float64(c.x0+c.x1)/2, float64(c.y0+c.y1)/2
+		center := t.b.point(t.position(cx, cy, height), n.Normalize(), cx/float64(t.w-1), cy/float64(t.h-1))
+		for i := range loop {
+			t.b.triangle(center, loop[i], loop[(i+1)%len(loop)])
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package mesh
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+	"tinyrender-golang/tga"
+)
+
+func heightmap(w, h int, f func(x, y int) byte) *tga.TGA {
+	img := tga.CreateTga(w, h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			g := f(x, y)
+			img.SetPixel(x, y, tga.NewColor(g, g, g, 255))
+		}
+	}
+	return img
+}
+
+func bump(x, y int) byte {
+	dx, dy := float64(x-8), float64(y-8)
+	return byte(255 * math.Exp(-(dx*dx+dy*dy)/8))
+}
+
+func TestTerrainGrid(t *testing.T) {
+	o, err := Terrain(heightmap(17, 9, bump), WithExtent(4, 2), WithHeightScale(0.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(o.Faces), 2*16*8; got != want {
+		t.Errorf("got %d faces, expected %d", got, want)
+	}
+	if got, want := len(o.Vertices), 17*9; got != want {
+		t.Errorf("got %d vertices, expected %d", got, want)
+	}
+
+	for _, v := range o.Vertices {
+		if v.X < -2 || v.X > 2 || v.Z < -1 || v.Z > 1 || v.Y < 0 || v.Y > 0.5 {
+			t.Fatalf("vertex %v is outside of the extent", v)
+		}
+	}
+	for _, f := range o.Faces {
+		for _, p := range f.Points {
+			if p.Normal.Y <= 0 {
+				t.Fatalf("normal %v is facing down", p.Normal)
+			}
+		}
+	}
+}
+
+func TestTerrainAdaptive(t *testing.T) {
+	flat, err := Terrain(heightmap(33, 33, func(x, y int) byte { return 100 }), WithAdaptive(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flat.Faces) != 2 {
+		t.Errorf("got %d faces for a flat heightmap, expected 2", len(flat.Faces))
+	}
+
+	o, err := Terrain(heightmap(17, 17, bump), WithAdaptive(0.01))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(o.Faces) >= 2*16*16 {
+		t.Errorf("got %d faces, expected fewer than the full grid", len(o.Faces))
+	}
+
+	// every edge is either on the border or shared with the opposite
+	// orientation, otherwise the surface has a crack
+	edges := make(map[[2][3]int64]int)
+	for _, f := range o.Faces {
+		for i := 0; i < 3; i++ {
+			a, b := positionKey(f.Points[i].Vertex), positionKey(f.Points[(i+1)%3].Vertex)
+			edges[[2][3]int64{a, b}]++
+		}
+	}
+	for e := range edges {
+		if edges[[2][3]int64{e[1], e[0]}] == 0 {
+			onBorder := func(k [3]int64) bool {
+				return math.Abs(float64(k[0])) == 1e6 || math.Abs(float64(k[2])) == 1e6
+			}
+			if !onBorder(e[0]) || !onBorder(e[1]) {
+				t.Fatalf("edge %v has no neighbour", e)
+			}
+		}
+	}
+}
+
+func TestTerrain16Bit(t *testing.T) {
+	img := image.NewGray16(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 2; y++ {
+			img.SetGray16(x, y, color.Gray16{Y: uint16(30000 + x)})
+		}
+	}
+	o, err := Terrain(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	heights := make(map[float64]bool)
+	for _, v := range o.Vertices {
+		heights[v.Y] = true
+	}
+	if len(heights) != 4 {
+		t.Errorf("neighbouring 16-bit values give %d distinct heights, expected 4", len(heights))
+	}
+}
+
+func TestTerrainSize(t *testing.T) {
+	if _, err := Terrain(tga.CreateTga(1, 5)); err != ErrHeightmapSize {
+		t.Errorf("got %v, expected %v", err, ErrHeightmapSize)
+	}
+}
@@ -0,0 +1,464 @@
+package mesh
+
+import (
+	"math"
+	"sort"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/util"
+)
+
+// An UnwrapOption is a functional option
+// which updates the unwrapping settings
+type UnwrapOption func(c *unwrapConfig)
+
+type unwrapConfig struct {
+	angleLimit float64
+	padding    float64
+}
+
+// WithAngleLimit sets the largest angle in degrees between the normal of a
+// face and the average normal of its chart, the default is 60. Edges where
+// the limit would be exceeded become seams.
+func WithAngleLimit(degrees float64) UnwrapOption {
+	return func(c *unwrapConfig) {
+		c.angleLimit = degrees
+	}
+}
+
+// WithPadding sets the gap left around every chart in the packed
+// texture, as a fraction of the texture size. The default is 0.005.
+func WithPadding(padding float64) UnwrapOption {
+	return func(c *unwrapConfig) {
+		c.padding = padding
+	}
+}
+
+// Unwrap computes texture coordinates for the object. Faces are grouped
+// into charts of similar orientation, each chart is flattened with least
+// squares conformal maps (LSCM) and the charts are packed into [0,1]².
+// Object.Textures is replaced and every face point is pointed at the
+// coordinate of its vertex in its chart, so vertices on seams get one
+// texture coordinate per chart. Tangents are recomputed when present.
+func Unwrap(o *model.Object, options ...UnwrapOption) {
+	c := unwrapConfig{angleLimit: 60, padding: 0.005}
+	for _, opt := range options {
+		opt(&c)
+	}
+
+	relink(o)
+	r := newResolver(o)
+	ps := Positions(o)
+
+	// vertex indices per face, faces that can't be resolved keep no texture
+	faces := make([][]int, len(o.Faces))
+	for fi, f := range o.Faces {
+		if len(f.Points) < 3 {
+			continue
+		}
+		vs := make([]int, len(f.Points))
+		for i, p := range f.Points {
+			if vs[i] = r.corner(p).v; vs[i] < 0 {
+				vs = nil
+				break
+			}
+		}
+		faces[fi] = vs
+	}
+
+	charts := segment(faces, ps, math.Cos(c.angleLimit*math.Pi/180))
+	flat := make([]*chart, 0, len(charts))
+	for _, ch := range charts {
+		if cf := flatten(ch, faces, ps); cf != nil {
+			flat = append(flat, cf)
+		}
+	}
+	pack(flat, c.padding)
+
+	o.Textures = nil
+	for _, ch := range flat {
+		for _, v := range ch.vertices {
+			uv := ch.uv[v]
+			o.Textures = append(o.Textures, model.TextureCoord{Index: int64(len(o.Textures) + 1), U: uv[0], V: uv[1]})
+			ch.texture[v] = len(o.Textures) - 1
+		}
+	}
+	for fi := range o.Faces {
+		for _, p := range o.Faces[fi].Points {
+			p.Texture = nil
+		}
+	}
+	for _, ch := range flat {
+		for _, fi := range ch.faces {
+			for i, p := range o.Faces[fi].Points {
+				p.Texture = &o.Textures[ch.texture[faces[fi][i]]]
+			}
+		}
+	}
+
+	if len(o.Tangents) > 0 {
+		ComputeTangents(o)
+	}
+}
+
+// faceNormal returns the Newell normal of a polygon, scaled by its area
+func faceNormal(vs []int, ps []util.Vector3) util.Vector3 {
+	var n util.Vector3
+	for i := range vs {
+		a, b := ps[vs[i]], ps[vs[(i+1)%len(vs)]]
+		n.X += (a.Y - b.Y) * (a.Z + b.Z)
+		n.Y += (a.Z - b.Z) * (a.X + b.X)
+		n.Z += (a.X - b.X) * (a.Y + b.Y)
+	}
+	return n.Scale(0.5)
+}
+
+// segment grows charts over manifold edges as long as the face normals
+// stay within the cone around the average chart normal
+func segment(faces [][]int, ps []util.Vector3, minCos float64) [][]int {
+	type edge [2]int
+	key := func(a, b int) edge {
+		if a > b {
+			a, b = b, a
+		}
+		return edge{a, b}
+	}
+	shared := make(map[edge][]int)
+	for fi, vs := range faces {
+		for i := range vs {
+			e := key(vs[i], vs[(i+1)%len(vs)])
+			shared[e] = append(shared[e], fi)
+		}
+	}
+
+	normals := make([]util.Vector3, len(faces))
+	for fi, vs := range faces {
+		if vs != nil {
+			normals[fi] = faceNormal(vs, ps)
+		}
+	}
+
+	assigned := make([]bool, len(faces))
+	var charts [][]int
+	for seed, vs := range faces {
+		if vs == nil || assigned[seed] {
+			continue
+		}
+		assigned[seed] = true
+		members := []int{seed}
+		sum := normals[seed]
+		for q := 0; q < len(members); q++ {
+			f := faces[members[q]]
+			for i := range f {
+				fs := shared[key(f[i], f[(i+1)%len(f)])]
+				if len(fs) != 2 {
+					continue
+				}
+				for _, nb := range fs {
+					if assigned[nb] {
+						continue
+					}
+					n := normals[nb]
+					if n.Length() > 0 && n.Normalize().DotProduct(sum.Normalize()) < minCos {
+						continue
+					}
+					assigned[nb] = true
+					members = append(members, nb)
+					sum = sum.Add(n)
+				}
+			}
+		}
+		charts = append(charts, members)
+	}
+
+	return charts
+}
+
+// chart is a flattened group of faces
+type chart struct {
+	faces    []int
+	vertices []int
+	uv       map[int][2]float64
+	texture  map[int]int
+	min      [2]float64
+	max      [2]float64
+	offset   [2]float64
+}
+
+// flatten computes the least squares conformal map of a chart
+func flatten(faces []int, all [][]int, ps []util.Vector3) *chart {
+	ch := &chart{faces: faces, uv: make(map[int][2]float64), texture: make(map[int]int)}
+	local := make(map[int]int)
+	for _, fi := range faces {
+		for _, v := range all[fi] {
+			if _, ok := local[v]; !ok {
+				local[v] = len(ch.vertices)
+				ch.vertices = append(ch.vertices, v)
+			}
+		}
+	}
+
+	// pin the two vertices furthest apart along the longest axis
+	lo, hi := ch.vertices[0], ch.vertices[0]
+	var best float64
+	for _, axis := range []util.Vector3{{X: 1}, {Y: 1}, {Z: 1}} {
+		a, b := ch.vertices[0], ch.vertices[0]
+		for _, v := range ch.vertices {
+			if ps[v].DotProduct(axis) < ps[a].DotProduct(axis) {
+				a = v
+			}
+			if ps[v].DotProduct(axis) > ps[b].DotProduct(axis) {
+				b = v
+			}
+		}
+		if d := ps[b].Sub(ps[a]).DotProduct(axis); d > best {
+			best, lo, hi = d, a, b
+		}
+	}
+	if lo == hi {
+		return nil
+	}
+
+	// unknowns are u and v of every free vertex
+	unknown := make([]int, len(ch.vertices))
+	n := 0
+	for i, v := range ch.vertices {
+		if v == lo || v == hi {
+			unknown[i] = -1
+			continue
+		}
+		unknown[i] = n
+		n += 2
+	}
+	pinned := map[int][2]float64{lo: {0, 0}, hi: {ps[hi].Sub(ps[lo]).Length(), 0}}
+
+	m := newSparse(n)
+	rhs := make([]float64, n)
+	var area3d float64
+	for _, fi := range faces {
+		vs := all[fi]
+		for k := 1; k+1 < len(vs); k++ {
+			tri := [3]int{vs[0], vs[k], vs[k+1]}
+			p0, p1, p2 := ps[tri[0]], ps[tri[1]], ps[tri[2]]
+			e1, e2 := p1.Sub(p0), p2.Sub(p0)
+			normal := e1.CrossProduct(e2)
+			area := normal.Length() / 2
+			if area < 1e-14 {
+				continue
+			}
+			area3d += area
+
+			// triangle in its own plane, counter-clockwise
+			x := e1.Normalize()
+			y := normal.Normalize().CrossProduct(x)
+			q := [3][2]float64{{0, 0}, {e1.Length(), 0}, {e2.DotProduct(x), e2.DotProduct(y)}}
+
+			// gradients of the barycentric coordinates
+			var g [3][2]float64
+			for j := 0; j < 3; j++ {
+				a, b := q[(j+1)%3], q[(j+2)%3]
+				g[j] = [2]float64{-(b[1] - a[1]) / (2 * area), (b[0] - a[0]) / (2 * area)}
+			}
+
+			// Cauchy-Riemann residuals u_x - v_y and u_y + v_x
+			w := math.Sqrt(area)
+			for _, row := range [2][3][2]float64{
+				{{g[0][0], -g[0][1]}, {g[1][0], -g[1][1]}, {g[2][0], -g[2][1]}},
+				{{g[0][1], g[0][0]}, {g[1][1], g[1][0]}, {g[2][1], g[2][0]}},
+			} {
+				var cols []int
+				var vals []float64
+				var b float64
+				for j := 0; j < 3; j++ {
+					li := local[tri[j]]
+					if p, ok := pinned[tri[j]]; ok {
+						b -= w * (row[j][0]*p[0] + row[j][1]*p[1])
+						continue
+					}
+					cols = append(cols, unknown[li], unknown[li]+1)
+					vals = append(vals, w*row[j][0], w*row[j][1])
+				}
+				m.addRow(cols, vals, b, rhs)
+			}
+		}
+	}
+	if area3d == 0 {
+		return nil
+	}
+
+	sol := m.solve(rhs)
+	for i, v := range ch.vertices {
+		if p, ok := pinned[v]; ok {
+			ch.uv[v] = p
+		} else {
+			ch.uv[v] = [2]float64{sol[unknown[i]], sol[unknown[i]+1]}
+		}
+	}
+
+	// scale the chart to its surface area so all charts share a density
+	var area2d float64
+	for _, fi := range faces {
+		vs := all[fi]
+		for k := 1; k+1 < len(vs); k++ {
+			a, b, c := ch.uv[vs[0]], ch.uv[vs[k]], ch.uv[vs[k+1]]
+			area2d += math.Abs((b[0]-a[0])*(c[1]-a[1])-(c[0]-a[0])*(b[1]-a[1])) / 2
+		}
+	}
+	s := 1.0
+	if area2d > 0 {
+		s = math.Sqrt(area3d / area2d)
+	}
+	ch.min = [2]float64{math.Inf(1), math.Inf(1)}
+	ch.max = [2]float64{math.Inf(-1), math.Inf(-1)}
+	for v, uv := range ch.uv {
+		uv = [2]float64{uv[0] * s, uv[1] * s}
+		ch.uv[v] = uv
+		for k := 0; k < 2; k++ {
+			ch.min[k] = math.Min(ch.min[k], uv[k])
+			ch.max[k] = math.Max(ch.max[k], uv[k])
+		}
+	}
+
+	return ch
+}
+
+// pack places the chart bounding boxes on shelves and scales the result
+// into the unit square, leaving padding around every chart
+func pack(charts []*chart, padding float64) {
+	if len(charts) == 0 {
+		return
+	}
+	sort.SliceStable(charts, func(i, j int) bool {
+		return charts[i].max[1]-charts[i].min[1] > charts[j].max[1]-charts[j].min[1]
+	})
+
+	// the padding is given in texture space, so it depends on the final
+	// scale; a few rounds are enough for it to settle
+	var side float64
+	for _, ch := range charts {
+		side = math.Max(side, math.Max(ch.max[0]-ch.min[0], ch.max[1]-ch.min[1]))
+	}
+	for round := 0; round < 4; round++ {
+		gap := padding * side
+		var area float64
+		for _, ch := range charts {
+			area += (ch.max[0] - ch.min[0] + 2*gap) * (ch.max[1] - ch.min[1] + 2*gap)
+		}
+		width := math.Sqrt(area)
+
+		var x, y, shelf, usedW, usedH float64
+		for _, ch := range charts {
+			w, h := ch.max[0]-ch.min[0]+2*gap, ch.max[1]-ch.min[1]+2*gap
+			if x > 0 && x+w > width {
+				x, y, shelf = 0, y+shelf, 0
+			}
+			ch.offset = [2]float64{x + gap - ch.min[0], y + gap - ch.min[1]}
+			x += w
+			shelf = math.Max(shelf, h)
+			usedW = math.Max(usedW, x)
+			usedH = math.Max(usedH, y+shelf)
+		}
+		side = math.Max(usedW, usedH)
+	}
+
+	for _, ch := range charts {
+		for v, uv := range ch.uv {
+			ch.uv[v] = [2]float64{(uv[0] + ch.offset[0]) / side, (uv[1] + ch.offset[1]) / side}
+		}
+	}
+}
+
+// sparse is the normal matrix AᵀA of a least squares problem
+type sparse struct {
+	rows []map[int]float64
+}
+
+func newSparse(n int) *sparse {
+	s := &sparse{rows: make([]map[int]float64, n)}
+	for i := range s.rows {
+		s.rows[i] = make(map[int]float64)
+	}
+	return s
+}
+
+// addRow adds the equation Σ vals·x[cols] = b to the normal equations
+func (s *sparse) addRow(cols []int, vals []float64, b float64, rhs []float64) {
+	for i, ci := range cols {
+		for j, cj := range cols {
+			s.rows[ci][cj] += vals[i] * vals[j]
+		}
+		rhs[ci] += vals[i] * b
+	}
+}
+
+// compressed returns the rows as sorted column and value slices
+func (s *sparse) compressed() (cols [][]int, vals [][]float64) {
+	cols = make([][]int, len(s.rows))
+	vals = make([][]float64, len(s.rows))
+	for i, row := range s.rows {
+		for j := range row {
+			cols[i] = append(cols[i], j)
+		}
+		sort.Ints(cols[i])
+		for _, j := range cols[i] {
+			vals[i] = append(vals[i], row[j])
+		}
+	}
+	return
+}
+
+// solve runs Jacobi preconditioned conjugate gradients
+func (s *sparse) solve(b []float64) []float64 {
+	n := len(b)
+	x := make([]float64, n)
+	r := append([]float64(nil), b...)
+	inv := make([]float64, n)
+	for i, row := range s.rows {
+		if d := row[i]; d > 0 {
+			inv[i] = 1 / d
+		}
+	}
+	z := make([]float64, n)
+	for i := range z {
+		z[i] = r[i] * inv[i]
+	}
+	p := append([]float64(nil), z...)
+	ap := make([]float64, n)
+	cols, vals := s.compressed()
+
+	dot := func(a, b []float64) float64 {
+		var sum float64
+		for i := range a {
+			sum += a[i] * b[i]
+		}
+		return sum
+	}
+
+	rz := dot(r, z)
+	limit := 1e-20 * math.Max(dot(b, b), 1e-300)
+	for it := 0; it < 10*n+100 && dot(r, r) > limit; it++ {
+		for i := range ap {
+			var sum float64
+			for k, j := range cols[i] {
+				sum += vals[i][k] * p[j]
+			}
+			ap[i] = sum
+		}
+		pap := dot(p, ap)
+		if pap <= 0 {
+			break
+		}
+		alpha := rz / pap
+		for i := range x {
+			x[i] += alpha * p[i]
+			r[i] -= alpha * ap[i]
+			z[i] = r[i] * inv[i]
+		}
+		next := dot(r, z)
+		for i := range p {
+			p[i] = z[i] + next/rz*p[i]
+		}
+		rz = next
+	}
+
+	return x
+}
@@ -0,0 +1,73 @@
+package mesh
+
+import (
+	"math"
+	"testing"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/util"
+)
+
+// stripTextures removes all texture coordinates like an OBJ without vt lines
+func stripTextures(o *model.Object) *model.Object {
+	o.Textures = nil
+	for _, f := range o.Faces {
+		for _, p := range f.Points {
+			p.Texture = nil
+		}
+	}
+	return o
+}
+
+func uvArea(f model.Face) float64 {
+	a, b, c := f.Points[0].Texture, f.Points[1].Texture, f.Points[2].Texture
+	return ((b.U-a.U)*(c.V-a.V) - (c.U-a.U)*(b.V-a.V)) / 2
+}
+
+func TestUnwrap(t *testing.T) {
+	for _, o := range []*model.Object{UVSphere(1, 12), Torus(1, 0.3, 8), Cube(1, 2)} {
+		t.Run(o.Name, func(t *testing.T) {
+			stripTextures(o)
+			Unwrap(o)
+
+			var total float64
+			for _, f := range o.Faces {
+				for _, p := range f.Points {
+					if p.Texture == nil {
+						t.Fatalf("face %d has no texture coordinate", f.Index)
+					}
+					if p.Texture.U < 0 || p.Texture.U > 1 || p.Texture.V < 0 || p.Texture.V > 1 {
+						t.Fatalf("texture coordinate %v is outside [0,1]", p.Texture)
+					}
+				}
+				area := uvArea(f)
+				if area < -1e-12 {
+					t.Errorf("face %d is flipped in texture space", f.Index)
+				}
+				total += area
+			}
+			if total > 1 || total < 0.1 {
+				t.Errorf("charts cover %f of the texture", total)
+			}
+		})
+	}
+}
+
+func TestUnwrapConformal(t *testing.T) {
+	// a flat chart maps to a similar copy of itself
+	o := stripTextures(Plane(2, 3))
+	Unwrap(o)
+
+	var ratio float64
+	for _, f := range o.Faces {
+		for i := 0; i < 3; i++ {
+			a, b := f.Points[i], f.Points[(i+1)%3]
+			d3 := util.NewVector3FromVertex(a.Vertex).Sub(util.NewVector3FromVertex(b.Vertex)).Length()
+			d2 := math.Hypot(a.Texture.U-b.Texture.U, a.Texture.V-b.Texture.V)
+			if ratio == 0 {
+				ratio = d2 / d3
+			} else if math.Abs(d2/d3-ratio) > 1e-6 {
+				t.Fatalf("edge ratio %f differs from %f", d2/d3, ratio)
+			}
+		}
+	}
+}
@@ -0,0 +1,467 @@
+package mesh
+
+import (
+	"math"
+	"sort"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/tga"
+	"tinyrender-golang/util"
+)
+
+// FillMode selects which voxels Voxelize marks as occupied
+type FillMode int
+
+const (
+	// FillSurface only marks voxels touched by a triangle
+	FillSurface FillMode = iota
+	// FillParity also marks voxels whose center is inside by the even-odd
+	// rule, which works for closed meshes without self intersections
+	FillParity
+	// FillWinding also marks voxels whose center has a non-zero winding
+	// number, which handles overlapping closed shells
+	FillWinding
+)
+
+// A VoxelOption is a functional option
+// which updates the voxelization settings
+type VoxelOption func(c *voxelConfig)
+
+type voxelConfig struct {
+	fill    FillMode
+	texture *tga.TGA
+}
+
+// WithFill selects the fill mode, the default is FillSurface
+func WithFill(mode FillMode) VoxelOption {
+	return func(c *voxelConfig) {
+		c.fill = mode
+	}
+}
+
+// WithColors samples the diffuse texture at the surface of every surface
+// voxel, the texture is sampled like the lesson renderers do
+func WithColors(texture *tga.TGA) VoxelOption {
+	return func(c *voxelConfig) {
+		c.texture = texture
+	}
+}
+
+// Voxel is a cell of a VoxelGrid, Color is only meaningful when HasColor
+// is set
+type Voxel struct {
+	Color    tga.Color
+	HasColor bool
+}
+
+// VoxelGrid is a sparse occupancy grid, only occupied voxels are stored.
+// Voxel x, y, z covers Origin + Size*(x, y, z) to Origin + Size*(x+1, y+1, z+1).
+type VoxelGrid struct {
+	Origin util.Vector3
+	Size   float64
+	Nx     int
+	Ny     int
+	Nz     int
+	cells  map[[3]int]Voxel
+}
+
+// NewVoxelGrid returns an empty grid
+func NewVoxelGrid(origin util.Vector3, size float64, nx, ny, nz int) *VoxelGrid {
+	return &VoxelGrid{Origin: origin, Size: size, Nx: nx, Ny: ny, Nz: nz, cells: make(map[[3]int]Voxel)}
+}
+
+// Set marks a voxel as occupied, voxels outside the grid are ignored
+func (g *VoxelGrid) Set(x, y, z int, v Voxel) {
+	if x < 0 || y < 0 || z < 0 || x >= g.Nx || y >= g.Ny || z >= g.Nz {
+		return
+	}
+	g.cells[[3]int{x, y, z}] = v
+}
+
+// Get returns the voxel and whether it is occupied
+func (g *VoxelGrid) Get(x, y, z int) (Voxel, bool) {
+	v, ok := g.cells[[3]int{x, y, z}]
+	return v, ok
+}
+
+// Len returns the number of occupied voxels
+func (g *VoxelGrid) Len() int {
+	return len(g.cells)
+}
+
+// Each calls f for every occupied voxel in x, y, z order
+func (g *VoxelGrid) Each(f func(x, y, z int, v Voxel)) {
+	keys := make([][3]int, 0, len(g.cells))
+	for k := range g.cells {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		if a[1] != b[1] {
+			return a[1] < b[1]
+		}
+		return a[2] < b[2]
+	})
+	for _, k := range keys {
+		f(k[0], k[1], k[2], g.cells[k])
+	}
+}
+
+// Volume returns the volume of the occupied voxels
+func (g *VoxelGrid) Volume() float64 {
+	return float64(len(g.cells)) * g.Size * g.Size * g.Size
+}
+
+// Center returns the center of a voxel
+func (g *VoxelGrid) Center(x, y, z int) util.Vector3 {
+	return g.Origin.Add(util.NewVec3(float64(x)+0.5, float64(y)+0.5, float64(z)+0.5).Scale(g.Size))
+}
+
+// Voxelize converts the object into a grid with resolution voxels along
+// the longest side of its bounding box.
+func Voxelize(o *model.Object, resolution int, options ...VoxelOption) *VoxelGrid {
+	c := voxelConfig{}
+	for _, opt := range options {
+		opt(&c)
+	}
+	resolution = atLeast(resolution, 1)
+
+	ps := Positions(o)
+	min, max := bounds(ps)
+	extent := max.Sub(min)
+	size := math.Max(extent.X, math.Max(extent.Y, extent.Z)) / float64(resolution)
+	if size == 0 {
+		size = 1
+	}
+	dims := func(e float64) int {
+		return atLeast(int(math.Ceil(e/size-1e-9)), 1)
+	}
+	g := NewVoxelGrid(min, size, dims(extent.X), dims(extent.Y), dims(extent.Z))
+
+	tris := triangles(o)
+	type colorSum struct {
+		r, g, b, a float64
+		n          int
+	}
+	sums := make(map[[3]int]*colorSum)
+
+	for _, t := range tris {
+		a, b, cc := ps[t.c[0].v], ps[t.c[1].v], ps[t.c[2].v]
+		lo, hi := g.cell(triMin(a, b, cc)), g.cell(triMax(a, b, cc))
+		for x := lo[0]; x <= hi[0]; x++ {
+			for y := lo[1]; y <= hi[1]; y++ {
+				for z := lo[2]; z <= hi[2]; z++ {
+					center := g.Center(x, y, z)
+					if !triangleBoxOverlap(center, g.Size/2, a, b, cc) {
+						continue
+					}
+					key := [3]int{x, y, z}
+					if c.texture == nil || t.c[0].vt < 0 || t.c[1].vt < 0 || t.c[2].vt < 0 {
+						if _, ok := sums[key]; !ok {
+							sums[key] = &colorSum{}
+						}
+						continue
+					}
+					w := closestBarycentric(center, a, b, cc)
+					t0, t1, t2 := o.Textures[t.c[0].vt], o.Textures[t.c[1].vt], o.Textures[t.c[2].vt]
+					col := c.texture.Sample(t0.U*w.X+t1.U*w.Y+t2.U*w.Z, t0.V*w.X+t1.V*w.Y+t2.V*w.Z)
+					s, ok := sums[key]
+					if !ok {
+						s = &colorSum{}
+						sums[key] = s
+					}
+					s.r += float64(col.R)
+					s.g += float64(col.G)
+					s.b += float64(col.B)
+					s.a += float64(col.A)
+					s.n++
+				}
+			}
+		}
+	}
+
+	if c.fill != FillSurface {
+		g.fill(ps, tris, c.fill)
+	}
+
+	for key, s := range sums {
+		v := Voxel{}
+		if s.n > 0 {
+			n := float64(s.n)
+			v = Voxel{Color: tga.NewColor(byte(s.r/n+0.5), byte(s.g/n+0.5), byte(s.b/n+0.5), byte(s.a/n+0.5)), HasColor: true}
+		}
+		g.Set(key[0], key[1], key[2], v)
+	}
+
+	return g
+}
+
+// fill casts a ray along +X through the center of every voxel column and
+// marks the voxels whose centers are inside
+func (g *VoxelGrid) fill(ps []util.Vector3, tris []triangle, mode FillMode) {
+	columns := columnCrossings(ps, tris, g.Origin, g.Size, g.Ny, g.Nz, 0.5)
+	for key, cs := range columns {
+		for _, span := range insideSpans(cs, mode) {
+			first := int(math.Ceil((span[0]-g.Origin.X)/g.Size - 0.5))
+			last := int(math.Floor((span[1]-g.Origin.X)/g.Size - 0.5))
+			for x := tga.Max(first, 0); x <= last && x < g.Nx; x++ {
+				if _, ok := g.Get(x, key[0], key[1]); !ok {
+					g.Set(x, key[0], key[1], Voxel{})
+				}
+			}
+		}
+	}
+}
+
+// crossing is where a ray along +X passes through a triangle, sign is -1
+// where the ray enters a counter-clockwise mesh and 1 where it leaves
+type crossing struct {
+	x    float64
+	sign int
+}
+
+// columnCrossings casts rays along +X through y = origin.Y + (j+offset)*size
+// and z = origin.Z + (k+offset)*size for every j < ny, k < nz and returns
+// the sorted crossings of every column that hits a triangle
+func columnCrossings(ps []util.Vector3, tris []triangle, origin util.Vector3, size float64, ny, nz int, offset float64) map[[2]int][]crossing {
+	columns := make(map[[2]int][]crossing)
+
+	// move the rays a little so they don't run exactly through edges
+	const jitterY, jitterZ = 1.234567e-7, 2.345678e-7
+	oy := offset + jitterY
+	oz := offset + jitterZ
+
+	for _, t := range tris {
+		a, b, c := ps[t.c[0].v], ps[t.c[1].v], ps[t.c[2].v]
+		n := b.Sub(a).CrossProduct(c.Sub(a))
+		if n.X == 0 {
+			continue
+		}
+		lo, hi := triMin(a, b, c), triMax(a, b, c)
+		y0 := tga.Max(int(math.Ceil((lo.Y-origin.Y)/size-oy)), 0)
+		y1 := tga.Min(int(math.Floor((hi.Y-origin.Y)/size-oy)), ny-1)
+		z0 := tga.Max(int(math.Ceil((lo.Z-origin.Z)/size-oz)), 0)
+		z1 := tga.Min(int(math.Floor((hi.Z-origin.Z)/size-oz)), nz-1)
+		d := (b.Y-a.Y)*(c.Z-a.Z) - (c.Y-a.Y)*(b.Z-a.Z)
+		if d == 0 {
+			continue
+		}
+		sign := 1
+		if n.X < 0 {
+			sign = -1
+		}
+		for y := y0; y <= y1; y++ {
+			for z := z0; z <= z1; z++ {
+				py := origin.Y + (float64(y)+oy)*size
+				pz := origin.Z + (float64(z)+oz)*size
+				// barycentric coordinates in the YZ projection
+				u := ((py-a.Y)*(c.Z-a.Z) - (c.Y-a.Y)*(pz-a.Z)) / d
+				v := ((b.Y-a.Y)*(pz-a.Z) - (py-a.Y)*(b.Z-a.Z)) / d
+				if u < 0 || v < 0 || u+v > 1 {
+					continue
+				}
+				key := [2]int{y, z}
+				columns[key] = append(columns[key], crossing{x: a.X + u*(b.X-a.X) + v*(c.X-a.X), sign: sign})
+			}
+		}
+	}
+
+	for _, cs := range columns {
+		sort.Slice(cs, func(i, j int) bool { return cs[i].x < cs[j].x })
+	}
+	return columns
+}
+
+// insideSpans returns the intervals of a column which are inside the mesh
+// by the parity or the winding rule
+func insideSpans(cs []crossing, mode FillMode) [][2]float64 {
+	var spans [][2]float64
+	winding := 0
+	for i := 0; i+1 < len(cs); i++ {
+		if mode == FillParity {
+			winding = (winding + 1) % 2
+		} else {
+			winding -= cs[i].sign
+		}
+		if winding != 0 {
+			spans = append(spans, [2]float64{cs[i].x, cs[i+1].x})
+		}
+	}
+	return spans
+}
+
+// cell returns the voxel containing p, clamped to the grid
+func (g *VoxelGrid) cell(p util.Vector3) [3]int {
+	clamp := func(v float64, n int) int {
+		return tga.Max(0, tga.Min(n-1, int(math.Floor(v))))
+	}
+	d := p.Sub(g.Origin).Scale(1 / g.Size)
+	return [3]int{clamp(d.X, g.Nx), clamp(d.Y, g.Ny), clamp(d.Z, g.Nz)}
+}
+
+// Object returns the outer faces of the occupied voxels as a mesh and a
+// palette texture holding the voxel colors, voxels without a color are
+// white. The mesh can be drawn with the palette like any textured object.
+func (g *VoxelGrid) Object() (*model.Object, *tga.TGA) {
+	b := &builder{name: "voxels"}
+
+	palette := make(map[tga.Color]int)
+	var colors []tga.Color
+	white := tga.NewColor(255, 255, 255, 255)
+	g.Each(func(x, y, z int, v Voxel) {
+		c := white
+		if v.HasColor {
+			c = v.Color
+		}
+		if _, ok := palette[c]; !ok {
+			palette[c] = len(colors)
+			colors = append(colors, c)
+		}
+	})
+	texture := tga.CreateTga(tga.Max(len(colors), 2), 1)
+	for i, c := range colors {
+		texture.SetPixel(i, 0, c)
+	}
+	for i := range colors {
+		b.texture((float64(i)+0.5)/float64(texture.GetWidth()), 0.5)
+	}
+
+	lattice := make(map[[3]int]int)
+	vertex := func(x, y, z int) int {
+		key := [3]int{x, y, z}
+		if i, ok := lattice[key]; ok {
+			return i
+		}
+		lattice[key] = b.vertex(g.Origin.Add(util.NewVec3(float64(x), float64(y), float64(z)).Scale(g.Size)))
+		return lattice[key]
+	}
+
+	// neighbour direction and the corners of the shared side,
+	// counter-clockwise seen from the neighbour
+	sides := []struct {
+		d       [3]int
+		corners [4][3]int
+	}{
+		{[3]int{1, 0, 0}, [4][3]int{{1, 0, 0}, {1, 1, 0}, {1, 1, 1}, {1, 0, 1}}},
+		{[3]int{-1, 0, 0}, [4][3]int{{0, 0, 0}, {0, 0, 1}, {0, 1, 1}, {0, 1, 0}}},
+		{[3]int{0, 1, 0}, [4][3]int{{0, 1, 0}, {0, 1, 1}, {1, 1, 1}, {1, 1, 0}}},
+		{[3]int{0, -1, 0}, [4][3]int{{0, 0, 0}, {1, 0, 0}, {1, 0, 1}, {0, 0, 1}}},
+		{[3]int{0, 0, 1}, [4][3]int{{0, 0, 1}, {1, 0, 1}, {1, 1, 1}, {0, 1, 1}}},
+		{[3]int{0, 0, -1}, [4][3]int{{0, 0, 0}, {0, 1, 0}, {1, 1, 0}, {1, 0, 0}}},
+	}
+	for _, s := range sides {
+		b.normal(util.NewVec3(float64(s.d[0]), float64(s.d[1]), float64(s.d[2])))
+	}
+
+	g.Each(func(x, y, z int, v Voxel) {
+		c := white
+		if v.HasColor {
+			c = v.Color
+		}
+		vt := palette[c]
+		for vn, s := range sides {
+			if _, ok := g.Get(x+s.d[0], y+s.d[1], z+s.d[2]); ok {
+				continue
+			}
+			var cs [4]corner
+			for i, k := range s.corners {
+				cs[i] = corner{v: vertex(x+k[0], y+k[1], z+k[2]), vt: vt, vn: vn}
+			}
+			b.face(cs[0], cs[1], cs[2])
+			b.face(cs[0], cs[2], cs[3])
+		}
+	})
+
+	return b.object(), texture
+}
+
+func bounds(ps []util.Vector3) (min, max util.Vector3) {
+	if len(ps) == 0 {
+		return
+	}
+	min, max = ps[0], ps[0]
+	for _, p := range ps[1:] {
+		min = triMin(min, p, p)
+		max = triMax(max, p, p)
+	}
+	return
+}
+
+func triMin(a, b, c util.Vector3) util.Vector3 {
+	return util.NewVec3(math.Min(a.X, math.Min(b.X, c.X)), math.Min(a.Y, math.Min(b.Y, c.Y)), math.Min(a.Z, math.Min(b.Z, c.Z)))
+}
+
+func triMax(a, b, c util.Vector3) util.Vector3 {
+	return util.NewVec3(math.Max(a.X, math.Max(b.X, c.X)), math.Max(a.Y, math.Max(b.Y, c.Y)), math.Max(a.Z, math.Max(b.Z, c.Z)))
+}
+
+// triangleBoxOverlap is the separating axis test of Akenine-Möller for a
+// cube of half size h around center
+func triangleBoxOverlap(center util.Vector3, h float64, a, b, c util.Vector3) bool {
+	v := [3]util.Vector3{a.Sub(center), b.Sub(center), c.Sub(center)}
+	e := [3]util.Vector3{v[1].Sub(v[0]), v[2].Sub(v[1]), v[0].Sub(v[2])}
+	axes := []util.Vector3{{X: 1}, {Y: 1}, {Z: 1}}
+
+	separated := func(axis util.Vector3) bool {
+		p0, p1, p2 := v[0].DotProduct(axis), v[1].DotProduct(axis), v[2].DotProduct(axis)
+		r := h * (math.Abs(axis.X) + math.Abs(axis.Y) + math.Abs(axis.Z))
+		return math.Min(p0, math.Min(p1, p2)) > r || math.Max(p0, math.Max(p1, p2)) < -r
+	}
+
+	for _, axis := range axes {
+		if separated(axis) {
+			return false
+		}
+	}
+	if separated(e[0].CrossProduct(e[1])) {
+		return false
+	}
+	for _, edge := range e {
+		for _, axis := range axes {
+			if separated(edge.CrossProduct(axis)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// closestBarycentric returns the barycentric coordinates of the point of
+// triangle a, b, c closest to p (Ericson, Real-Time Collision Detection)
+func closestBarycentric(p, a, b, c util.Vector3) util.Vector3 {
+	ab, ac, ap := b.Sub(a), c.Sub(a), p.Sub(a)
+	d1, d2 := ab.DotProduct(ap), ac.DotProduct(ap)
+	if d1 <= 0 && d2 <= 0 {
+		return util.NewVec3(1, 0, 0)
+	}
+	bp := p.Sub(b)
+	d3, d4 := ab.DotProduct(bp), ac.DotProduct(bp)
+	if d3 >= 0 && d4 <= d3 {
+		return util.NewVec3(0, 1, 0)
+	}
+	vc := d1*d4 - d3*d2
+	if vc <= 0 && d1 >= 0 && d3 <= 0 {
+		v := d1 / (d1 - d3)
+		return util.NewVec3(1-v, v, 0)
+	}
+	cp := p.Sub(c)
+	d5, d6 := ab.DotProduct(cp), ac.DotProduct(cp)
+	if d6 >= 0 && d5 <= d6 {
+		return util.NewVec3(0, 0, 1)
+	}
+	vb := d5*d2 - d1*d6
+	if vb <= 0 && d2 >= 0 && d6 <= 0 {
+		w := d2 / (d2 - d6)
+		return util.NewVec3(1-w, 0, w)
+	}
+	va := d3*d6 - d5*d4
+	if va <= 0 && d4-d3 >= 0 && d5-d6 >= 0 {
+		w := (d4 - d3) / ((d4 - d3) + (d5 - d6))
+		return util.NewVec3(0, 1-w, w)
+	}
+	denom := 1 / (va + vb + vc)
+	v, w := vb*denom, vc*denom
+	return util.NewVec3(1-v-w, v, w)
+}
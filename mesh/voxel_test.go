@@ -0,0 +1,80 @@
+package mesh
+
+import (
+	"math"
+	"testing"
+	"tinyrender-golang/tga"
+)
+
+func TestVoxelizeCube(t *testing.T) {
+	o := Cube(1, 1)
+
+	surface := Voxelize(o, 10)
+	if got, want := surface.Len(), 1000-8*8*8; got != want {
+		t.Errorf("got %d surface voxels, expected %d", got, want)
+	}
+
+	for _, mode := range []FillMode{FillParity, FillWinding} {
+		solid := Voxelize(o, 10, WithFill(mode))
+		if solid.Len() != 1000 {
+			t.Errorf("mode %d: got %d voxels, expected 1000", mode, solid.Len())
+		}
+		if math.Abs(solid.Volume()-1) > 1e-9 {
+			t.Errorf("mode %d: got volume %f, expected 1", mode, solid.Volume())
+		}
+	}
+}
+
+func TestVoxelizeSphere(t *testing.T) {
+	g := Voxelize(Icosphere(1, 4), 40, WithFill(FillWinding))
+	// surface voxels stick out of the sphere, so the volume is a bit larger
+	if v, want := g.Volume(), 4*math.Pi/3; v < want || v > want*1.15 {
+		t.Errorf("got volume %f, expected a little more than %f", v, want)
+	}
+	if _, ok := g.Get(20, 20, 20); !ok {
+		t.Errorf("center voxel is empty")
+	}
+	if _, ok := g.Get(0, 0, 0); ok {
+		t.Errorf("corner voxel is occupied")
+	}
+}
+
+func TestVoxelColors(t *testing.T) {
+	texture := tga.CreateTga(4, 4)
+	red := tga.NewColor(255, 0, 0, 255)
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			texture.SetPixel(x, y, red)
+		}
+	}
+
+	g := Voxelize(Cube(1, 1), 4, WithColors(texture), WithFill(FillParity))
+	colored := 0
+	g.Each(func(x, y, z int, v Voxel) {
+		if v.HasColor {
+			colored++
+			if v.Color != red {
+				t.Fatalf("voxel %d %d %d has color %v", x, y, z, v.Color)
+			}
+		}
+	})
+	if colored != 4*4*4-2*2*2 {
+		t.Errorf("got %d colored voxels, expected %d", colored, 4*4*4-2*2*2)
+	}
+
+	o, palette := g.Object()
+	if got, want := len(o.Faces), 6*4*4*2; got != want {
+		t.Errorf("got %d faces, expected %d", got, want)
+	}
+	watertight(t, o)
+	for _, f := range o.Faces {
+		p := f.Points[0]
+		if p.Texture.U <= 0 || p.Texture.U >= 1 {
+			t.Fatalf("face %d has texture coordinate %v outside of the palette", f.Index, p.Texture.U)
+		}
+		c := palette.Sample(p.Texture.U, p.Texture.V)
+		if c != red && c != tga.NewColor(255, 255, 255, 255) {
+			t.Fatalf("face %d samples %v", f.Index, c)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package obj
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// A VertexColor is the color of a vertex, read from the r g b values some
+// exporters append to `v` lines. Components range from 0 to 1.
+type VertexColor struct {
+	Index int64
+	R     float64
+	G     float64
+	B     float64
+}
+
+func parseVertexColor(items []string) (c VertexColor, err error) {
+	if len(items) != 3 {
+		err = errors.New("item length is incorrect")
+		return
+	}
+
+	if c.R, err = strconv.ParseFloat(items[0], 64); err != nil {
+		err = errors.New("unable to parse R component")
+		return
+	}
+	if c.G, err = strconv.ParseFloat(items[1], 64); err != nil {
+		err = errors.New("unable to parse G component")
+		return
+	}
+	if c.B, err = strconv.ParseFloat(items[2], 64); err != nil {
+		err = errors.New("unable to parse B component")
+		return
+	}
+
+	return
+}
+
+func writeVertexColor(c *VertexColor, w io.Writer) error {
+	_, err := w.Write([]byte(fmt.Sprintf("%f %f %f", c.R, c.G, c.B)))
+	return err
+}
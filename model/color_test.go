@@ -0,0 +1,76 @@
+package obj
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var vertexColorReadTests = []struct {
+	Items stringList
+	Error string
+	Color VertexColor
+}{
+	{stringList{"1", "0.5", "0"}, "", VertexColor{vNullIndex, 1, 0.5, 0}},
+	{stringList{"1", "1"}, "item length is incorrect", VertexColor{vNullIndex, 0, 0, 0}},
+	{stringList{"r", "1", "1"}, "unable to parse R component", VertexColor{vNullIndex, 0, 0, 0}},
+	{stringList{"1", "g", "1"}, "unable to parse G component", VertexColor{vNullIndex, 1, 0, 0}},
+	{stringList{"1", "1", "b"}, "unable to parse B component", VertexColor{vNullIndex, 1, 1, 0}},
+}
+
+func TestReadVertexColor(t *testing.T) {
+
+	for _, test := range vertexColorReadTests {
+		name := fmt.Sprintf("parseVertexColor(%v)", test.Items)
+		t.Run(name, func(t *testing.T) {
+
+			c, err := parseVertexColor(test.Items)
+
+			failed := false
+			failed = failed || (test.Error == "" && err != nil)
+			failed = failed || (err != nil && test.Error != err.Error())
+			failed = failed || (c.R != test.Color.R || c.G != test.Color.G || c.B != test.Color.B)
+
+			if failed {
+				t.Errorf("%v, '%v', expected %v, '%v'", c, err, test.Color, test.Error)
+			}
+		})
+	}
+}
+
+func TestWriteVertexColor(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeVertexColor(&VertexColor{vNullIndex, 1, 0.5, 0}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "1.000000 0.500000 0.000000" {
+		t.Errorf("got '%s'", got)
+	}
+}
+
+func TestReadColoredVertices(t *testing.T) {
+	body := "v 0 0 0\nv 1 0 0 1 0 0\nv 0 1 0\n"
+	o, err := NewReader(strings.NewReader(body)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []VertexColor{{1, 1, 1, 1}, {2, 1, 0, 0}, {3, 1, 1, 1}}
+	if len(o.Colors) != len(expected) {
+		t.Fatalf("got %d colors, expected %d", len(o.Colors), len(expected))
+	}
+	for i, c := range expected {
+		if o.Colors[i] != c {
+			t.Errorf("color %d is %v, expected %v", i, o.Colors[i], c)
+		}
+	}
+
+	plain, err := NewReader(strings.NewReader("v 0 0 0\n")).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plain.Colors) != 0 {
+		t.Errorf("got %d colors for a plain vertex", len(plain.Colors))
+	}
+}
@@ -0,0 +1,262 @@
+package obj
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// A ParamVertex is a point in the parameter space of a curve or surface,
+// read from `vp` lines
+type ParamVertex struct {
+	Index int64
+	U     float64
+	V     float64
+	W     float64
+}
+
+// CurveType is the basis of a free-form curve or surface, set by `cstype`
+type CurveType int
+
+const (
+	// Bezier curves pass through the first and last control point of
+	// every segment
+	Bezier CurveType = iota
+	// BSpline curves are defined by a knot vector, rational B-splines are
+	// NURBS
+	BSpline
+	// BasisMatrix curves use a basis matrix from `bmat`
+	BasisMatrix
+	// Cardinal curves are Catmull-Rom style splines
+	Cardinal
+	// Taylor curves are power series
+	Taylor
+)
+
+var curveTypes = map[string]CurveType{
+	"bezier":   Bezier,
+	"bspline":  BSpline,
+	"bmatrix":  BasisMatrix,
+	"cardinal": Cardinal,
+	"taylor":   Taylor,
+}
+
+// A Curve is a free-form space curve read from a `curv` statement
+type Curve struct {
+	Type     CurveType
+	Rational bool
+	Degree   int
+	// U0 and U1 bound the part of the curve to draw
+	U0 float64
+	U1 float64
+	// Vertices are indices into Object.Vertices starting at 0
+	Vertices []int
+	// Knots holds the `parm u` values, all knots for B-splines and the
+	// segment boundaries for Bezier curves
+	Knots []float64
+}
+
+// A Surface is a free-form surface read from a `surf` statement. Control
+// points are ordered row by row with u changing fastest.
+type Surface struct {
+	Type     CurveType
+	Rational bool
+	DegreeU  int
+	DegreeV  int
+	// S0, S1, T0 and T1 bound the part of the surface to draw
+	S0 float64
+	S1 float64
+	T0 float64
+	T1 float64
+	// Vertices are indices into Object.Vertices starting at 0
+	Vertices []int
+	// KnotsU and KnotsV hold the `parm u` and `parm v` values
+	KnotsU []float64
+	KnotsV []float64
+}
+
+// freeFormState is the state kept between free-form statements: the
+// attributes set by `cstype` and `deg` and the element `parm` applies to
+type freeFormState struct {
+	typ      CurveType
+	rational bool
+	degU     int
+	degV     int
+	curve    *Curve
+	surface  *Surface
+}
+
+func parseFloats(items []string, name string) ([]float64, error) {
+	out := make([]float64, len(items))
+	for i, item := range items {
+		v, err := strconv.ParseFloat(item, 64)
+		if err != nil {
+			return nil, errors.New("unable to parse " + name)
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func parseParamVertex(items []string) (vp ParamVertex, err error) {
+	if len(items) < 1 || len(items) > 3 {
+		err = errors.New("item length is incorrect")
+		return
+	}
+
+	vp.W = 1
+	values, err := parseFloats(items, "parameter")
+	if err != nil {
+		return
+	}
+	vp.U = values[0]
+	if len(values) > 1 {
+		vp.V = values[1]
+	}
+	if len(values) > 2 {
+		vp.W = values[2]
+	}
+	return
+}
+
+// parseControlPoints resolves vertex references, texture and normal
+// references of surface control points are ignored
+func parseControlPoints(items []string, o *Object) ([]int, error) {
+	out := make([]int, len(items))
+	for i, item := range items {
+		idx, err := parseIndex(strings.SplitN(item, "/", 2)[0], len(o.Vertices))
+		if err != nil {
+			return nil, err
+		}
+		if idx < 0 || idx >= int64(len(o.Vertices)) {
+			return nil, errors.New("vertex index out of range")
+		}
+		out[i] = int(idx)
+	}
+	return out, nil
+}
+
+func paramVertexHandler(o *Object, token string, rest ...string) error {
+	vp, err := parseParamVertex(rest)
+	if err != nil {
+		return wrapParseErrors("parameterVertex (vp)", err)
+	}
+	vp.Index = int64(len(o.ParamVertices) + 1)
+	o.ParamVertices = append(o.ParamVertices, vp)
+	return nil
+}
+
+func curveTypeHandler(o *Object, token string, rest ...string) error {
+	rational := len(rest) == 2 && rest[0] == "rat"
+	if len(rest) == 0 || len(rest) > 2 || (len(rest) == 2 && !rational) {
+		return wrapParseErrors("curveType (cstype)", errors.New("item length is incorrect"))
+	}
+	typ, ok := curveTypes[rest[len(rest)-1]]
+	if !ok {
+		return wrapParseErrors("curveType (cstype)", errors.New("unknown curve type"))
+	}
+	o.freeForm.rational, o.freeForm.typ = rational, typ
+	return nil
+}
+
+func degreeHandler(o *Object, token string, rest ...string) error {
+	if len(rest) < 1 || len(rest) > 2 {
+		return wrapParseErrors("degree (deg)", errors.New("item length is incorrect"))
+	}
+	var deg [2]int
+	for i, item := range rest {
+		d, err := strconv.Atoi(item)
+		if err != nil || d < 1 {
+			return wrapParseErrors("degree (deg)", errors.New("unable to parse degree"))
+		}
+		deg[i] = d
+	}
+	o.freeForm.degU, o.freeForm.degV = deg[0], deg[1]
+	return nil
+}
+
+func curveHandler(o *Object, token string, rest ...string) error {
+	if len(rest) < 4 {
+		return wrapParseErrors("curve (curv)", errors.New("item length is incorrect"))
+	}
+	r, err := parseFloats(rest[:2], "parameter range")
+	if err != nil {
+		return wrapParseErrors("curve (curv)", err)
+	}
+	vertices, err := parseControlPoints(rest[2:], o)
+	if err != nil {
+		return wrapParseErrors("curve (curv)", err)
+	}
+
+	s := &o.freeForm
+	o.Curves = append(o.Curves, Curve{
+		Type:     s.typ,
+		Rational: s.rational,
+		Degree:   s.degU,
+		U0:       r[0],
+		U1:       r[1],
+		Vertices: vertices,
+	})
+	s.curve, s.surface = &o.Curves[len(o.Curves)-1], nil
+	return nil
+}
+
+func surfaceHandler(o *Object, token string, rest ...string) error {
+	if len(rest) < 8 {
+		return wrapParseErrors("surface (surf)", errors.New("item length is incorrect"))
+	}
+	r, err := parseFloats(rest[:4], "parameter range")
+	if err != nil {
+		return wrapParseErrors("surface (surf)", err)
+	}
+	if r[0] == r[1] || r[2] == r[3] {
+		return wrapParseErrors("surface (surf)", errors.New("empty parameter range"))
+	}
+	vertices, err := parseControlPoints(rest[4:], o)
+	if err != nil {
+		return wrapParseErrors("surface (surf)", err)
+	}
+
+	s := &o.freeForm
+	o.Surfaces = append(o.Surfaces, Surface{
+		Type:     s.typ,
+		Rational: s.rational,
+		DegreeU:  s.degU,
+		DegreeV:  s.degV,
+		S0:       r[0],
+		S1:       r[1],
+		T0:       r[2],
+		T1:       r[3],
+		Vertices: vertices,
+	})
+	s.curve, s.surface = nil, &o.Surfaces[len(o.Surfaces)-1]
+	return nil
+}
+
+func parameterHandler(o *Object, token string, rest ...string) error {
+	if len(rest) < 2 || (rest[0] != "u" && rest[0] != "v") {
+		return wrapParseErrors("parameter (parm)", errors.New("item length is incorrect"))
+	}
+	values, err := parseFloats(rest[1:], "parameter")
+	if err != nil {
+		return wrapParseErrors("parameter (parm)", err)
+	}
+
+	s := &o.freeForm
+	switch {
+	case s.curve != nil && rest[0] == "u":
+		s.curve.Knots = values
+	case s.surface != nil && rest[0] == "u":
+		s.surface.KnotsU = values
+	case s.surface != nil:
+		s.surface.KnotsV = values
+	default:
+		return wrapParseErrors("parameter (parm)", errors.New("no curve or surface to apply to"))
+	}
+	return nil
+}
+
+func endHandler(o *Object, token string, rest ...string) error {
+	o.freeForm.curve, o.freeForm.surface = nil, nil
+	return nil
+}
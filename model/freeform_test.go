@@ -0,0 +1,92 @@
+package obj
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var freeFormBody = `
+v 0 0 0
+v 1 0 0 2
+v 2 0 0
+v 0 1 0
+v 1 1 0
+v 2 1 0
+vp 0.5
+vp 0.25 0.75
+cstype rat bspline
+deg 2
+curv 0 1 1 2 -4
+parm u 0 0 0 1 1 1
+end
+cstype bezier
+deg 2 1
+surf 0 1 0 1 1/1 2 3 4 5 6
+parm u 0 1
+parm v 0 1
+end
+`
+
+func TestReadFreeForm(t *testing.T) {
+	o, err := NewStandardReader(strings.NewReader(freeFormBody)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(o.Weights, []float64{1, 2, 1, 1, 1, 1}) {
+		t.Errorf("got weights %v", o.Weights)
+	}
+	if len(o.ParamVertices) != 2 || o.ParamVertices[1] != (ParamVertex{2, 0.25, 0.75, 1}) {
+		t.Errorf("got parameter vertices %v", o.ParamVertices)
+	}
+
+	curve := Curve{Type: BSpline, Rational: true, Degree: 2, U0: 0, U1: 1, Vertices: []int{0, 1, 2}, Knots: []float64{0, 0, 0, 1, 1, 1}}
+	if len(o.Curves) != 1 || !reflect.DeepEqual(o.Curves[0], curve) {
+		t.Errorf("got curves %+v, expected %+v", o.Curves, curve)
+	}
+
+	surface := Surface{Type: Bezier, DegreeU: 2, DegreeV: 1, S1: 1, T1: 1, Vertices: []int{0, 1, 2, 3, 4, 5}, KnotsU: []float64{0, 1}, KnotsV: []float64{0, 1}}
+	if len(o.Surfaces) != 1 || !reflect.DeepEqual(o.Surfaces[0], surface) {
+		t.Errorf("got surfaces %+v, expected %+v", o.Surfaces, surface)
+	}
+}
+
+var freeFormErrorTests = []struct {
+	Line  string
+	Error string
+}{
+	{"cstype spiral", "error at line 0: error parsing curveType (cstype): unknown curve type"},
+	{"cstype irrational bezier", "error at line 0: error parsing curveType (cstype): item length is incorrect"},
+	{"deg 0", "error at line 0: error parsing degree (deg): unable to parse degree"},
+	{"curv 0 1 1 12", "error at line 0: error parsing curve (curv): vertex index out of range"},
+	{"surf 0 1 0 1 1 2 x", "error at line 0: error parsing surface (surf): item length is incorrect"},
+	{"surf 0 1 2 2 1 2 1 2", "error at line 0: error parsing surface (surf): empty parameter range"},
+	{"parm u 0 1", "error at line 0: error parsing parameter (parm): no curve or surface to apply to"},
+	{"parm w 0 1", "error at line 0: error parsing parameter (parm): item length is incorrect"},
+	{"vp x", "error at line 0: error parsing parameterVertex (vp): unable to parse parameter"},
+}
+
+func TestReadFreeFormErrors(t *testing.T) {
+	for _, test := range freeFormErrorTests {
+		o := Object{Vertices: make([]Vertex, 10)}
+		err := NewReader(nil).(*stdReader).readLine(test.Line, 0, &o)
+		if err == nil || err.Error() != test.Error {
+			t.Errorf("%s: got '%v', expected '%s'", test.Line, err, test.Error)
+		}
+	}
+}
+
+func TestReadCurveTypeKeepsState(t *testing.T) {
+	o := Object{}
+	r := NewReader(nil).(*stdReader)
+	if err := r.readLine("cstype bezier", 0, &o); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.readLine("cstype rat spiral", 1, &o); err == nil {
+		t.Fatal("unknown curve type accepted")
+	}
+	if o.freeForm.rational || o.freeForm.typ != Bezier {
+		t.Errorf("failed cstype changed the state to %+v", o.freeForm)
+	}
+}
@@ -0,0 +1,94 @@
+package obj
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// A Line is a polyline read from an `l` statement, its points may carry
+// texture coordinates but no normals
+type Line struct {
+	Index  int64
+	Points []*Point
+}
+
+// A PointSet is a list of single points read from a `p` statement, its
+// points only reference vertices
+type PointSet struct {
+	Index  int64
+	Points []*Point
+}
+
+// parseElementPoints parses the references of `l` and `p` statements,
+// allowing texture coordinates when textures is set
+func parseElementPoints(items []string, o *Object, textures bool) ([]*Point, error) {
+	points := make([]*Point, 0, len(items))
+	for _, item := range items {
+		refs := strings.Split(item, "/")
+		if len(refs) > 2 || (!textures && len(refs) > 1) {
+			return nil, errors.New("unexpected reference in " + item)
+		}
+		lengths := []int{len(o.Vertices), len(o.Textures)}
+		for i, ref := range refs {
+			if i > 0 && ref == "" {
+				continue
+			}
+			idx, err := parseIndex(ref, lengths[i])
+			if err != nil {
+				return nil, err
+			}
+			if idx < 0 || idx >= int64(lengths[i]) {
+				return nil, errors.New("index out of range in " + item)
+			}
+		}
+		p, err := parsePoint(item, o)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+func parseLine(items []string, o *Object) (l Line, err error) {
+	if len(items) < 2 {
+		err = errors.New("item length is incorrect")
+		return
+	}
+	l.Points, err = parseElementPoints(items, o, true)
+	return
+}
+
+func parsePointSet(items []string, o *Object) (p PointSet, err error) {
+	if len(items) < 1 {
+		err = errors.New("item length is incorrect")
+		return
+	}
+	p.Points, err = parseElementPoints(items, o, false)
+	return
+}
+
+func writeLine(l *Line, w io.Writer) error {
+	return writeFace(&Face{Index: l.Index, Points: l.Points}, w)
+}
+
+func lineHandler(o *Object, token string, rest ...string) error {
+	l, err := parseLine(rest, o)
+	if err != nil {
+		return wrapParseErrors("line (l)", err)
+	}
+	l.Index = int64(len(o.Lines) + 1)
+	o.Lines = append(o.Lines, l)
+	return nil
+}
+
+func pointSetHandler(o *Object, token string, rest ...string) error {
+	p, err := parsePointSet(rest, o)
+	if err != nil {
+		return wrapParseErrors("point (p)", err)
+	}
+	p.Index = int64(len(o.PointSets) + 1)
+	o.PointSets = append(o.PointSets, p)
+	return nil
+}
@@ -0,0 +1,61 @@
+package obj
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadLinesAndPoints(t *testing.T) {
+	body := "v 0 0 0\nv 1 0 0\nv 1 1 0\nvt 0 0\nvt 1 0\nl 1/1 2/2 3\np 1 -1\n"
+	o, err := NewReader(strings.NewReader(body)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(o.Lines) != 1 || len(o.Lines[0].Points) != 3 {
+		t.Fatalf("got lines %v", o.Lines)
+	}
+	l := o.Lines[0]
+	if l.Index != 1 || l.Points[1].Vertex.X != 1 || l.Points[1].Texture.U != 1 || l.Points[2].Texture != nil {
+		t.Errorf("line points are not resolved")
+	}
+
+	if len(o.PointSets) != 1 || len(o.PointSets[0].Points) != 2 {
+		t.Fatalf("got point sets %v", o.PointSets)
+	}
+	if p := o.PointSets[0].Points[1].Vertex; p.X != 1 || p.Y != 1 {
+		t.Errorf("relative point index resolves to %v", p)
+	}
+
+	var buf bytes.Buffer
+	if err := writeLine(&l, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "1/1 2/2 3" {
+		t.Errorf("got '%s'", got)
+	}
+}
+
+var elementErrorTests = []struct {
+	Line  string
+	Error string
+}{
+	{"l 1", "error at line 0: error parsing line (l): item length is incorrect"},
+	{"l 1 11", "error at line 0: error parsing line (l): index out of range in 11"},
+	{"l 1//1 2//1", "error at line 0: error parsing line (l): unexpected reference in 1//1"},
+	{"l 1/4 2", "error at line 0: error parsing line (l): index out of range in 1/4"},
+	{"p", "error at line 0: error parsing point (p): item length is incorrect"},
+	{"p 1/1", "error at line 0: error parsing point (p): unexpected reference in 1/1"},
+	{"p x", "error at line 0: error parsing point (p): strconv.ParseInt: parsing \"x\": invalid syntax"},
+}
+
+func TestReadElementErrors(t *testing.T) {
+	for _, test := range elementErrorTests {
+		o := Object{Vertices: make([]Vertex, 10), Textures: make([]TextureCoord, 3)}
+		err := NewReader(nil).(*stdReader).readLine(test.Line, 0, &o)
+		if err == nil || err.Error() != test.Error {
+			t.Errorf("%s: got '%v', expected '%s'", test.Line, err, test.Error)
+		}
+	}
+}
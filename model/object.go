@@ -8,6 +8,30 @@ type Object struct {
 	Textures []TextureCoord
 	Faces    []Face
 
+	// Lines and PointSets hold the `l` and `p` statements
+	Lines     []Line
+	PointSets []PointSet
+
+	// Tangents run parallel to Normals: the tangent of a point is
+	// Tangents[i] when its Normal is &Normals[i]. They are never read
+	// from OBJ files and are only filled in by generators.
+	Tangents []Tangent
+
+	// Colors run parallel to Vertices when any `v` line carries a color,
+	// vertices without one are white. They are empty otherwise.
+	Colors []VertexColor
+
+	// Weights run parallel to Vertices when any `v` line carries a w
+	// weight, which rational curves and surfaces use. Vertices without one
+	// weigh 1. They are empty otherwise.
+	Weights []float64
+
+	// Free-form geometry, see mesh.Tessellate
+	ParamVertices []ParamVertex
+	Curves        []Curve
+	Surfaces      []Surface
+	freeForm      freeFormState
+
 	// Custom types for custom
 	Custom map[string][]interface{}
 }
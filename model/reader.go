@@ -2,7 +2,9 @@ package obj
 
 import (
 	"bufio"
+	"errors"
 	"io"
+	"strconv"
 	"strings"
 )
 
@@ -27,6 +29,15 @@ func NewReader(r io.Reader, os ...ReaderOption) Reader {
 	sr.router["vn"] = normalHandler
 	sr.router["vt"] = textureHandler
 	sr.router["f"] = faceHandler
+	sr.router["l"] = lineHandler
+	sr.router["p"] = pointSetHandler
+	sr.router["vp"] = paramVertexHandler
+	sr.router["cstype"] = curveTypeHandler
+	sr.router["deg"] = degreeHandler
+	sr.router["curv"] = curveHandler
+	sr.router["surf"] = surfaceHandler
+	sr.router["parm"] = parameterHandler
+	sr.router["end"] = endHandler
 
 	for _, o := range os {
 		o(sr)
@@ -103,10 +114,48 @@ func objectHandler(o *Object, token string, rest ...string) error {
 }
 
 func vertexHandler(o *Object, token string, rest ...string) error {
+	var colors, weight []string
+	switch len(rest) {
+	case 4:
+		rest, weight = rest[:3], rest[3:]
+	case 6:
+		rest, colors = rest[:3], rest[3:]
+	}
 	v, err := parseVertex(rest)
 	if err != nil {
 		return wrapParseErrors("vertex (v)", err)
 	}
+
+	if weight != nil || len(o.Weights) > 0 {
+		w := 1.0
+		if weight != nil {
+			if w, err = strconv.ParseFloat(weight[0], 64); err != nil {
+				return wrapParseErrors("vertex (v)", errors.New("unable to parse W weight"))
+			}
+		}
+		// earlier vertices without a weight have a weight of 1
+		for len(o.Weights) < len(o.Vertices) {
+			o.Weights = append(o.Weights, 1)
+		}
+		o.Weights = append(o.Weights, w)
+	}
+
+	if colors != nil || len(o.Colors) > 0 {
+		c := VertexColor{R: 1, G: 1, B: 1}
+		if colors != nil {
+			if c, err = parseVertexColor(colors); err != nil {
+				return wrapParseErrors("vertex (v)", err)
+			}
+		}
+		// earlier vertices without a color are white
+		for len(o.Colors) < len(o.Vertices) {
+			o.Colors = append(o.Colors, VertexColor{Index: int64(len(o.Colors) + 1), R: 1, G: 1, B: 1})
+		}
+		c.Index = int64(len(o.Colors) + 1)
+		o.Colors = append(o.Colors, c)
+	}
+
+	v.Index = int64(len(o.Vertices) + 1)
 	o.Vertices = append(o.Vertices, v)
 	return nil
 }
@@ -116,6 +165,7 @@ func normalHandler(o *Object, token string, rest ...string) error {
 	if err != nil {
 		return wrapParseErrors("vertexNormal (vn)", err)
 	}
+	vn.Index = int64(len(o.Normals) + 1)
 	o.Normals = append(o.Normals, vn)
 	return nil
 }
@@ -126,6 +176,7 @@ func textureHandler(o *Object, token string, rest ...string) error {
 		return wrapParseErrors("textureCoordinate (vt)", err)
 	}
 
+	vt.Index = int64(len(o.Textures) + 1)
 	o.Textures = append(o.Textures, vt)
 	return nil
 }
@@ -73,6 +73,11 @@ var readLineTests = []struct {
 	{"v 0 0 0", "", none},
 	{"v x", "error at line 0: error parsing vertex (v): item length is incorrect", none},
 	{"v 0 x 0", "error at line 0: error parsing vertex (v): unable to parse Y coordinate", none},
+	{"v 0 0 0 1 0.5 0", "", none},
+	{"v 0 0 0 1 x 0", "error at line 0: error parsing vertex (v): unable to parse G component", none},
+	{"v 0 0 0 1", "", none},
+	{"v 0 0 0 w", "error at line 0: error parsing vertex (v): unable to parse W weight", none},
+	{"v 0 0 0 1 1", "error at line 0: error parsing vertex (v): item length is incorrect", none},
 
 	{"vn 0 0 0", "", none},
 
@@ -4,7 +4,8 @@ import "io"
 
 // StandardSet is the standard set of wavefront object types. Not all are
 // implemented but all are allowed within a `StandardReader`
-var StandardSet = []string{"o", "g", "s", "mtlib", "usemtl", "v", "vn", "vp", "#"}
+var StandardSet = []string{"o", "g", "s", "mtlib", "usemtl", "v", "vn", "vp", "#",
+	"cstype", "deg", "curv", "surf", "parm", "end"}
 
 // NewStandardReader returns a reader which supports a set of
 // given types. Any others generate errors.
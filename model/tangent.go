@@ -0,0 +1,10 @@
+package obj
+
+// A Tangent is a vertex tangent, W holds the handedness of the bitangent
+type Tangent struct {
+	Index int64
+	X     float64
+	Y     float64
+	Z     float64
+	W     float64
+}
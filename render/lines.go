@@ -0,0 +1,92 @@
+package render
+
+import (
+	model "tinyrender-golang/model"
+	"tinyrender-golang/tga"
+	"tinyrender-golang/util"
+)
+
+// A LineOption is a functional option
+// which updates the line rendering settings
+type LineOption func(c *lineConfig)
+
+type lineConfig struct {
+	width     float64
+	color     tga.Color
+	offset    float64
+	depthTest bool
+}
+
+// WithLineWidth sets the width of lines in pixels, the default is 1
+func WithLineWidth(pixels float64) LineOption {
+	return func(c *lineConfig) {
+		c.width = pixels
+	}
+}
+
+// WithLineColor sets the color of lines, the default is white
+func WithLineColor(color tga.Color) LineOption {
+	return func(c *lineConfig) {
+		c.color = color
+	}
+}
+
+// WithDepthOffset moves lines towards the viewer by offset in screen
+// depth units, so wireframes on top of faces are not hidden by them
+func WithDepthOffset(offset float64) LineOption {
+	return func(c *lineConfig) {
+		c.offset = offset
+	}
+}
+
+// WithoutLineDepthTest draws lines in order, ignoring and keeping the
+// z-buffer
+func WithoutLineDepthTest() LineOption {
+	return func(c *lineConfig) {
+		c.depthTest = false
+	}
+}
+
+// DrawLines draws the polylines of the object's `l` statements. The
+// transform maps model space to screen space like DrawPoints, segments
+// with an end behind the camera are skipped.
+func DrawLines(fb *tga.TGA, zBuffer []float64, o *model.Object, transform *util.Matrix, options ...LineOption) {
+	c := lineConfig{width: 1, color: tga.NewColor(255, 255, 255, 255), depthTest: true}
+	for _, opt := range options {
+		opt(&c)
+	}
+	if !c.depthTest {
+		zBuffer = nil
+	}
+
+	for _, l := range o.Lines {
+		for i := 0; i+1 < len(l.Points); i++ {
+			a, okA := toScreen(transform, util.NewVector3FromVertex(l.Points[i].Vertex))
+			b, okB := toScreen(transform, util.NewVector3FromVertex(l.Points[i+1].Vertex))
+			if !okA || !okB {
+				continue
+			}
+			a.Z += c.offset
+			b.Z += c.offset
+			fb.DrawLineWithZBuffer(a, b, c.width, c.color, zBuffer)
+		}
+	}
+}
+
+// DrawPointSets draws the vertices referenced by the object's `p`
+// statements as splats with their vertex colors, see DrawPoints for the
+// options
+func DrawPointSets(fb *tga.TGA, zBuffer []float64, o *model.Object, transform *util.Matrix, options ...PointOption) {
+	points := &model.Object{}
+	for _, ps := range o.PointSets {
+		for _, p := range ps.Points {
+			points.Vertices = append(points.Vertices, *p.Vertex)
+			if i := p.Vertex.Index - 1; i >= 0 && i < int64(len(o.Colors)) {
+				points.Colors = append(points.Colors, o.Colors[i])
+			} else if len(o.Colors) > 0 {
+				points.Colors = append(points.Colors, model.VertexColor{R: 1, G: 1, B: 1})
+			}
+		}
+	}
+	DrawPoints(fb, zBuffer, points, transform, options...)
+}
@@ -0,0 +1,78 @@
+package render
+
+import (
+	"strings"
+	"testing"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/tga"
+	"tinyrender-golang/util"
+)
+
+func TestDrawLines(t *testing.T) {
+	o, err := model.NewReader(strings.NewReader("v 2 4 0\nv 28 4 0\nv 28 20 1\nl 1 2 3\n")).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	red := tga.NewColor(255, 0, 0, 255)
+
+	fb := tga.CreateTga(32, 32)
+	DrawLines(fb, NewZBuffer(fb), o, util.NewIdentity(4), WithLineColor(red))
+	for x := 2; x <= 28; x++ {
+		if fb.GetPixel(x, 4) != red {
+			t.Fatalf("pixel %d is not on the line", x)
+		}
+	}
+	if fb.GetPixel(28, 12) != red || fb.GetPixel(15, 5) == red {
+		t.Errorf("thin line is drawn in the wrong place")
+	}
+
+	wide := tga.CreateTga(32, 32)
+	DrawLines(wide, NewZBuffer(wide), o, util.NewIdentity(4), WithLineColor(red), WithLineWidth(5))
+	covered := 0
+	for y := 0; y < 16; y++ {
+		if wide.GetPixel(15, y) == red {
+			covered++
+		}
+	}
+	if covered < 4 || covered > 6 {
+		t.Errorf("line of width 5 covers %d pixels", covered)
+	}
+}
+
+func TestDrawLinesDepth(t *testing.T) {
+	o, err := model.NewReader(strings.NewReader("v 0 8 0\nv 15 8 0\nl 1 2\n")).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	red := tga.NewColor(255, 0, 0, 255)
+	blue := tga.NewColor(0, 0, 255, 255)
+
+	fb := tga.CreateTga(16, 16)
+	zBuffer := NewZBuffer(fb)
+	DrawPoints(fb, zBuffer, cloud(model.Vertex{X: 8, Y: 8, Z: 1}), util.NewIdentity(4), WithPointColor(blue))
+	DrawLines(fb, zBuffer, o, util.NewIdentity(4), WithLineColor(red))
+	if fb.GetPixel(8, 8) != blue || fb.GetPixel(3, 8) != red {
+		t.Errorf("line is not depth tested")
+	}
+
+	DrawLines(fb, zBuffer, o, util.NewIdentity(4), WithLineColor(red), WithDepthOffset(2))
+	if fb.GetPixel(8, 8) != red {
+		t.Errorf("depth offset does not bring the line forward")
+	}
+}
+
+func TestDrawPointSets(t *testing.T) {
+	o, err := model.NewReader(strings.NewReader("v 4 4 0 1 0 0\nv 10 10 0\nv 12 12 0\np 1 2\n")).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fb := tga.CreateTga(16, 16)
+	DrawPointSets(fb, NewZBuffer(fb), o, util.NewIdentity(4))
+	if fb.GetPixel(4, 4) != tga.NewColor(255, 0, 0, 255) || fb.GetPixel(10, 10) != tga.NewColor(255, 255, 255, 255) {
+		t.Errorf("referenced points are not drawn with their colors")
+	}
+	if fb.GetPixel(12, 12) != (tga.Color{}) {
+		t.Errorf("unreferenced vertex is drawn")
+	}
+}
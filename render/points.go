@@ -0,0 +1,107 @@
+package render
+
+import (
+	model "tinyrender-golang/model"
+	"tinyrender-golang/tga"
+	"tinyrender-golang/util"
+)
+
+// A PointOption is a functional option
+// which updates the point rendering settings
+type PointOption func(c *pointConfig)
+
+type pointConfig struct {
+	size      float64
+	radius    float64
+	oriented  bool
+	color     tga.Color
+	depthTest bool
+}
+
+// WithPointSize sets the radius of screen aligned splats in pixels, the
+// default is 1
+func WithPointSize(pixels float64) PointOption {
+	return func(c *pointConfig) {
+		c.size = pixels
+	}
+}
+
+// WithOrientedSplats draws every point as a disc of the given radius in
+// model units facing along its normal. Points need one normal each, see
+// DrawPoints, others stay screen aligned.
+func WithOrientedSplats(radius float64) PointOption {
+	return func(c *pointConfig) {
+		c.oriented = true
+		c.radius = radius
+	}
+}
+
+// WithPointColor sets the color of points without a vertex color, the
+// default is white
+func WithPointColor(color tga.Color) PointOption {
+	return func(c *pointConfig) {
+		c.color = color
+	}
+}
+
+// WithoutDepthTest draws points in order, ignoring and keeping the z-buffer
+func WithoutDepthTest() PointOption {
+	return func(c *pointConfig) {
+		c.depthTest = false
+	}
+}
+
+// DrawPoints draws every vertex of the object as a splat, faces are
+// ignored. The transform maps model space to screen space like
+// viewPort * projection * modelView in the lessons. Points use the colors
+// of the object's `v` lines when present. Oriented splats use Normals[i]
+// for vertex i when the object has one normal per vertex, as point clouds
+// with `vn` lines do.
+func DrawPoints(fb *tga.TGA, zBuffer []float64, o *model.Object, transform *util.Matrix, options ...PointOption) {
+	c := pointConfig{size: 1, color: tga.NewColor(255, 255, 255, 255), depthTest: true}
+	for _, opt := range options {
+		opt(&c)
+	}
+	if !c.depthTest {
+		zBuffer = nil
+	}
+	oriented := c.oriented && len(o.Normals) == len(o.Vertices)
+
+	for i := range o.Vertices {
+		p := util.NewVector3FromVertex(&o.Vertices[i])
+		center, ok := toScreen(transform, p)
+		if !ok {
+			continue
+		}
+
+		color := c.color
+		if i < len(o.Colors) {
+			color = toColor(o.Colors[i].R, o.Colors[i].G, o.Colors[i].B)
+		}
+
+		a := util.NewVec3(c.size, 0, 0)
+		b := util.NewVec3(0, c.size, 0)
+		if oriented {
+			n := util.NewVec3(o.Normals[i].X, o.Normals[i].Y, o.Normals[i].Z).Normalize()
+			u, v := tangents(n)
+			ea, okA := toScreen(transform, p.Add(u.Scale(c.radius)))
+			eb, okB := toScreen(transform, p.Add(v.Scale(c.radius)))
+			if !okA || !okB {
+				continue
+			}
+			a, b = ea.Sub(center), eb.Sub(center)
+		}
+
+		fb.DrawSplat(center, a, b, color, zBuffer)
+	}
+}
+
+// tangents returns two unit vectors perpendicular to n and each other
+func tangents(n util.Vector3) (util.Vector3, util.Vector3) {
+	axis := util.NewVec3(1, 0, 0)
+	if n.X*n.X > 0.5 {
+		axis = util.NewVec3(0, 1, 0)
+	}
+	u := n.CrossProduct(axis).Normalize()
+	return u, n.CrossProduct(u)
+}
@@ -0,0 +1,91 @@
+package render
+
+import (
+	"testing"
+	model "tinyrender-golang/model"
+	"tinyrender-golang/tga"
+	"tinyrender-golang/util"
+)
+
+func cloud(points ...model.Vertex) *model.Object {
+	o := &model.Object{}
+	for i, p := range points {
+		p.Index = int64(i + 1)
+		o.Vertices = append(o.Vertices, p)
+	}
+	return o
+}
+
+func covered(fb *tga.TGA, c tga.Color) int {
+	n := 0
+	for y := 0; y < fb.GetHeight(); y++ {
+		for x := 0; x < fb.GetWidth(); x++ {
+			if fb.GetPixel(x, y) == c {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestDrawPoints(t *testing.T) {
+	white := tga.NewColor(255, 255, 255, 255)
+	red := tga.NewColor(255, 0, 0, 255)
+
+	fb := tga.CreateTga(32, 32)
+	o := cloud(model.Vertex{X: 10, Y: 10}, model.Vertex{X: 20, Y: 20, Z: 1})
+	o.Colors = []model.VertexColor{{Index: 1, R: 1, G: 1, B: 1}, {Index: 2, R: 1}}
+	DrawPoints(fb, NewZBuffer(fb), o, util.NewIdentity(4), WithPointSize(3))
+
+	if fb.GetPixel(10, 10) != white || fb.GetPixel(12, 10) != white || fb.GetPixel(14, 10) == white {
+		t.Errorf("white splat has the wrong size")
+	}
+	if fb.GetPixel(20, 20) != red {
+		t.Errorf("vertex color is not used")
+	}
+	if n := covered(fb, white); n < 20 || n > 36 {
+		t.Errorf("white splat covers %d pixels, expected about 28", n)
+	}
+}
+
+func TestDrawPointsDepth(t *testing.T) {
+	near := tga.NewColor(0, 255, 0, 255)
+	far := tga.NewColor(0, 0, 255, 255)
+
+	fb := tga.CreateTga(16, 16)
+	zBuffer := NewZBuffer(fb)
+	DrawPoints(fb, zBuffer, cloud(model.Vertex{X: 8, Y: 8, Z: 1}), util.NewIdentity(4), WithPointColor(near))
+	DrawPoints(fb, zBuffer, cloud(model.Vertex{X: 8, Y: 8, Z: 0}), util.NewIdentity(4), WithPointColor(far))
+	if fb.GetPixel(8, 8) != near {
+		t.Errorf("far point is drawn over the near one")
+	}
+
+	DrawPoints(fb, zBuffer, cloud(model.Vertex{X: 8, Y: 8, Z: 0}), util.NewIdentity(4), WithPointColor(far), WithoutDepthTest())
+	if fb.GetPixel(8, 8) != far {
+		t.Errorf("depth test is not disabled")
+	}
+}
+
+func TestDrawOrientedSplats(t *testing.T) {
+	white := tga.NewColor(255, 255, 255, 255)
+
+	fb := tga.CreateTga(32, 32)
+	o := cloud(model.Vertex{X: 8, Y: 8}, model.Vertex{X: 24, Y: 24})
+	o.Normals = []model.Normal{{Index: 1, Z: 1}, {Index: 2, X: 1}}
+	DrawPoints(fb, NewZBuffer(fb), o, util.NewIdentity(4), WithOrientedSplats(4))
+
+	facing := 0
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			if fb.GetPixel(x, y) == white {
+				facing++
+			}
+		}
+	}
+	if facing < 40 || facing > 60 {
+		t.Errorf("facing splat covers %d pixels, expected about 50", facing)
+	}
+	if edge := covered(fb, white) - facing; edge != 1 {
+		t.Errorf("edge-on splat covers %d pixels, expected 1", edge)
+	}
+}
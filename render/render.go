@@ -0,0 +1,38 @@
+// Package render draws model objects into tga framebuffers with the
+// matrices and depth convention of the lessons: transforms map model space
+// to screen pixels and a larger Z is closer to the viewer.
+package render
+
+import (
+	"math"
+	"tinyrender-golang/tga"
+	"tinyrender-golang/util"
+)
+
+// NewZBuffer returns a depth buffer for the framebuffer where every pixel
+// is infinitely far away
+func NewZBuffer(fb *tga.TGA) []float64 {
+	zBuffer := make([]float64, fb.GetWidth()*fb.GetHeight())
+	for i := range zBuffer {
+		zBuffer[i] = -math.MaxFloat64
+	}
+	return zBuffer
+}
+
+// toScreen applies the transform with the perspective divide, points
+// behind the camera are reported as not visible
+func toScreen(transform *util.Matrix, p util.Vector3) (util.Vector3, bool) {
+	m := transform.Mul(util.NewFromVector3(p))
+	if m.Data[3][0] <= 0 {
+		return util.Vector3{}, false
+	}
+	return m.ToVector3(), true
+}
+
+// toColor converts color components from 0 to 1 into a tga color
+func toColor(r, g, b float64) tga.Color {
+	channel := func(v float64) byte {
+		return byte(math.Round(math.Max(0, math.Min(1, v)) * 255))
+	}
+	return tga.NewColor(channel(r), channel(g), channel(b), 255)
+}
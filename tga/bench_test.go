@@ -0,0 +1,53 @@
+package tga
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// benchmarkDecode decodes a 256x256 RLE file with metadata, from a reader
+// with random access and a stream
+func benchmarkDecode(b *testing.B, decode func(r io.Reader) error) {
+	data := encodeOptions(b, gradient(256, 256), &Options{RLE: true, Metadata: &Metadata{AuthorName: "bench"}})
+
+	for name, reader := range map[string]func() io.Reader{
+		"random": func() io.Reader { return bytes.NewReader(data) },
+		"stream": func() io.Reader { return streamReader{bytes.NewReader(data)} },
+	} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+
+			for i := 0; i < b.N; i++ {
+				if err := decode(reader()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecodeToTga(b *testing.B) {
+	benchmarkDecode(b, func(r io.Reader) error {
+		_, err := DecodeToTga(r)
+		return err
+	})
+}
+
+func BenchmarkDecodeInto(b *testing.B) {
+	dst := CreateTga(256, 256)
+
+	benchmarkDecode(b, func(r io.Reader) error {
+		return DecodeInto(dst, r, nil)
+	})
+}
+
+func BenchmarkDecodePixels(b *testing.B) {
+	pix := make([]byte, 4*256*256)
+
+	benchmarkDecode(b, func(r io.Reader) error {
+		_, err := DecodePixels(r, pix, nil)
+		return err
+	})
+}
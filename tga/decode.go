@@ -1,16 +1,20 @@
 package tga
 
 import (
-	"bytes"
 	"errors"
+	"fmt"
 	"image"
 	"image/color"
 	"io"
 )
 
 type TGA struct {
-	r             *bytes.Reader
+	r             *source
+	opts          DecodeOptions
 	raw           rawHeader
+	imageID       []byte
+	rle           bool
+	stampOffset   int64
 	isPaletted    bool
 	hasAlpha      bool
 	width         int
@@ -18,146 +22,463 @@ type TGA struct {
 	pixelSize     int
 	palette       []byte
 	paletteLength int
-	ColorModel    color.Model
+	colorModel    color.Model
+	Metadata      *Metadata
 	tmp           [4]byte
 	pixels        []byte
 	decode        func(tga *TGA, out []byte) (err error)
+
+	// run-length packet that continues into the next band of rows: the
+	// number of pixels left and whether they are raw or repeat tmp
+	run    int
+	runRaw bool
+
+	// into returns the caller's buffer for the pixels, see DecodeInto
+	into func(width, height int) ([]byte, error)
 }
 
 var (
 	ErrAlphaSize    = errors.New("TGA: invalid alpha size")
 	ErrFormat       = errors.New("TGA: invalid format")
 	ErrPaletteIndex = errors.New("TGA: palette index out of range")
+	ErrTooLarge     = errors.New("TGA: image exceeds the decode limits")
+	ErrDimensions   = errors.New("TGA: image size does not match the destination")
+)
+
+// FormatError reports a malformed file. It matches ErrFormat with errors.Is
+// and unwraps to the more specific error, if there is one: ErrAlphaSize,
+// ErrPaletteIndex or io.ErrUnexpectedEOF for truncated files.
+type FormatError struct {
+	Reason string
+	Err    error
+}
+
+func (e *FormatError) Error() string {
+	return "TGA: invalid format: " + e.Reason
+}
+
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
+
+func (e *FormatError) Is(target error) bool {
+	return target == ErrFormat
+}
+
+// LimitError is returned for images larger than the limits of
+// DecodeOptions, it matches ErrTooLarge with errors.Is.
+type LimitError struct {
+	Width  int
+	Height int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("TGA: %dx%d image exceeds the decode limits", e.Width, e.Height)
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrTooLarge
+}
+
+// Mode selects how strictly files are checked while decoding.
+type Mode int
+
+const (
+	// Normal rejects files that cannot be decoded, but accepts common
+	// deviations from the specification
+	Normal Mode = iota
+	// Strict also rejects files that break the TGA 2.0 specification:
+	// interleaved pixels, run-length packets crossing scanlines or the
+	// end of the image and extension areas of the wrong size
+	Strict
+	// Lenient decodes as much as possible: truncated pixel data leaves
+	// the rest of the image transparent, palette indices out of range
+	// decode as transparent pixels, invalid alpha sizes are ignored and
+	// metadata that cannot be read is dropped
+	Lenient
 )
 
-// Decode decodes a TARGA image.
+// DecodeOptions limit the images a decoder accepts and select its mode.
+// Limits of zero are not checked.
+type DecodeOptions struct {
+	MaxWidth  int
+	MaxHeight int
+	MaxPixels int
+	Mode      Mode
+}
+
+// DefaultDecodeOptions are used by Decode and DecodeToTga. They allow any
+// width and height up to 2^26 pixels, 8192x8192 or 256 MiB of decoded
+// pixels.
+var DefaultDecodeOptions = DecodeOptions{MaxPixels: 1 << 26}
+
+// Decode decodes a TARGA image with DefaultDecodeOptions. Readers
+// implementing io.ReaderAt with a known size are read at random, other
+// readers are streamed without buffering the pixel data.
 func Decode(r io.Reader) (outImage image.Image, err error) {
+	return DecodeWithOptions(r, nil)
+}
+
+// DecodeWithOptions decodes a TARGA image, nil options mean
+// DefaultDecodeOptions.
+func DecodeWithOptions(r io.Reader, o *DecodeOptions) (outImage image.Image, err error) {
 	var tga TGA
-	var data bytes.Buffer
 
-	if _, err = data.ReadFrom(r); err != nil {
+	if err = tga.read(r, o, true, false); err != nil {
 		return
 	}
 
-	tga.r = bytes.NewReader(data.Bytes())
+	return tga.Image(), nil
+}
+
+// DecodeToTga decodes a TARGA image including its metadata with
+// DefaultDecodeOptions.
+func DecodeToTga(r io.Reader) (tgaV *TGA, err error) {
+	return DecodeToTgaWithOptions(r, nil)
+}
+
+// DecodeToTgaWithOptions decodes a TARGA image including its metadata, nil
+// options mean DefaultDecodeOptions.
+func DecodeToTgaWithOptions(r io.Reader, o *DecodeOptions) (tgaV *TGA, err error) {
+	tgaV = &TGA{}
+	err = tgaV.read(r, o, true, true)
+
+	return
+}
+
+// DecodeInto decodes a TARGA image including its metadata into dst, reusing
+// its pixels. The image must have the size of dst, otherwise ErrDimensions
+// is returned. dst is only changed if decoding succeeds, apart from its
+// pixels. Nil options mean DefaultDecodeOptions.
+func DecodeInto(dst *TGA, r io.Reader, o *DecodeOptions) error {
+	pixels, w, h := dst.pixels, dst.width, dst.height
+	t := TGA{into: func(width, height int) ([]byte, error) {
+		if width != w || height != h || len(pixels) != 4*w*h {
+			return nil, fmt.Errorf("%w: %dx%d into %dx%d", ErrDimensions, width, height, w, h)
+		}
+		return pixels, nil
+	}}
+
+	if err := t.read(r, o, true, true); err != nil {
+		return err
+	}
+
+	t.into = nil
+	*dst = t
+
+	return nil
+}
+
+// DecodePixels decodes a TARGA image into pix, which must hold at least 4
+// bytes for every pixel, otherwise ErrDimensions is returned. The pixels are
+// stored from the top left like the Pix of *image.NRGBA or, if the returned
+// color model is color.RGBAModel, of *image.RGBA with a stride of 4 times
+// the width. Nil options mean DefaultDecodeOptions.
+func DecodePixels(r io.Reader, pix []byte, o *DecodeOptions) (cfg image.Config, err error) {
+	tga := TGA{into: func(width, height int) ([]byte, error) {
+		if len(pix) < 4*width*height {
+			return nil, fmt.Errorf("%w: %dx%d into %d bytes", ErrDimensions, width, height, len(pix))
+		}
+		return pix[:4*width*height], nil
+	}}
+
+	if err = tga.read(r, o, true, false); err == nil {
+		cfg = image.Config{
+			ColorModel: tga.colorModel,
+			Width:      tga.width,
+			Height:     tga.height,
+		}
+	}
+
+	return
+}
+
+// DecodeConfig decodes a header of TARGA image and returns its configuration.
+// Readers with random access are only read at the header and the footer.
+func DecodeConfig(r io.Reader) (cfg image.Config, err error) {
+	var tga TGA
+
+	if err = tga.read(r, nil, false, false); err == nil {
+		cfg = image.Config{
+			ColorModel: tga.colorModel,
+			Width:      tga.width,
+			Height:     tga.height,
+		}
+	}
+
+	return
+}
+
+// read decodes a TARGA file, the pixels into tga.pixels if withPixels is
+// set and the metadata if withMetadata is set.
+func (tga *TGA) read(r io.Reader, o *DecodeOptions, withPixels, withMetadata bool) (err error) {
+	if o == nil {
+		o = &DefaultDecodeOptions
+	}
+
+	tga.opts = *o
+	tga.r = newSource(r)
+
+	defer func() {
+		tga.r.consume()
+		tga.r.release()
+		tga.r = nil
+		err = formatError(err)
+	}()
 
 	if err = tga.getHeader(); err != nil {
 		return
 	}
 
-	// skip header
-	if _, err = tga.r.Seek(int64(tgaRawHeaderSize+tga.raw.IdLength), 0); err != nil {
+	if !withPixels && !withMetadata && tga.r.random() {
+		// the header and attribute type are all DecodeConfig needs
 		return
 	}
 
-	if tga.isPaletted {
-		// read palette
-		entrySize := int((tga.raw.PaletteBPP + 1) >> 3)
-		tga.paletteLength = int(tga.raw.PaletteLength - tga.raw.PaletteFirst)
-		tga.palette = make([]byte, entrySize*tga.paletteLength)
+	if withPixels {
+		if err = tga.checkLimits(); err != nil {
+			return
+		}
+	}
 
-		// skip to colormap
-		if _, err = tga.r.Seek(int64(entrySize)*int64(tga.raw.PaletteFirst), 1); err != nil {
+	if err = tga.readPalette(); err != nil {
+		return
+	}
+
+	if withPixels {
+		if err = tga.checkSize(); err != nil {
 			return
 		}
 
-		if _, err = io.ReadFull(tga.r, tga.palette); err != nil {
+		if err = tga.decodePixels(); err != nil {
+			if !tga.lenient(err) {
+				return
+			}
+
+			err = nil
+		}
+	} else if !tga.r.random() {
+		if err = tga.skipPixels(); err != nil {
+			return
+		}
+	}
+
+	if !tga.r.random() {
+		if err = tga.finishStream(); err != nil {
 			return
 		}
 	}
 
-	rect := image.Rect(0, 0, tga.width, tga.height)
-	var pixels []byte
+	if withPixels {
+		tga.flip(tga.pixels)
+	}
+
+	if withMetadata {
+		if err = tga.readExtensions(true); tga.lenient(err) {
+			tga.Metadata, err = nil, nil
+		}
+	}
+
+	return
+}
+
+// formatError turns errors caused by truncated files into a FormatError
+func formatError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return &FormatError{"truncated file", io.ErrUnexpectedEOF}
+	}
+	return err
+}
+
+// lenient reports whether the mode allows to continue after an error
+// caused by malformed data
+func (tga *TGA) lenient(err error) bool {
+	return tga.opts.Mode == Lenient && (errors.Is(err, ErrFormat) || err == io.EOF || err == io.ErrUnexpectedEOF)
+}
+
+// checkLimits compares the image size against the decode options
+func (tga *TGA) checkLimits() error {
+	o := tga.opts
+
+	if (o.MaxWidth > 0 && tga.width > o.MaxWidth) ||
+		(o.MaxHeight > 0 && tga.height > o.MaxHeight) ||
+		(o.MaxPixels > 0 && tga.width*tga.height > o.MaxPixels) {
+		return &LimitError{tga.width, tga.height}
+	}
+
+	return nil
+}
+
+// streamBand is the size of the bands of rows stream pixels are decoded in
+const streamBand = 1 << 20
+
+// decodePixels decodes the pixels into tga.pixels. Streams cannot be checked
+// against their size before, so instead of trusting the size in the header
+// their buffer grows by bands of rows as the pixel data arrives. In lenient
+// mode the missing rows of a truncated stream are added afterwards.
+func (tga *TGA) decodePixels() (err error) {
+	if tga.into != nil || tga.r.random() {
+		if err = tga.allocPixels(); err == nil {
+			err = tga.decode(tga, tga.pixels)
+		}
+		return
+	}
+
+	rowSize := 4 * tga.width
+	size := rowSize * tga.height
+	tga.pixels = make([]byte, 0, Min(size, streamBand))
 
-	// choose a right color model
-	if tga.ColorModel == color.NRGBAModel {
-		im := image.NewNRGBA(rect)
-		outImage = im
-		pixels = im.Pix
-	} else {
-		im := image.NewRGBA(rect)
-		outImage = im
-		pixels = im.Pix
+	for len(tga.pixels) < size && err == nil {
+		start := len(tga.pixels)
+		n := Min(size-start, Max(rowSize, streamBand/rowSize*rowSize))
+		tga.pixels = append(tga.pixels, make([]byte, n)...)
+		err = tga.decode(tga, tga.pixels[start:])
 	}
 
-	if err = tga.decode(&tga, pixels); err == nil {
-		tga.flip(pixels)
+	if err != nil && tga.lenient(err) {
+		tga.pixels = append(tga.pixels, make([]byte, size-len(tga.pixels))...)
 	}
 
 	return
 }
 
-func DecodeToTga(r io.Reader) (tgaV *TGA, err error) {
+// allocPixels sets tga.pixels to a new buffer or the caller's one. Buffers
+// that are reused are cleared first in lenient mode, which may not decode
+// every pixel.
+func (tga *TGA) allocPixels() (err error) {
+	if tga.into == nil {
+		tga.pixels = make([]byte, 4*tga.width*tga.height)
+		return
+	}
 
-	tgaV = &TGA{}
-	var data bytes.Buffer
+	if tga.pixels, err = tga.into(tga.width, tga.height); err == nil && tga.opts.Mode == Lenient {
+		for i := range tga.pixels {
+			tga.pixels[i] = 0
+		}
+	}
+
+	return
+}
+
+// checkSize rejects files with random access that are too small for their
+// pixels before they are allocated. Run-length packets hold at most 128
+// pixels.
+func (tga *TGA) checkSize() error {
+	if !tga.r.random() || tga.opts.Mode == Lenient {
+		return nil
+	}
 
-	if _, err = data.ReadFrom(r); err != nil {
+	n := int64(tga.width * tga.height)
+	need := n * int64(tga.pixelSize)
+
+	if tga.rle {
+		need = (n + 127) / 128 * int64(1+tga.pixelSize)
+	}
+
+	if tga.r.size-tga.r.pos < need {
+		return io.ErrUnexpectedEOF
+	}
+
+	return nil
+}
+
+// finishStream reads the tail of a stream and applies its attribute type,
+// which was unknown while decoding. Pixels decoded with an alpha channel
+// that the attribute type turns off become opaque.
+func (tga *TGA) finishStream() (err error) {
+	decodedAlpha := tga.hasAlpha
+
+	if err = tga.r.readTail(); err != nil {
 		return
 	}
 
-	tgaV.r = bytes.NewReader(data.Bytes())
+	tga.hasAlpha = tga.headerHasAlpha()
 
-	if err = tgaV.getHeader(); err != nil {
+	if err = tga.readExtensions(false); err != nil && !tga.lenient(err) {
+		return
+	} else if err = tga.validate(); err != nil {
 		return
 	}
 
+	if decodedAlpha && !tga.hasAlpha {
+		for i := 3; i < len(tga.pixels); i += 4 {
+			tga.pixels[i] = 0xff
+		}
+	}
+
+	return
+}
+
+// readPalette reads the image ID and the color map if there is one,
+// leaving the reader at the start of the pixels.
+func (tga *TGA) readPalette() (err error) {
 	// skip header
-	if _, err = tgaV.r.Seek(int64(tgaRawHeaderSize+tgaV.raw.IdLength), 0); err != nil {
+	if err = tga.r.seek(tgaRawHeaderSize); err != nil {
 		return
 	}
 
-	if tgaV.isPaletted {
+	tga.imageID = make([]byte, tga.raw.IdLength)
+
+	if _, err = io.ReadFull(tga.r, tga.imageID); err != nil {
+		return
+	}
+
+	if tga.isPaletted {
 		// read palette
-		entrySize := int((tgaV.raw.PaletteBPP + 1) >> 3)
-		tgaV.paletteLength = int(tgaV.raw.PaletteLength - tgaV.raw.PaletteFirst)
-		tgaV.palette = make([]byte, entrySize*tgaV.paletteLength)
+		entrySize := int((tga.raw.PaletteBPP + 1) >> 3)
+		tga.paletteLength = int(tga.raw.PaletteLength - tga.raw.PaletteFirst)
+		tga.palette = make([]byte, entrySize*tga.paletteLength)
 
 		// skip to colormap
-		if _, err = tgaV.r.Seek(int64(entrySize)*int64(tgaV.raw.PaletteFirst), 1); err != nil {
+		if err = tga.r.seek(tga.r.pos + int64(entrySize)*int64(tga.raw.PaletteFirst)); err != nil {
 			return
 		}
 
-		if _, err = io.ReadFull(tgaV.r, tgaV.palette); err != nil {
+		if _, err = io.ReadFull(tga.r, tga.palette); err != nil {
 			return
 		}
-	}
-
-	tgaV.pixels = make([]byte, 4*tgaV.width*tgaV.height)
-
-	if err = tgaV.decode(tgaV, tgaV.pixels); err == nil {
-		tgaV.flip(tgaV.pixels)
+	} else if tga.raw.PaletteType != 0 {
+		// skip the color map of a truecolor or monochrome image
+		entrySize := int64((tga.raw.PaletteBPP + 1) >> 3)
+		err = tga.r.seek(tga.r.pos + entrySize*int64(tga.raw.PaletteLength))
 	}
 
 	return
 }
 
-// DecodeConfig decodes a header of TARGA image and returns its configuration.
-func DecodeConfig(r io.Reader) (cfg image.Config, err error) {
-	var tga TGA
-	var data bytes.Buffer
+// skipPixels moves a stream past the pixel data without decoding it.
+func (tga *TGA) skipPixels() (err error) {
+	n := tga.width * tga.height
 
-	if _, err = data.ReadFrom(r); err != nil {
-		return
+	if !tga.rle {
+		return tga.r.seek(tga.r.pos + int64(n*tga.pixelSize))
 	}
 
-	tga.r = bytes.NewReader(data.Bytes())
+	for n > 0 {
+		var b byte
 
-	if err = tga.getHeader(); err == nil {
-		cfg = image.Config{
-			ColorModel: tga.ColorModel,
-			Width:      tga.width,
-			Height:     tga.height,
+		if b, err = tga.r.ReadByte(); err != nil {
+			return
+		}
+
+		count := int(b&0x7f) + 1
+		size := tga.pixelSize
+
+		if b&(1<<7) == 0 {
+			// raw packet
+			size *= count
+		}
+
+		if err = tga.r.seek(tga.r.pos + int64(size)); err != nil {
+			return
 		}
+
+		n -= count
 	}
 
 	return
 }
 
-func init() {
-	image.RegisterFormat("TGA", "", Decode, DecodeConfig)
-}
-
 // decodeRaw decodes a raw (uncompressed) data.
 func decodeRaw(tga *TGA, out []byte) (err error) {
 	for i := 0; i < len(out) && err == nil; i += 4 {
@@ -167,35 +488,42 @@ func decodeRaw(tga *TGA, out []byte) (err error) {
 	return
 }
 
-// decodeRLE decodes run-length encoded data.
+// decodeRLE decodes run-length encoded data, continuing the packet of the
+// previous band of rows. In strict mode packets must not cross scanlines or
+// the end of the image.
 func decodeRLE(tga *TGA, out []byte) (err error) {
-	size := tga.width * tga.height * 4
+	strict := tga.opts.Mode == Strict
 
-	for i := 0; i < size && err == nil; {
-		var b byte
+	for i := 0; i < len(out) && err == nil; {
+		if tga.run == 0 {
+			var b byte
 
-		if b, err = tga.r.ReadByte(); err != nil {
-			break
-		}
+			if b, err = tga.r.ReadByte(); err != nil {
+				break
+			}
 
-		count := uint(b)
+			tga.run = int(b&^(1<<7)) + 1
+			tga.runRaw = b&(1<<7) == 0
 
-		if count&(1<<7) != 0 {
-			// encoded packet
-			count &= ^uint(1 << 7)
+			if strict && (i/4)%tga.width+tga.run > tga.width {
+				return &FormatError{Reason: "run-length packet crosses a scanline"}
+			}
 
-			if err = tga.getPixel(tga.tmp[:]); err == nil {
-				for count++; count > 0 && i < size; count-- {
-					copy(out[i:], tga.tmp[:])
-					i += 4
+			if !tga.runRaw {
+				// encoded packet
+				if err = tga.getPixel(tga.tmp[:]); err != nil {
+					break
 				}
 			}
-		} else {
-			// raw packet
-			for count++; count > 0 && i < size && err == nil; count-- {
+		}
+
+		for ; tga.run > 0 && i < len(out) && err == nil; tga.run-- {
+			if tga.runRaw {
 				err = tga.getPixel(out[i:])
-				i += 4
+			} else {
+				copy(out[i:], tga.tmp[:])
 			}
+			i += 4
 		}
 	}
 
@@ -3,4 +3,7 @@
 // Supports RLE and raw TARGA images with 8/15/16/24/32 bits per pixel, monochrome, truecolor and colormapped images.
 // Correctly handles origins and attribute type in extensions area.
 // Passes TGA 2.0 conformance suite (http://googlesites.inequation.org/tgautilities).
+//
+// TARGA files have no magic number. Importing the package lets image.Decode recognize headers of the supported
+// pixel formats, Sniff checks a file more thoroughly.
 package tga
@@ -1,15 +1,128 @@
 package tga
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"image"
+	"image/color"
 	"image/draw"
 	"io"
 )
 
+var (
+	ErrBPP          = errors.New("TGA: unsupported bits per pixel")
+	ErrPaletteSize  = errors.New("TGA: more than 256 colors for a color-mapped image")
+	ErrPostageStamp = errors.New("TGA: postage stamp larger than 255x255")
+)
+
+// Origin is the corner of the image stored first in the file.
+type Origin int
+
+const (
+	OriginTopLeft Origin = iota
+	OriginBottomLeft
+	OriginTopRight
+	OriginBottomRight
+)
+
+// AttributeType describes the alpha channel in the extension area.
+type AttributeType byte
+
+const (
+	AttributeNoAlpha AttributeType = iota
+	AttributeUndefinedIgnore
+	AttributeUndefinedRetain
+	AttributeAlpha
+	AttributePremultipliedAlpha
+)
+
+// Dither selects how the error of colors reduced to a palette or to 15 and
+// 16 bits per pixel is spread over neighbouring pixels.
+type Dither int
+
+const (
+	// DitherNone picks the closest color for every pixel
+	DitherNone Dither = iota
+	// DitherFloydSteinberg diffuses the error of every pixel to the pixels
+	// right of and below it
+	DitherFloydSteinberg
+	// DitherOrdered offsets pixels by a 4x4 Bayer matrix, which keeps flat
+	// areas flat and compresses better with RLE
+	DitherOrdered
+)
+
+// Options configures EncodeWithOptions, a nil *Options encodes the same way
+// as Encode.
+type Options struct {
+	// BPP is the number of bits per pixel: 8 for monochrome or
+	// color-mapped images, 15 and 16 for 5-5-5 truecolor without and with a
+	// 1-bit alpha channel, 24 for BGR and 32 for BGRA. Zero picks 8 for
+	// *image.Gray and color-mapped images and 32 for everything else.
+	BPP int
+
+	// Origin is the corner the pixel data starts at, the decoded image
+	// looks the same for every origin.
+	Origin Origin
+
+	// RLE compresses pixels with run-length packets (image types 9, 10 and
+	// 11). Packets never cross scanlines.
+	RLE bool
+
+	// ColorMapped stores 8-bit indices into a palette of at most 256
+	// colors. *image.Paletted keeps its palette, other images use the
+	// colors they contain. The palette has 32-bit entries if any color is
+	// translucent and 24-bit entries otherwise.
+	ColorMapped bool
+
+	// Quantize reduces color-mapped images with more than 256 colors to a
+	// median cut palette of 256 colors instead of failing with
+	// ErrPaletteSize.
+	Quantize bool
+
+	// Dither spreads the error of colors reduced to the palette of a
+	// color-mapped image or to the 5-5-5 colors and 1-bit alpha of 15 and
+	// 16 bits per pixel. It is ignored for other pixel formats.
+	Dither Dither
+
+	// AttributeType is written to the extension area. Zero picks
+	// AttributePremultipliedAlpha for *image.RGBA and AttributeAlpha for
+	// other images if the output has alpha, and omits the extension area
+	// otherwise. With AttributePremultipliedAlpha colors are written
+	// premultiplied, with any other type they are not.
+	AttributeType AttributeType
+
+	// Metadata is written to the image ID field and the extension and
+	// developer areas. The extension area is always written if it is set.
+	Metadata *Metadata
+
+	// PostageStampSize generates a thumbnail fitting into a square of this
+	// size, at most 255, that replaces Metadata.PostageStamp. Colors are
+	// averaged, color-mapped images pick the center pixel instead so the
+	// thumbnail uses the image's palette.
+	PostageStampSize int
+}
+
 // Encode encodes an image into TARGA format.
 func Encode(w io.Writer, m image.Image) (err error) {
+	return EncodeWithOptions(w, m, nil)
+}
+
+// EncodeWithOptions encodes an image into TARGA format using the options.
+//
+// Encoding doesn't involve conversion if the image is *image.Gray written
+// as 8-bit monochrome, *image.RGBA with premultiplied alpha or *image.NRGBA
+// otherwise. A *TGA is encoded like the image returned by its Image method.
+func EncodeWithOptions(w io.Writer, m image.Image, o *Options) (err error) {
+	if o == nil {
+		o = &Options{}
+	}
+
+	if t, ok := m.(*TGA); ok {
+		m = t.Image()
+	}
+
 	b := m.Bounds()
 	mw, mh := b.Dx(), b.Dy()
 
@@ -22,84 +135,621 @@ func Encode(w io.Writer, m image.Image) (err error) {
 		return errors.New("uint16 width/height overflow")
 	}
 
-	h.Flags = flagOriginTop
+	if o.Metadata != nil {
+		if len(o.Metadata.ImageID) > 255 {
+			return ErrImageID
+		}
+		h.IdLength = uint8(len(o.Metadata.ImageID))
+	}
+
+	_, isGray := m.(*image.Gray)
+	bpp := o.BPP
+
+	if bpp == 0 {
+		if isGray || o.ColorMapped {
+			bpp = 8
+		} else {
+			bpp = 32
+		}
+	}
+
+	if (bpp != 8 && bpp != 15 && bpp != 16 && bpp != 24 && bpp != 32) || (o.ColorMapped && bpp != 8) {
+		return fmt.Errorf("%w: %d", ErrBPP, bpp)
+	}
+
+	attrType := o.AttributeType
 
-	switch tm := m.(type) {
-	case *image.Gray:
+	if attrType == 0 {
+		if _, ok := m.(*image.RGBA); ok {
+			attrType = AttributePremultipliedAlpha
+		} else {
+			attrType = AttributeAlpha
+		}
+	}
+
+	// colors are only premultiplied if the file keeps the alpha they were
+	// multiplied with, translucent colors would end up darkened otherwise
+	keepsAlpha := o.ColorMapped || bpp == 16 || bpp == 32
+	premultiplied := attrType == AttributePremultipliedAlpha && keepsAlpha
+	gray := bpp == 8 && !o.ColorMapped
+	src := newPixelSource(m, gray, premultiplied)
+	e := &encoder{pw: &pixelWriter{w: w, rle: o.RLE}, src: src, metadata: o.Metadata}
+	hasAlpha := false
+
+	if o.PostageStampSize > 0 {
+		e.stamp = thumbnail(src, Min(o.PostageStampSize, 255), o.ColorMapped, premultiplied)
+	} else if o.Metadata != nil && o.Metadata.PostageStamp != nil {
+		stamp := newPixelSource(o.Metadata.PostageStamp, gray, premultiplied)
+		if stamp.width > 255 || stamp.height > 255 {
+			return ErrPostageStamp
+		}
+		e.stamp = &stamp
+	}
+
+	switch {
+	case o.ColorMapped:
+		h.ImageType = imageTypePaletted
+		h.BPP = 8
+		if err = e.buildPalette(m, premultiplied, o.Quantize); err != nil {
+			return
+		}
+		if o.Dither != DitherNone {
+			// spread of a palette spaced evenly in the color cube
+			n := 1
+			for n*n*n < len(e.colors) {
+				n++
+			}
+			spread := 255 / n
+			e.src = dither(e.src, o.Dither, [4]int{spread, spread, spread, spread}, e.nearest)
+		}
+		h.PaletteType = 1
+		h.PaletteLength = uint16(len(e.palette) / e.paletteEntrySize)
+		h.PaletteBPP = uint8(e.paletteEntrySize * 8)
+		hasAlpha = e.paletteEntrySize == 4
+		e.pack = e.packIndex
+
+	case bpp == 8:
 		h.ImageType = imageTypeMonoChrome
-		err = encodeGray(w, tm, h)
+		h.BPP = 8
+		e.pack = packGray
 
-	case *image.NRGBA:
+	case bpp == 15 || bpp == 16:
+		// 15-bit files are stored as 16 bits per pixel without alpha bits,
+		// which is what most readers, including Decode, expect
 		h.ImageType = imageTypeTrueColor
-		err = encodeRGBA(w, tm, h, attrTypeAlpha)
+		h.BPP = 16
+		hasAlpha = bpp == 16
+		if hasAlpha {
+			h.Flags |= 1 // 1-bit alpha channel
+			e.pack = pack5551
+		} else {
+			e.pack = pack555
+		}
+		if o.Dither != DitherNone {
+			spread := [4]int{8, 8, 8, 0}
+			if hasAlpha {
+				spread[3] = 256
+			}
+			e.src = dither(e.src, o.Dither, spread, func(c [4]byte) [4]byte {
+				return round555(c, hasAlpha)
+			})
+		}
 
-	case *image.RGBA:
+	case bpp == 24:
 		h.ImageType = imageTypeTrueColor
-		err = encodeRGBA(w, (*image.NRGBA)(tm), h, attrTypePremultipliedAlpha)
+		h.BPP = 24
+		e.pack = packBGR
 
 	default:
-		// convert to non-premultiplied alpha by default
 		h.ImageType = imageTypeTrueColor
-		newm := image.NewNRGBA(b)
-		draw.Draw(newm, b, m, b.Min, draw.Src)
-		err = encodeRGBA(w, newm, h, attrTypeAlpha)
+		h.BPP = 32
+		h.Flags |= 8 // 8-bit alpha channel
+		hasAlpha = true
+		e.pack = packBGRA
+	}
+
+	switch o.Origin {
+	case OriginTopLeft:
+		h.Flags |= flagOriginTop
+	case OriginTopRight:
+		h.Flags |= flagOriginTop | flagOriginRight
+	case OriginBottomRight:
+		h.Flags |= flagOriginRight
+	}
+
+	if !hasAlpha && o.AttributeType == 0 {
+		// no alpha to describe
+		attrType = 0
+	}
+
+	return e.encode(h, attrType)
+}
+
+// pixelSource gives access to the rows of an image as gray or RGBA bytes,
+// converting it first if it has a different type.
+type pixelSource struct {
+	pix       []byte
+	stride    int
+	pixelSize int
+	width     int
+	height    int
+}
+
+func newPixelSource(m image.Image, gray, premultiplied bool) pixelSource {
+	b := m.Bounds()
+
+	switch {
+	case gray:
+		g, ok := m.(*image.Gray)
+		if !ok {
+			g = image.NewGray(b)
+			draw.Draw(g, b, m, b.Min, draw.Src)
+		}
+		return pixelSource{g.Pix, g.Stride, 1, b.Dx(), b.Dy()}
+
+	case premultiplied:
+		rgba, ok := m.(*image.RGBA)
+		if !ok {
+			rgba = image.NewRGBA(b)
+			draw.Draw(rgba, b, m, b.Min, draw.Src)
+		}
+		return pixelSource{rgba.Pix, rgba.Stride, 4, b.Dx(), b.Dy()}
+	}
+
+	nrgba, ok := m.(*image.NRGBA)
+	if !ok {
+		// convert to non-premultiplied alpha
+		nrgba = image.NewNRGBA(b)
+		draw.Draw(nrgba, b, m, b.Min, draw.Src)
+	}
+	return pixelSource{nrgba.Pix, nrgba.Stride, 4, b.Dx(), b.Dy()}
+}
+
+// pixel returns the bytes of pixel x, y relative to the image bounds. Pix
+// starts at Rect.Min, also for sub-images.
+func (s pixelSource) pixel(x, y int) []byte {
+	i := y*s.stride + x*s.pixelSize
+	return s.pix[i : i+s.pixelSize]
+}
+
+// thumbnail scales the source down to fit into a square of the given size.
+// Every pixel averages the source pixels it covers, weighted by alpha for
+// non-premultiplied colors, or copies the center one if nearest is set. It
+// returns nil for empty images.
+func thumbnail(src pixelSource, size int, nearest, premultiplied bool) *pixelSource {
+	w, h := src.width, src.height
+
+	if w == 0 || h == 0 {
+		return nil
+	}
+
+	tw, th := w, h
+
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, Max(1, (h*size+w/2)/w)
+		} else {
+			tw, th = Max(1, (w*size+h/2)/h), size
+		}
+	}
+
+	size = src.pixelSize
+	out := &pixelSource{make([]byte, tw*th*size), tw * size, size, tw, th}
+	weighted := size == 4 && !premultiplied
+
+	for y := 0; y < th; y++ {
+		y0 := y * h / th
+		y1 := Max(y0+1, (y+1)*h/th)
+
+		for x := 0; x < tw; x++ {
+			x0 := x * w / tw
+			x1 := Max(x0+1, (x+1)*w/tw)
+			dst := out.pixel(x, y)
+
+			if nearest {
+				copy(dst, src.pixel((x0+x1)/2, (y0+y1)/2))
+				continue
+			}
+
+			var sum [4]int
+			n := (x1 - x0) * (y1 - y0)
+
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					p := src.pixel(sx, sy)
+					weight := 1
+					if weighted {
+						weight = int(p[3])
+						sum[3] += weight
+					}
+					for i := 0; i < size && (i < 3 || !weighted); i++ {
+						sum[i] += int(p[i]) * weight
+					}
+				}
+			}
+
+			total := n
+			if weighted {
+				total = sum[3]
+				dst[3] = uint8((sum[3] + n/2) / n)
+			}
+			for i := 0; i < size && (i < 3 || !weighted); i++ {
+				if total != 0 {
+					dst[i] = uint8((sum[i] + total/2) / total)
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+// encoder converts source pixels to the file's pixel format.
+type encoder struct {
+	pw   *pixelWriter
+	src  pixelSource
+	pack func(dst, src []byte)
+
+	palette          []byte
+	paletteEntrySize int
+	colors           [][4]byte
+	index            map[[4]byte]byte
+
+	metadata *Metadata
+	stamp    *pixelSource
+}
+
+func packGray(dst, src []byte) {
+	dst[0] = src[0]
+}
+
+func packBGR(dst, src []byte) {
+	dst[0], dst[1], dst[2] = src[2], src[1], src[0]
+}
+
+func packBGRA(dst, src []byte) {
+	dst[0], dst[1], dst[2], dst[3] = src[2], src[1], src[0], src[3]
+}
+
+func pack555(dst, src []byte) {
+	word := bgrToWord(src[2], src[1], src[0])
+	dst[0], dst[1] = byte(word), byte(word>>8)
+}
+
+func pack5551(dst, src []byte) {
+	word := bgrToWord(src[2], src[1], src[0])
+	if src[3] >= 0x80 {
+		word |= 1 << 15
+	}
+	dst[0], dst[1] = byte(word), byte(word>>8)
+}
+
+// bgrToWord converts BGR to 15-bit color, the inverse of wordToBGR
+func bgrToWord(B, G, R uint8) uint16 {
+	return uint16(B>>3) | uint16(G>>3)<<5 | uint16(R>>3)<<10
+}
+
+func (e *encoder) packIndex(dst, src []byte) {
+	dst[0] = e.lookup([4]byte{src[0], src[1], src[2], src[3]})
+}
+
+// nearest returns the palette color closest to c
+func (e *encoder) nearest(c [4]byte) [4]byte {
+	return e.colors[e.lookup(c)]
+}
+
+// lookup returns the palette index of a color, colors missing from the
+// palette of a quantized image or a given postage stamp get the closest
+// entry
+func (e *encoder) lookup(c [4]byte) (i byte) {
+	i, ok := e.index[c]
+
+	if !ok {
+		best := -1
+		for j, p := range e.colors {
+			d := 0
+			for k := range p {
+				d += (int(p[k]) - int(c[k])) * (int(p[k]) - int(c[k]))
+			}
+			if best < 0 || d < best {
+				best, i = d, byte(j)
+			}
+		}
+		e.index[c] = i
 	}
 
 	return
 }
 
-func encodeGray(w io.Writer, m *image.Gray, h rawHeader) (err error) {
-	h.BPP = 8 // 8-bit monochrome
+// buildPalette collects the colors of the image, starting with the palette
+// of an *image.Paletted so its indices are kept. Images with more than 256
+// colors get a median cut palette if quantize is set.
+func (e *encoder) buildPalette(m image.Image, premultiplied, quantize bool) error {
+	var colors [][4]byte
+	e.index = make(map[[4]byte]byte)
+
+	add := func(c [4]byte) bool {
+		if _, ok := e.index[c]; ok {
+			return true
+		}
+		if len(colors) == 256 {
+			return false
+		}
+		e.index[c] = byte(len(colors))
+		colors = append(colors, c)
+		return true
+	}
+
+	if p, ok := m.(*image.Paletted); ok {
+		model := color.NRGBAModel
+		if premultiplied {
+			model = color.RGBAModel
+		}
+		for _, c := range p.Palette {
+			add(colorBytes(model.Convert(c)))
+		}
+	}
 
-	if err = binary.Write(w, binary.LittleEndian, &h); err != nil {
+	full := false
+	b := m.Bounds()
+	for y := 0; y < b.Dy() && !full; y++ {
+		for x := 0; x < b.Dx() && !full; x++ {
+			var c [4]byte
+			copy(c[:], e.src.pixel(x, y))
+			full = !add(c)
+		}
+	}
+
+	if full {
+		if !quantize {
+			return ErrPaletteSize
+		}
+
+		colors = medianCut(e.src, 256)
+		e.index = make(map[[4]byte]byte)
+		for i := len(colors) - 1; i >= 0; i-- {
+			e.index[colors[i]] = byte(i)
+		}
+	}
+
+	if len(colors) == 0 {
+		// an empty palette is invalid
+		colors = append(colors, [4]byte{0, 0, 0, 0xff})
+	}
+
+	e.colors = colors
+
+	e.paletteEntrySize = 3
+	for _, c := range colors {
+		if c[3] != 0xff {
+			e.paletteEntrySize = 4
+			break
+		}
+	}
+
+	pack := packBGR
+	if e.paletteEntrySize == 4 {
+		pack = packBGRA
+	}
+	e.palette = make([]byte, len(colors)*e.paletteEntrySize)
+	for i, c := range colors {
+		pack(e.palette[i*e.paletteEntrySize:], c[:])
+	}
+
+	return nil
+}
+
+func colorBytes(c color.Color) [4]byte {
+	switch c := c.(type) {
+	case color.NRGBA:
+		return [4]byte{c.R, c.G, c.B, c.A}
+	case color.RGBA:
+		return [4]byte{c.R, c.G, c.B, c.A}
+	}
+	r, g, b, a := c.RGBA()
+	return [4]byte{byte(r >> 8), byte(g >> 8), byte(b >> 8), byte(a >> 8)}
+}
+
+// encode writes the header, image ID, palette and pixels in the order of
+// the origin, followed by the developer area and the extension area with
+// its tables if there is metadata, a postage stamp or an attribute type,
+// and the footer
+func (e *encoder) encode(h rawHeader, attrType AttributeType) (err error) {
+	md := e.metadata
+
+	if err = e.pw.writeHeader(h); err != nil {
+		return
+	}
+
+	if md != nil {
+		if _, err = e.pw.Write(md.ImageID); err != nil {
+			return
+		}
+	}
+
+	if _, err = e.pw.Write(e.palette); err != nil {
 		return
 	}
 
-	offset := -(m.Rect.Min.Y*m.Stride + m.Rect.Min.X)
-	max := offset + int(h.Height)*m.Stride
+	scanLines, err := e.writePixels(e.src, h.Flags, e.pw.rle)
+	if err != nil {
+		return
+	}
 
-	for ; offset < max; offset += m.Stride {
-		if _, err = w.Write(m.Pix[offset : offset+int(h.Width)]); err != nil {
+	footer := newFooter()
+
+	if md != nil && len(md.Developer) > 0 {
+		if footer.DevDirOffset, err = writeDeveloperArea(e.pw, md.Developer); err != nil {
 			return
 		}
 	}
 
-	// no extension area, only a footer
-	err = binary.Write(w, binary.LittleEndian, newFooter())
+	if md == nil && attrType == 0 && e.stamp == nil {
+		// no extension area, only a footer
+		return binary.Write(e.pw, binary.LittleEndian, footer)
+	}
 
-	return
-}
+	// the tables follow the extension area
+	var offsets extOffsets
+	footer.ExtAreaOffset = uint32(e.pw.n)
+	next := footer.ExtAreaOffset + extAreaSize
+
+	if md != nil && len(md.ColorCorrection) > 0 {
+		offsets.colorCorrection = next
+		next += colorCorrectionSize
+	}
 
-func encodeRGBA(w io.Writer, m *image.NRGBA, h rawHeader, attrType byte) (err error) {
-	h.BPP = 32   // always save as 32-bit (faster this way)
-	h.Flags |= 8 // 8-bit alpha channel
+	if e.stamp != nil {
+		offsets.postageStamp = next
+		next += uint32(2 + e.stamp.width*e.stamp.height*e.pw.pixelSize)
+	}
+
+	if md != nil && md.ScanLines != nil {
+		offsets.scanLine = next
+	}
 
-	if err = binary.Write(w, binary.LittleEndian, &h); err != nil {
+	if _, err = e.pw.Write(md.extArea(byte(attrType), offsets)); err != nil {
 		return
 	}
 
-	lineSize := int(h.Width) * 4
-	offset := -m.Rect.Min.Y*m.Stride - m.Rect.Min.X*4
-	max := offset + int(h.Height)*m.Stride
-	b := make([]byte, lineSize)
+	if offsets.colorCorrection != 0 {
+		if _, err = e.pw.Write(colorCorrectionBytes(md.ColorCorrection)); err != nil {
+			return
+		}
+	}
 
-	for ; offset < max; offset += m.Stride {
-		copy(b, m.Pix[offset:offset+lineSize])
+	if e.stamp != nil {
+		if _, err = e.pw.Write([]byte{byte(e.stamp.width), byte(e.stamp.height)}); err != nil {
+			return
+		} else if _, err = e.writePixels(*e.stamp, h.Flags, false); err != nil {
+			return
+		}
+	}
 
-		for i := 0; i < lineSize; i += 4 {
-			b[i+0], b[i+2] = b[i+2], b[i+0] // RGBA -> BGRA
+	if offsets.scanLine != 0 {
+		if err = binary.Write(e.pw, binary.LittleEndian, scanLines); err != nil {
+			return
 		}
+	}
+
+	return binary.Write(e.pw, binary.LittleEndian, footer)
+}
 
-		if _, err = w.Write(b); err != nil {
+// writePixels writes the scanlines of src in the order of the origin in
+// flags and returns their offsets
+func (e *encoder) writePixels(src pixelSource, flags uint8, rle bool) (scanLines []uint32, err error) {
+	right := flags&flagOriginRight != 0
+	top := flags&flagOriginTop != 0
+	line := make([]byte, src.width*e.pw.pixelSize)
+
+	for row := 0; row < src.height; row++ {
+		y := row
+		if !top {
+			y = src.height - row - 1
+		}
+
+		for col := 0; col < src.width; col++ {
+			x := col
+			if right {
+				x = src.width - col - 1
+			}
+			e.pack(line[col*e.pw.pixelSize:], src.pixel(x, y))
+		}
+
+		scanLines = append(scanLines, uint32(e.pw.n))
+
+		if rle {
+			err = e.pw.writeLine(line)
+		} else {
+			_, err = e.pw.Write(line)
+		}
+
+		if err != nil {
 			return
 		}
 	}
 
-	// add extension area and footer to define attribute type
-	_, err = w.Write(newExtArea(attrType))
-	footer := newFooter()
-	footer.ExtAreaOffset = uint32(tgaRawHeaderSize + int(h.Height)*lineSize)
-	err = binary.Write(w, binary.LittleEndian, footer)
+	return
+}
+
+// pixelWriter writes the header and scanlines of an image, raw or run-length
+// encoded, and counts the bytes written so far.
+type pixelWriter struct {
+	w         io.Writer
+	rle       bool
+	pixelSize int
+	n         int
+	packets   []byte
+}
 
+func (pw *pixelWriter) Write(b []byte) (n int, err error) {
+	n, err = pw.w.Write(b)
+	pw.n += n
 	return
 }
+
+func (pw *pixelWriter) writeHeader(h rawHeader) error {
+	pw.pixelSize = int(h.BPP) >> 3
+
+	if pw.rle {
+		h.ImageType |= imageTypeFlagRLE
+	}
+
+	return binary.Write(pw, binary.LittleEndian, &h)
+}
+
+// writeLine writes one scanline of pixels in file order.
+func (pw *pixelWriter) writeLine(line []byte) (err error) {
+	if !pw.rle {
+		_, err = pw.Write(line)
+		return
+	}
+
+	pw.packets = appendRLE(pw.packets[:0], line, pw.pixelSize)
+	_, err = pw.Write(pw.packets)
+
+	return
+}
+
+// appendRLE appends the run-length packets of a scanline to dst. Runs of
+// equal pixels become run packets as soon as that is not larger than
+// keeping them in a raw packet, everything else goes into raw packets.
+func appendRLE(dst, line []byte, pixelSize int) []byte {
+	n := len(line) / pixelSize
+	pixel := func(i int) []byte {
+		return line[i*pixelSize : (i+1)*pixelSize]
+	}
+
+	// splitting a raw packet costs a header byte, a run of two single byte
+	// pixels does not pay for it
+	minRun := 2
+	if pixelSize == 1 {
+		minRun = 3
+	}
+
+	runLength := func(i, max int) int {
+		run := 1
+		for i+run < n && run < max && bytes.Equal(pixel(i), pixel(i+run)) {
+			run++
+		}
+		return run
+	}
+
+	for i := 0; i < n; {
+		if run := runLength(i, 128); run >= minRun {
+			dst = append(dst, byte(0x80|(run-1)))
+			dst = append(dst, pixel(i)...)
+			i += run
+			continue
+		}
+
+		start := i
+		for i < n && i-start < 128 && (i == start || runLength(i, minRun) < minRun) {
+			i++
+		}
+		dst = append(dst, byte(i-start-1))
+		dst = append(dst, line[start*pixelSize:i*pixelSize]...)
+	}
+
+	return dst
+}
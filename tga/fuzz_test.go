@@ -0,0 +1,57 @@
+//go:build go1.18
+
+package tga
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func FuzzDecode(f *testing.F) {
+	for _, data := range streamTestFiles(f) {
+		f.Add(data)
+	}
+
+	limits := &DecodeOptions{MaxPixels: 1 << 20}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		cfg, cfgErr := DecodeConfig(bytes.NewReader(data))
+
+		for _, mode := range []Mode{Normal, Strict, Lenient} {
+			o := *limits
+			o.Mode = mode
+
+			m, err := DecodeWithOptions(bytes.NewReader(data), &o)
+			checkFuzzError(t, err)
+
+			if err == nil {
+				if cfgErr != nil {
+					if mode != Lenient {
+						t.Fatalf("mode %d: decoded, but DecodeConfig failed: %v", mode, cfgErr)
+					}
+				} else if b := m.Bounds(); b.Dx() != cfg.Width || b.Dy() != cfg.Height {
+					t.Fatalf("mode %d: decoded %v, DecodeConfig reported %dx%d", mode, b, cfg.Width, cfg.Height)
+				}
+			}
+
+			_, err = DecodeWithOptions(streamReader{bytes.NewReader(data)}, &o)
+			checkFuzzError(t, err)
+
+			_, err = DecodeToTgaWithOptions(bytes.NewReader(data), &o)
+			checkFuzzError(t, err)
+		}
+
+		_, err := DecodeMetadata(bytes.NewReader(data))
+		checkFuzzError(t, err)
+	})
+}
+
+// checkFuzzError fails for errors other than the typed decode errors
+func checkFuzzError(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil && !errors.Is(err, ErrFormat) && !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("untyped error %v", err)
+	}
+}
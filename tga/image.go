@@ -0,0 +1,103 @@
+package tga
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// *TGA is an image.Image and a draw.Image, so it works with image/draw and
+// the image encoders directly. Image returns a view of the pixels that the
+// standard library has fast paths for.
+var (
+	_ image.Image = (*TGA)(nil)
+	_ draw.Image  = (*TGA)(nil)
+)
+
+// CreateTgaFromImage copies an image into a new TGA. *image.RGBA keeps its
+// premultiplied colors, other images are converted to non-premultiplied
+// ones.
+func CreateTgaFromImage(m image.Image) *TGA {
+	b := m.Bounds()
+	t := CreateTga(b.Dx(), b.Dy())
+
+	if _, ok := m.(*image.RGBA); ok {
+		t.colorModel = color.RGBAModel
+	}
+
+	draw.Draw(t.Image(), t.Bounds(), m, b.Min, draw.Src)
+
+	return t
+}
+
+// ColorModel returns color.RGBAModel for images with premultiplied alpha and
+// color.NRGBAModel otherwise.
+func (tga *TGA) ColorModel() color.Model {
+	return tga.colorModel
+}
+
+// Bounds returns the image size, the top left pixel is at 0, 0.
+func (tga *TGA) Bounds() image.Rectangle {
+	return image.Rect(0, 0, tga.width, tga.height)
+}
+
+// At returns the color of a pixel, color.NRGBA or color.RGBA depending on
+// the color model.
+func (tga *TGA) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(tga.Bounds())) {
+		if tga.colorModel == color.RGBAModel {
+			return color.RGBA{}
+		}
+		return color.NRGBA{}
+	}
+
+	p := tga.pixels[(y*tga.width+x)*4:]
+
+	if tga.colorModel == color.RGBAModel {
+		return color.RGBA{p[0], p[1], p[2], p[3]}
+	}
+
+	return color.NRGBA{p[0], p[1], p[2], p[3]}
+}
+
+// Set converts a color to the color model and stores it, pixels outside the
+// bounds are ignored.
+func (tga *TGA) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(tga.Bounds())) {
+		return
+	}
+
+	p := tga.pixels[(y*tga.width+x)*4:]
+
+	switch c := tga.colorModel.Convert(c).(type) {
+	case color.RGBA:
+		p[0], p[1], p[2], p[3] = c.R, c.G, c.B, c.A
+	case color.NRGBA:
+		p[0], p[1], p[2], p[3] = c.R, c.G, c.B, c.A
+	}
+}
+
+// Opaque scans the image and reports whether it is fully opaque.
+func (tga *TGA) Opaque() bool {
+	for i := 3; i < len(tga.pixels); i += 4 {
+		if tga.pixels[i] != 0xff {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Image returns an *image.NRGBA or *image.RGBA, depending on the color
+// model, sharing the pixels of the TGA. Drawing into it changes the TGA,
+// image/draw and the image encoders have fast paths for both types.
+func (tga *TGA) Image() draw.Image {
+	rect := tga.Bounds()
+	stride := 4 * tga.width
+
+	if tga.colorModel == color.RGBAModel {
+		return &image.RGBA{Pix: tga.pixels, Stride: stride, Rect: rect}
+	}
+
+	return &image.NRGBA{Pix: tga.pixels, Stride: stride, Rect: rect}
+}
@@ -0,0 +1,92 @@
+package tga
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"testing"
+)
+
+func TestImageInterface(t *testing.T) {
+	img := CreateTga(4, 3)
+	if img.Bounds() != image.Rect(0, 0, 4, 3) || img.ColorModel() != color.NRGBAModel {
+		t.Fatalf("bounds %v, model %v", img.Bounds(), img.ColorModel())
+	}
+
+	img.Set(1, 2, color.RGBA{100, 50, 0, 128})
+	if got, want := img.At(1, 2), color.NRGBAModel.Convert(color.RGBA{100, 50, 0, 128}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if c := img.GetPixel(1, 2); c.A != 128 {
+		t.Errorf("GetPixel returned %v", c)
+	}
+
+	// out of bounds pixels are ignored
+	img.Set(-1, 0, color.White)
+	img.Set(4, 0, color.White)
+	if img.At(4, 0) != (color.NRGBA{}) {
+		t.Errorf("pixel outside the bounds is %v", img.At(4, 0))
+	}
+}
+
+func TestImageDraw(t *testing.T) {
+	src := quadrants(8, 8)
+
+	// the generic draw.Image path and the fast path through Image give the
+	// same result
+	slow, fast := CreateTga(8, 8), CreateTga(8, 8)
+	draw.Draw(slow, slow.Bounds(), src, image.Point{}, draw.Src)
+	draw.Draw(fast.Image(), fast.Bounds(), src, image.Point{}, draw.Src)
+	if !bytes.Equal(slow.pixels, fast.pixels) || !bytes.Equal(fast.pixels, src.Pix) {
+		t.Fatalf("drawn pixels differ")
+	}
+
+	// *TGA works as a source of the standard library encoders
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, slow); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameColor(decoded.At(7, 7), src.At(7, 7)) {
+		t.Errorf("png pixel is %v, want %v", decoded.At(7, 7), src.At(7, 7))
+	}
+	if !slow.Opaque() {
+		t.Errorf("opaque image reports translucency")
+	}
+}
+
+func TestCreateTgaFromImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(2, 3, 6, 5))
+	src.SetRGBA(2, 3, color.RGBA{50, 40, 30, 128})
+
+	img := CreateTgaFromImage(src)
+	if img.ColorModel() != color.RGBAModel || img.Bounds() != image.Rect(0, 0, 4, 2) {
+		t.Fatalf("model %v, bounds %v", img.ColorModel(), img.Bounds())
+	}
+	if got := img.At(0, 0); got != (color.RGBA{50, 40, 30, 128}) {
+		t.Errorf("got %v", got)
+	}
+	if _, ok := img.Image().(*image.RGBA); !ok {
+		t.Errorf("Image returned %T", img.Image())
+	}
+	if img.Opaque() {
+		t.Errorf("translucent image reports opaque")
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decoded.At(0, 0); got != (color.RGBA{50, 40, 30, 128}) {
+		t.Errorf("encoded *TGA decodes to %v", got)
+	}
+}
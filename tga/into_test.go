@@ -0,0 +1,97 @@
+package tga
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestDecodeInto(t *testing.T) {
+	data := encodeOptions(t, gradient(9, 7), &Options{RLE: true, Metadata: fullMetadata()})
+	want, err := DecodeToTga(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := CreateTga(9, 7)
+	pixels := dst.pixels
+
+	for name, r := range map[string]func() io.Reader{
+		"random": func() io.Reader { return bytes.NewReader(data) },
+		"stream": func() io.Reader { return streamReader{bytes.NewReader(data)} },
+	} {
+		if err := DecodeInto(dst, r(), nil); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if &dst.pixels[0] != &pixels[0] {
+			t.Errorf("%s: pixels were not reused", name)
+		}
+		if !reflect.DeepEqual(dst.Image(), want.Image()) || !reflect.DeepEqual(dst.Metadata, want.Metadata) {
+			t.Errorf("%s: decoded image differs", name)
+		}
+	}
+
+	small := CreateTga(7, 9)
+	if err := DecodeInto(small, bytes.NewReader(data), nil); !errors.Is(err, ErrDimensions) {
+		t.Errorf("got %v for a 7x9 destination", err)
+	}
+	if small.GetWidth() != 7 || small.GetHeight() != 9 {
+		t.Errorf("destination changed to %v", small.Bounds())
+	}
+}
+
+func TestDecodePixels(t *testing.T) {
+	src := gradient(9, 7)
+	data := encodeOptions(t, src, nil)
+
+	pix := make([]byte, 4*9*7+10)
+	cfg, err := DecodePixels(bytes.NewReader(data), pix, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 9 || cfg.Height != 7 || !bytes.Equal(pix[:4*9*7], src.Pix) {
+		t.Errorf("decoded %+v, %v", cfg, pix)
+	}
+
+	if _, err := DecodePixels(bytes.NewReader(data), pix[:4*9*7-1], nil); !errors.Is(err, ErrDimensions) {
+		t.Errorf("got %v for a short buffer", err)
+	}
+
+	// lenient decoding clears what it cannot decode
+	for i := range pix {
+		pix[i] = 0xaa
+	}
+	truncated := data[:tgaRawHeaderSize+4*9]
+	if _, err := DecodePixels(bytes.NewReader(truncated), pix, &DecodeOptions{Mode: Lenient}); err != nil {
+		t.Fatal(err)
+	}
+	m := &image.NRGBA{Pix: pix, Stride: 4 * 9, Rect: image.Rect(0, 0, 9, 7)}
+	if m.NRGBAAt(0, 0) != src.NRGBAAt(0, 0) || m.NRGBAAt(0, 1).A != 0 {
+		t.Errorf("decoded %v and %v", m.NRGBAAt(0, 0), m.NRGBAAt(0, 1))
+	}
+}
+
+func TestDecodeConcurrently(t *testing.T) {
+	files := streamTestFiles(t)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name, data := range files {
+				random, err0 := Decode(bytes.NewReader(data))
+				stream, err1 := Decode(streamReader{bytes.NewReader(data)})
+				if err0 != nil || err1 != nil || !reflect.DeepEqual(random, stream) {
+					t.Errorf("%s: %v, %v", name, err0, err1)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,216 @@
+package tga
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/color"
+	"io"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestDecodeLimits(t *testing.T) {
+	data := encodeOptions(t, gradient(8, 4), nil)
+
+	for _, o := range []DecodeOptions{{MaxWidth: 7}, {MaxHeight: 3}, {MaxPixels: 31}} {
+		_, err := DecodeWithOptions(bytes.NewReader(data), &o)
+
+		var limit *LimitError
+		if !errors.As(err, &limit) || !errors.Is(err, ErrTooLarge) || limit.Width != 8 || limit.Height != 4 {
+			t.Errorf("%+v: got %v", o, err)
+		}
+	}
+
+	for _, o := range []DecodeOptions{{}, {MaxWidth: 8, MaxHeight: 4, MaxPixels: 32}} {
+		if _, err := DecodeWithOptions(bytes.NewReader(data), &o); err != nil {
+			t.Errorf("%+v: %v", o, err)
+		}
+	}
+
+	// a header claiming 65535x65535 pixels is rejected before allocating
+	binary.LittleEndian.PutUint16(data[12:], 0xffff)
+	binary.LittleEndian.PutUint16(data[14:], 0xffff)
+	if _, err := Decode(streamReader{bytes.NewReader(data)}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got %v for a huge stream", err)
+	}
+	if _, err := DecodeWithOptions(bytes.NewReader(data), &DecodeOptions{}); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v for a huge file", err)
+	}
+
+	// DecodeConfig does not apply limits
+	if cfg, err := DecodeConfig(bytes.NewReader(data)); err != nil || cfg.Width != 0xffff {
+		t.Errorf("got %+v, %v", cfg, err)
+	}
+}
+
+func TestDecodeTruncatedPixels(t *testing.T) {
+	data := encodeOptions(t, gradient(4, 4), &Options{BPP: 24, Origin: OriginBottomLeft})
+	data = data[:tgaRawHeaderSize+3*6]
+
+	for name, r := range map[string]io.Reader{
+		"random": bytes.NewReader(data),
+		"stream": streamReader{bytes.NewReader(data)},
+	} {
+		_, err := Decode(r)
+
+		var format *FormatError
+		if !errors.As(err, &format) || !errors.Is(err, ErrFormat) || !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+
+	lenient := &DecodeOptions{Mode: Lenient}
+	for name, r := range map[string]io.Reader{
+		"random": bytes.NewReader(data),
+		"stream": streamReader{bytes.NewReader(data)},
+	} {
+		m, err := DecodeWithOptions(r, lenient)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		// the bottom row and a half survive, the rest is transparent
+		if c := m.At(0, 3); !sameColor(c, color.NRGBA{0, 120, 5, 255}) {
+			t.Errorf("%s: decoded pixel is %v", name, c)
+		}
+		if _, _, _, a := m.At(2, 2).RGBA(); a != 0 {
+			t.Errorf("%s: missing pixel has alpha %d", name, a)
+		}
+	}
+}
+
+func TestDecodeModes(t *testing.T) {
+	src := quadrants(4, 4)
+
+	// palette index out of range
+	data := encodeOptions(t, src, &Options{ColorMapped: true})
+	data[len(data)-tgaRawFooterSize-1] = 0xff
+	if _, err := Decode(bytes.NewReader(data)); !errors.Is(err, ErrPaletteIndex) || !errors.Is(err, ErrFormat) {
+		t.Errorf("got %v for a bad palette index", err)
+	}
+	if _, err := DecodeWithOptions(bytes.NewReader(data), &DecodeOptions{Mode: Lenient}); err != nil {
+		t.Errorf("lenient: %v", err)
+	}
+
+	// invalid alpha size
+	data = encodeOptions(t, src, nil)
+	data[17] |= 3
+	if _, err := Decode(bytes.NewReader(data)); !errors.Is(err, ErrAlphaSize) {
+		t.Errorf("got %v for a bad alpha size", err)
+	}
+	if _, err := DecodeWithOptions(bytes.NewReader(data), &DecodeOptions{Mode: Lenient}); err != nil {
+		t.Errorf("lenient: %v", err)
+	}
+
+	// interleaving bits
+	data = encodeOptions(t, src, nil)
+	data[17] |= 0x40
+	if _, err := Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("normal: %v", err)
+	}
+	if _, err := DecodeWithOptions(bytes.NewReader(data), &DecodeOptions{Mode: Strict}); !errors.Is(err, ErrFormat) {
+		t.Errorf("got %v for interleaved pixels", err)
+	}
+
+	// a run-length packet of a whole image crosses every scanline
+	data = encodeOptions(t, gradient(1, 1), &Options{BPP: 24, RLE: true})
+	binary.LittleEndian.PutUint16(data[12:], 4)
+	binary.LittleEndian.PutUint16(data[14:], 4)
+	data[tgaRawHeaderSize] = 0x80 | 15
+	for _, mode := range []Mode{Normal, Lenient} {
+		if _, err := DecodeWithOptions(bytes.NewReader(data), &DecodeOptions{Mode: mode}); err != nil {
+			t.Errorf("mode %d: %v", mode, err)
+		}
+	}
+	if _, err := DecodeWithOptions(bytes.NewReader(data), &DecodeOptions{Mode: Strict}); !errors.Is(err, ErrFormat) {
+		t.Errorf("got %v for a packet crossing scanlines", err)
+	}
+
+	// extension area of the wrong size
+	data = encodeOptions(t, src, &Options{Metadata: &Metadata{AuthorName: "A"}})
+	ext := binary.LittleEndian.Uint32(data[len(data)-tgaRawFooterSize:])
+	data[ext]++
+	if _, err := Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("normal: %v", err)
+	}
+	if _, err := DecodeWithOptions(bytes.NewReader(data), &DecodeOptions{Mode: Strict}); !errors.Is(err, ErrFormat) {
+		t.Errorf("got %v for a bad extension area", err)
+	}
+}
+
+func TestDecodeBrokenMetadata(t *testing.T) {
+	md := &Metadata{Developer: []DeveloperTag{{Tag: 1, Data: []byte("data")}}}
+	data := encodeOptions(t, gradient(2, 2), &Options{Metadata: md})
+
+	// claim 4 GiB of developer data
+	dir := binary.LittleEndian.Uint32(data[len(data)-tgaRawFooterSize+4:])
+	binary.LittleEndian.PutUint32(data[dir+2+6:], 0xffffffff)
+
+	if _, err := DecodeToTga(bytes.NewReader(data)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v", err)
+	}
+
+	tga, err := DecodeToTgaWithOptions(bytes.NewReader(data), &DecodeOptions{Mode: Lenient})
+	if err != nil || tga.Metadata != nil {
+		t.Errorf("lenient: got %+v, %v", tga.Metadata, err)
+	}
+}
+
+func TestStreamAllocationIsBounded(t *testing.T) {
+	// an 18-byte header claiming 16384x16384 24-bit pixels
+	header := make([]byte, tgaRawHeaderSize)
+	header[2] = imageTypeTrueColor
+	binary.LittleEndian.PutUint16(header[12:], 16384)
+	binary.LittleEndian.PutUint16(header[14:], 16384)
+	header[16] = 24
+
+	for _, o := range []*DecodeOptions{nil, {}} {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err := DecodeToTgaWithOptions(streamReader{bytes.NewReader(header)}, o)
+		runtime.ReadMemStats(&after)
+
+		if err == nil {
+			t.Fatalf("%+v: no error", o)
+		}
+		if n := after.TotalAlloc - before.TotalAlloc; n > 4<<20 {
+			t.Errorf("%+v: allocated %d bytes for an empty stream", o, n)
+		}
+	}
+}
+
+func TestStreamBands(t *testing.T) {
+	// more than one band of rows
+	src := gradient(700, 500)
+	for _, o := range []*Options{{RLE: true}, {BPP: 24}} {
+		data := encodeOptions(t, src, o)
+		random, err0 := Decode(bytes.NewReader(data))
+		stream, err1 := Decode(streamReader{bytes.NewReader(data)})
+		if err0 != nil || err1 != nil || !reflect.DeepEqual(random, stream) {
+			t.Errorf("%+v: stream differs (%v, %v)", o, err0, err1)
+		}
+	}
+
+	// packets of 100 pixels cross scanlines and the border of the first
+	// band at pixel 262144
+	data := make([]byte, tgaRawHeaderSize, tgaRawHeaderSize+3072*4)
+	data[2] = imageTypeTrueColor | imageTypeFlagRLE
+	binary.LittleEndian.PutUint16(data[12:], 1024)
+	binary.LittleEndian.PutUint16(data[14:], 300)
+	data[16] = 24
+	data[17] = flagOriginTop
+	for i := 0; i < 3072; i++ {
+		data = append(data, 0x80|99, byte(i), byte(i>>8), 0)
+	}
+
+	random, err0 := Decode(bytes.NewReader(data))
+	stream, err1 := Decode(streamReader{bytes.NewReader(data)})
+	if err0 != nil || err1 != nil || !reflect.DeepEqual(random, stream) {
+		t.Fatalf("crossing packets: stream differs (%v, %v)", err0, err1)
+	}
+	if c := stream.At(262144%1024+1, 262144/1024); !sameColor(c, color.NRGBA{0, 10, 61, 255}) {
+		t.Errorf("pixel after the band border is %v", c)
+	}
+}
@@ -0,0 +1,335 @@
+package tga
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+	"time"
+)
+
+// Metadata holds the image ID field and the TGA 2.0 extension and developer
+// areas. Strings longer than their field are truncated when encoding.
+type Metadata struct {
+	// ImageID is the free-form field after the header, at most 255 bytes
+	ImageID []byte
+
+	// AuthorName has up to 40 characters
+	AuthorName string
+	// AuthorComments has up to four lines of 80 characters separated by
+	// newlines
+	AuthorComments string
+	// Timestamp is when the image was saved with a precision of seconds,
+	// the zero time is stored as unset. Files have no time zone, decoded
+	// timestamps are UTC.
+	Timestamp time.Time
+	// JobName names the job or scene the image belongs to, up to 40
+	// characters
+	JobName string
+	// JobTime is the time spent on the image with a precision of seconds
+	JobTime time.Duration
+	// SoftwareID names the program that created the image, up to 40
+	// characters
+	SoftwareID string
+	// SoftwareVersion is the version number times 100 followed by a letter,
+	// 117 and 'b' for version 1.17b. A zero letter is stored as a space.
+	SoftwareVersion       uint16
+	SoftwareVersionLetter byte
+	// KeyColor is the background or transparent color
+	KeyColor color.NRGBA
+	// PixelAspectRatio is the width of a pixel over its height
+	PixelAspectRatio Ratio
+	// Gamma is the gamma correction applied to the colors
+	Gamma Ratio
+
+	// ColorCorrection is empty or holds 256 entries mapping color values
+	ColorCorrection []color.NRGBA64
+	// PostageStamp is a thumbnail of the image up to 255x255, 64x64 is
+	// recommended. It is stored in the pixel format of the image, see
+	// Options.PostageStampSize for generating it.
+	PostageStamp image.Image
+	// ScanLines holds the file offset of every scanline in file order. When
+	// encoding, a non-nil slice asks for a table whose offsets are computed
+	// by the encoder.
+	ScanLines []uint32
+
+	// Developer holds the developer area tags in file order
+	Developer []DeveloperTag
+}
+
+// Ratio is a fraction, a zero denominator means the value is not specified.
+type Ratio struct {
+	Numerator   uint16
+	Denominator uint16
+}
+
+// Float returns the ratio as a float, or 0 if it is not specified.
+func (r Ratio) Float() float64 {
+	if r.Denominator == 0 {
+		return 0
+	}
+	return float64(r.Numerator) / float64(r.Denominator)
+}
+
+// DeveloperTag is an entry of the developer area. Tags 0 to 32767 are free
+// for applications, higher ones are reserved by Truevision.
+type DeveloperTag struct {
+	Tag  uint16
+	Data []byte
+}
+
+var ErrImageID = errors.New("TGA: image ID longer than 255 bytes")
+
+// offsets of the extension area fields
+const (
+	extAuthorName      = 2
+	extAuthorComments  = 43
+	extTimestamp       = 367
+	extJobName         = 379
+	extJobTime         = 420
+	extSoftwareID      = 426
+	extSoftwareVersion = 467
+	extKeyColor        = 470
+	extPixelAspect     = 474
+	extGamma           = 478
+	extColorCorrection = 482
+	extPostageStamp    = 486
+	extScanLine        = 490
+	extAreaSize        = extAreaAttrTypeOffset + 1
+
+	colorCorrectionSize = 256 * 8
+	devDirEntrySize     = 10
+	commentLineSize     = 81
+	commentLines        = 4
+)
+
+// extOffsets are the file offsets of the data referenced by the extension
+// area, zero if the data is not present
+type extOffsets struct {
+	colorCorrection uint32
+	postageStamp    uint32
+	scanLine        uint32
+}
+
+func getString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimRight(string(b), " ")
+}
+
+// putString writes s into a field of len(b) bytes, leaving room for the
+// terminating zero
+func putString(b []byte, s string) {
+	copy(b[:len(b)-1], s)
+}
+
+// parseExtArea reads the extension area fields into m and returns the
+// offsets and the attribute type it holds
+func parseExtArea(area []byte, m *Metadata) (offsets extOffsets, attrType byte) {
+	le := binary.LittleEndian
+	u16 := func(i int) uint16 { return le.Uint16(area[i:]) }
+
+	m.AuthorName = getString(area[extAuthorName : extAuthorName+41])
+
+	var lines []string
+	for i := 0; i < commentLines; i++ {
+		start := extAuthorComments + i*commentLineSize
+		lines = append(lines, getString(area[start:start+commentLineSize]))
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	m.AuthorComments = strings.Join(lines, "\n")
+
+	month, day, year := u16(extTimestamp), u16(extTimestamp+2), u16(extTimestamp+4)
+	if month != 0 || day != 0 || year != 0 {
+		m.Timestamp = time.Date(int(year), time.Month(month), int(day),
+			int(u16(extTimestamp+6)), int(u16(extTimestamp+8)), int(u16(extTimestamp+10)), 0, time.UTC)
+	}
+
+	m.JobName = getString(area[extJobName : extJobName+41])
+	m.JobTime = time.Duration(u16(extJobTime))*time.Hour +
+		time.Duration(u16(extJobTime+2))*time.Minute +
+		time.Duration(u16(extJobTime+4))*time.Second
+
+	m.SoftwareID = getString(area[extSoftwareID : extSoftwareID+41])
+	m.SoftwareVersion = u16(extSoftwareVersion)
+	if m.SoftwareVersionLetter = area[extSoftwareVersion+2]; m.SoftwareVersionLetter == ' ' {
+		m.SoftwareVersionLetter = 0
+	}
+
+	// stored as A:R:G:B with blue in the lowest byte
+	k := area[extKeyColor:]
+	m.KeyColor = color.NRGBA{k[2], k[1], k[0], k[3]}
+
+	m.PixelAspectRatio = Ratio{u16(extPixelAspect), u16(extPixelAspect + 2)}
+	m.Gamma = Ratio{u16(extGamma), u16(extGamma + 2)}
+
+	offsets.colorCorrection = le.Uint32(area[extColorCorrection:])
+	offsets.postageStamp = le.Uint32(area[extPostageStamp:])
+	offsets.scanLine = le.Uint32(area[extScanLine:])
+
+	return offsets, area[extAreaAttrTypeOffset]
+}
+
+// extArea returns the extension area holding the metadata, m may be nil
+func (m *Metadata) extArea(attrType byte, offsets extOffsets) []byte {
+	area := make([]byte, extAreaSize)
+	le := binary.LittleEndian
+	le.PutUint16(area, extAreaSize)
+	area[extAreaAttrTypeOffset] = attrType
+	le.PutUint32(area[extColorCorrection:], offsets.colorCorrection)
+	le.PutUint32(area[extPostageStamp:], offsets.postageStamp)
+	le.PutUint32(area[extScanLine:], offsets.scanLine)
+	area[extSoftwareVersion+2] = ' '
+
+	if m == nil {
+		return area
+	}
+
+	putString(area[extAuthorName:extAuthorName+41], m.AuthorName)
+	for i, line := range strings.Split(m.AuthorComments, "\n") {
+		if i == commentLines {
+			break
+		}
+		start := extAuthorComments + i*commentLineSize
+		putString(area[start:start+commentLineSize], line)
+	}
+
+	if !m.Timestamp.IsZero() {
+		t := m.Timestamp
+		for i, v := range []int{int(t.Month()), t.Day(), t.Year(), t.Hour(), t.Minute(), t.Second()} {
+			le.PutUint16(area[extTimestamp+i*2:], uint16(v))
+		}
+	}
+
+	putString(area[extJobName:extJobName+41], m.JobName)
+	seconds := int64(m.JobTime / time.Second)
+	le.PutUint16(area[extJobTime:], uint16(seconds/3600))
+	le.PutUint16(area[extJobTime+2:], uint16(seconds/60%60))
+	le.PutUint16(area[extJobTime+4:], uint16(seconds%60))
+
+	putString(area[extSoftwareID:extSoftwareID+41], m.SoftwareID)
+	le.PutUint16(area[extSoftwareVersion:], m.SoftwareVersion)
+	if m.SoftwareVersionLetter != 0 {
+		area[extSoftwareVersion+2] = m.SoftwareVersionLetter
+	}
+
+	k := m.KeyColor
+	area[extKeyColor], area[extKeyColor+1], area[extKeyColor+2], area[extKeyColor+3] = k.B, k.G, k.R, k.A
+
+	le.PutUint16(area[extPixelAspect:], m.PixelAspectRatio.Numerator)
+	le.PutUint16(area[extPixelAspect+2:], m.PixelAspectRatio.Denominator)
+	le.PutUint16(area[extGamma:], m.Gamma.Numerator)
+	le.PutUint16(area[extGamma+2:], m.Gamma.Denominator)
+
+	return area
+}
+
+func parseColorCorrection(raw []byte) []color.NRGBA64 {
+	table := make([]color.NRGBA64, 256)
+	le := binary.LittleEndian
+	for i := range table {
+		e := raw[i*8:]
+		table[i] = color.NRGBA64{R: le.Uint16(e[2:]), G: le.Uint16(e[4:]), B: le.Uint16(e[6:]), A: le.Uint16(e)}
+	}
+	return table
+}
+
+func colorCorrectionBytes(table []color.NRGBA64) []byte {
+	raw := make([]byte, colorCorrectionSize)
+	le := binary.LittleEndian
+	for i := 0; i < len(table) && i < 256; i++ {
+		e, c := raw[i*8:], table[i]
+		le.PutUint16(e, c.A)
+		le.PutUint16(e[2:], c.R)
+		le.PutUint16(e[4:], c.G)
+		le.PutUint16(e[6:], c.B)
+	}
+	return raw
+}
+
+// readDeveloperArea reads the tags listed in the developer directory at
+// offset
+func readDeveloperArea(s *source, offset int64) (tags []DeveloperTag, err error) {
+	var count [2]byte
+
+	if err = s.readAt(count[:], offset); err != nil {
+		return
+	}
+
+	dir := make([]byte, int(binary.LittleEndian.Uint16(count[:]))*devDirEntrySize)
+
+	if !s.has(offset+2, int64(len(dir))) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	if err = s.readAt(dir, offset+2); err != nil {
+		return
+	}
+
+	for i := 0; i < len(dir); i += devDirEntrySize {
+		e := dir[i:]
+		tag := DeveloperTag{Tag: binary.LittleEndian.Uint16(e)}
+		off, size := int64(binary.LittleEndian.Uint32(e[2:])), int64(binary.LittleEndian.Uint32(e[6:]))
+
+		// check the size before allocating it
+		if !s.has(off, size) {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		tag.Data = make([]byte, size)
+
+		if err = s.readAt(tag.Data, off); err != nil {
+			return
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return
+}
+
+// writeDeveloperArea writes the tag data followed by the directory and
+// returns the offset of the directory
+func writeDeveloperArea(pw *pixelWriter, tags []DeveloperTag) (offset uint32, err error) {
+	dir := make([]byte, 2+len(tags)*devDirEntrySize)
+	binary.LittleEndian.PutUint16(dir, uint16(len(tags)))
+
+	for i, tag := range tags {
+		e := dir[2+i*devDirEntrySize:]
+		binary.LittleEndian.PutUint16(e, tag.Tag)
+		binary.LittleEndian.PutUint32(e[2:], uint32(pw.n))
+		binary.LittleEndian.PutUint32(e[6:], uint32(len(tag.Data)))
+
+		if _, err = pw.Write(tag.Data); err != nil {
+			return
+		}
+	}
+
+	offset = uint32(pw.n)
+	_, err = pw.Write(dir)
+
+	return
+}
+
+// DecodeMetadata decodes the image ID, extension area and developer area of
+// a TARGA image with DefaultDecodeOptions. Readers with random access are
+// read without the pixels.
+func DecodeMetadata(r io.Reader) (m *Metadata, err error) {
+	var tga TGA
+
+	if err = tga.read(r, nil, false, true); err != nil {
+		return
+	}
+
+	if m = tga.Metadata; m == nil {
+		m = &Metadata{}
+	}
+
+	return
+}
@@ -0,0 +1,149 @@
+package tga
+
+import (
+	"bytes"
+	"image/color"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fullMetadata() *Metadata {
+	cc := make([]color.NRGBA64, 256)
+	for i := range cc {
+		v := uint16(i * 257)
+		cc[i] = color.NRGBA64{v, v / 2, 65535 - v, 65535}
+	}
+	return &Metadata{
+		ImageID:               []byte("frame 0042"),
+		AuthorName:            "Render Farm",
+		AuthorComments:        "first line\nsecond line",
+		Timestamp:             time.Date(2024, time.March, 9, 17, 4, 59, 0, time.UTC),
+		JobName:               "african_head",
+		JobTime:               26*time.Hour + 3*time.Minute + 7*time.Second,
+		SoftwareID:            "tinyrender",
+		SoftwareVersion:       117,
+		SoftwareVersionLetter: 'b',
+		KeyColor:              color.NRGBA{1, 2, 3, 4},
+		PixelAspectRatio:      Ratio{4, 3},
+		Gamma:                 Ratio{22, 10},
+		ColorCorrection:       cc,
+		ScanLines:             []uint32{},
+		Developer: []DeveloperTag{
+			{Tag: 1, Data: []byte(`{"samples": 16}`)},
+			{Tag: 7, Data: []byte{}},
+		},
+	}
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	src := gradient(6, 5)
+
+	for _, o := range []*Options{
+		{BPP: 32},
+		{BPP: 24, Origin: OriginBottomLeft},
+		{RLE: true, Origin: OriginBottomRight},
+	} {
+		want := fullMetadata()
+		o.Metadata = want
+		data := encodeOptions(t, src, o)
+
+		got, err := DecodeMetadata(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.ScanLines) != 5 {
+			t.Fatalf("got %d scanline offsets", len(got.ScanLines))
+		}
+		for i, offset := range got.ScanLines {
+			if !o.RLE && int(offset) != tgaRawHeaderSize+len(want.ImageID)+i*6*o.BPP/8 {
+				t.Errorf("scanline %d is at %d", i, offset)
+			}
+		}
+		if got.Gamma.Float() != 2.2 {
+			t.Errorf("gamma is %v", got.Gamma.Float())
+		}
+
+		got.ScanLines, want.ScanLines = nil, nil
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got metadata %+v, want %+v", got, want)
+		}
+
+		// the pixels are not disturbed by the metadata
+		m, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.At(2, 3) != src.At(2, 3) && o.BPP != 24 {
+			t.Errorf("pixel is %v, want %v", m.At(2, 3), src.At(2, 3))
+		}
+	}
+}
+
+func TestMetadataTruncated(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	data := encodeOptions(t, gradient(2, 2), &Options{Metadata: &Metadata{
+		AuthorName:     long,
+		AuthorComments: "1\n2\n3\n4\n5",
+	}})
+	got, err := DecodeMetadata(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AuthorName != long[:40] {
+		t.Errorf("author name is %q", got.AuthorName)
+	}
+	if got.AuthorComments != "1\n2\n3\n4" {
+		t.Errorf("comments are %q", got.AuthorComments)
+	}
+
+	if err := EncodeWithOptions(&bytes.Buffer{}, gradient(2, 2), &Options{Metadata: &Metadata{ImageID: make([]byte, 256)}}); err != ErrImageID {
+		t.Errorf("got %v for a long image ID", err)
+	}
+}
+
+func TestMetadataMissing(t *testing.T) {
+	img, err := DecodeToTga(bytes.NewReader(encodeOptions(t, gradient(2, 2), nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Metadata == nil || img.Metadata.AuthorName != "" || img.Metadata.Developer != nil {
+		t.Errorf("got metadata %+v for the attribute type extension area", img.Metadata)
+	}
+
+	img, err = DecodeToTga(bytes.NewReader(encodeOptions(t, gradient(2, 2), &Options{BPP: 24})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Metadata != nil {
+		t.Errorf("got metadata %+v without extension area", img.Metadata)
+	}
+}
+
+func TestSaveToFileKeepsMetadata(t *testing.T) {
+	data := encodeOptions(t, gradient(3, 3), &Options{Metadata: fullMetadata()})
+	img, err := DecodeToTga(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "out.tga")
+	if err := img.SaveToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	saved, err := DecodeMetadata(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(saved.Developer, fullMetadata().Developer) || saved.JobName != "african_head" {
+		t.Errorf("metadata was not saved: %+v", saved)
+	}
+}
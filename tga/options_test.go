@@ -0,0 +1,235 @@
+package tga
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// gradient returns an image whose pixels all differ, including translucent
+// ones
+func gradient(w, h int) *image.NRGBA {
+	m := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			m.SetNRGBA(x, y, color.NRGBA{uint8(x * 40), uint8(y * 40), uint8(x*y*10 + 5), uint8(255 - x*30)})
+		}
+	}
+	return m
+}
+
+func encodeOptions(t testing.TB, m image.Image, o *Options) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := EncodeWithOptions(&buf, m, o); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sameColor(c0, c1 color.Color) bool {
+	r0, g0, b0, a0 := c0.RGBA()
+	r1, g1, b1, a1 := c1.RGBA()
+	if a0 == 0 && a1 == 0 {
+		return true
+	}
+	return r0 == r1 && g0 == g1 && b0 == b1 && a0 == a1
+}
+
+func TestEncodeWithOptions(t *testing.T) {
+	src := gradient(6, 5)
+
+	quantize := func(v uint8) uint8 {
+		v >>= 3
+		return v<<3 + v>>2
+	}
+	expected := map[int]func(c color.NRGBA) color.Color{
+		8: func(c color.NRGBA) color.Color {
+			return color.GrayModel.Convert(c)
+		},
+		15: func(c color.NRGBA) color.Color {
+			return color.NRGBA{quantize(c.R), quantize(c.G), quantize(c.B), 255}
+		},
+		16: func(c color.NRGBA) color.Color {
+			a := uint8(0)
+			if c.A >= 128 {
+				a = 255
+			}
+			return color.NRGBA{quantize(c.R), quantize(c.G), quantize(c.B), a}
+		},
+		24: func(c color.NRGBA) color.Color {
+			return color.NRGBA{c.R, c.G, c.B, 255}
+		},
+		32: func(c color.NRGBA) color.Color {
+			return c
+		},
+	}
+
+	for bpp, want := range expected {
+		for origin := OriginTopLeft; origin <= OriginBottomRight; origin++ {
+			for _, rle := range []bool{false, true} {
+				data := encodeOptions(t, src, &Options{BPP: bpp, Origin: origin, RLE: rle})
+				if (data[2]&imageTypeFlagRLE != 0) != rle {
+					t.Errorf("bpp %d: image type is %d", bpp, data[2])
+				}
+
+				got, err := Decode(bytes.NewReader(data))
+				if err != nil {
+					t.Fatalf("bpp %d, origin %d, rle %v: %v", bpp, origin, rle, err)
+				}
+				for y := 0; y < 5; y++ {
+					for x := 0; x < 6; x++ {
+						if w := want(src.NRGBAAt(x, y)); !sameColor(got.At(x, y), w) {
+							t.Fatalf("bpp %d, origin %d, rle %v: pixel (%d, %d) is %v, want %v", bpp, origin, rle, x, y, got.At(x, y), w)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeColorMapped(t *testing.T) {
+	palette := color.Palette{
+		color.NRGBA{255, 0, 0, 255},
+		color.NRGBA{0, 255, 0, 255},
+		color.NRGBA{0, 0, 255, 128},
+	}
+	src := image.NewPaletted(image.Rect(0, 0, 4, 3), palette)
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i % 2)
+	}
+
+	for _, rle := range []bool{false, true} {
+		data := encodeOptions(t, src, &Options{ColorMapped: true, RLE: rle})
+
+		var h rawHeader
+		readHeader(t, data, &h)
+		if h.ImageType&imageTypeMask != imageTypePaletted || h.PaletteLength != 3 || h.PaletteBPP != 32 || h.BPP != 8 {
+			t.Fatalf("unexpected header %+v", h)
+		}
+		if !rle && data[tgaRawHeaderSize+3*4+1] != src.Pix[1] {
+			t.Errorf("palette indices are not kept")
+		}
+
+		got, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y < 3; y++ {
+			for x := 0; x < 4; x++ {
+				if !sameColor(got.At(x, y), src.At(x, y)) {
+					t.Fatalf("pixel (%d, %d) is %v, want %v", x, y, got.At(x, y), src.At(x, y))
+				}
+			}
+		}
+	}
+
+	// opaque images get 24-bit entries
+	data := encodeOptions(t, gradient(4, 4).SubImage(image.Rect(1, 0, 2, 4)), &Options{ColorMapped: true})
+	if data[7] != 32 {
+		t.Errorf("translucent palette has %d bits per entry", data[7])
+	}
+	opaque := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	for i := range opaque.Pix {
+		opaque.Pix[i] = 0xff
+	}
+	if data := encodeOptions(t, opaque, &Options{ColorMapped: true}); data[7] != 24 {
+		t.Errorf("opaque palette has %d bits per entry", data[7])
+	}
+
+	if err := EncodeWithOptions(&bytes.Buffer{}, gradient(20, 20), &Options{ColorMapped: true}); !errors.Is(err, ErrPaletteSize) {
+		t.Errorf("got %v for too many colors", err)
+	}
+}
+
+func TestEncodeInvalidBPP(t *testing.T) {
+	for _, o := range []*Options{{BPP: 12}, {BPP: 24, ColorMapped: true}} {
+		if err := EncodeWithOptions(&bytes.Buffer{}, gradient(2, 2), o); !errors.Is(err, ErrBPP) {
+			t.Errorf("%+v: got %v", o, err)
+		}
+	}
+}
+
+func TestEncodeAttributeType(t *testing.T) {
+	src := gradient(3, 3)
+
+	premultiplied := image.NewRGBA(src.Bounds())
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 3; x++ {
+			premultiplied.Set(x, y, src.At(x, y))
+		}
+	}
+	got, err := Decode(bytes.NewReader(encodeOptions(t, premultiplied, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.(*image.RGBA); !ok {
+		t.Errorf("premultiplied image decoded as %T", got)
+	}
+
+	got, err = Decode(bytes.NewReader(encodeOptions(t, src, &Options{AttributeType: AttributeUndefinedIgnore})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := got.At(2, 2).RGBA(); a != 0xffff {
+		t.Errorf("ignored alpha decoded as %d", a)
+	}
+}
+
+func TestEncodePremultipliedWithoutAlpha(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.SetRGBA(0, 0, color.RGBA{100, 50, 0, 128})
+	src.SetRGBA(1, 0, color.RGBA{10, 20, 30, 255})
+
+	got, err := Decode(bytes.NewReader(encodeOptions(t, src, &Options{BPP: 24})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 2; x++ {
+		want := color.NRGBAModel.Convert(src.At(x, 0)).(color.NRGBA)
+		want.A = 255
+		if !sameColor(got.At(x, 0), want) {
+			t.Errorf("pixel %d is %v, want %v", x, got.At(x, 0), want)
+		}
+	}
+}
+
+func TestSaveToFileUsesHeader(t *testing.T) {
+	img := CreateTga(5, 4)
+	img.SetPixel(1, 2, NewColor(10, 20, 30, 255))
+	path := filepath.Join(t.TempDir(), "out.tga")
+	if err := img.SaveToFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h rawHeader
+	readHeader(t, data, &h)
+	if h.BPP != 24 || h.Flags&flagOriginTop != 0 {
+		t.Errorf("saved with %d bits per pixel and flags %x", h.BPP, h.Flags)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	loaded, err := DecodeToTga(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := loaded.GetPixel(1, 2); c != NewColor(10, 20, 30, 255) {
+		t.Errorf("pixel is %v after saving", c)
+	}
+	if o := loaded.Options(); o.BPP != 24 || o.Origin != OriginBottomLeft || o.RLE {
+		t.Errorf("loaded image has options %+v", o)
+	}
+}
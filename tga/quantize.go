@@ -0,0 +1,199 @@
+package tga
+
+import (
+	"bytes"
+	"sort"
+)
+
+// colorCount is a color and the number of pixels that have it
+type colorCount struct {
+	c [4]byte
+	n int
+}
+
+// colorBox is a set of colors that median cut splits along its widest
+// channel
+type colorBox []colorCount
+
+func (b colorBox) widest() (channel, width int) {
+	for i := 0; i < 4; i++ {
+		lo, hi := 255, 0
+		for _, cc := range b {
+			lo, hi = Min(lo, int(cc.c[i])), Max(hi, int(cc.c[i]))
+		}
+		if hi-lo > width {
+			channel, width = i, hi-lo
+		}
+	}
+	return
+}
+
+func (b colorBox) pixels() (n int) {
+	for _, cc := range b {
+		n += cc.n
+	}
+	return
+}
+
+// mean returns the average color of the box weighted by pixel count
+func (b colorBox) mean() (c [4]byte) {
+	var sum [4]int
+	n := b.pixels()
+
+	for _, cc := range b {
+		for i := range sum {
+			sum[i] += int(cc.c[i]) * cc.n
+		}
+	}
+	for i := range c {
+		c[i] = uint8((sum[i] + n/2) / n)
+	}
+	return
+}
+
+// medianCut picks at most n colors for the pixels of a non-empty RGBA
+// source. It starts with one box holding every color and splits the box with
+// the widest channel at its median pixel until there are n boxes, which then
+// become the mean of their colors.
+func medianCut(src pixelSource, n int) [][4]byte {
+	counts := make(map[[4]byte]int)
+
+	for y := 0; y < src.height; y++ {
+		for x := 0; x < src.width; x++ {
+			var c [4]byte
+			copy(c[:], src.pixel(x, y))
+			counts[c]++
+		}
+	}
+
+	box := make(colorBox, 0, len(counts))
+	for c, k := range counts {
+		box = append(box, colorCount{c, k})
+	}
+
+	// sorted so the palette does not depend on the order of the map
+	sort.Slice(box, func(i, j int) bool {
+		return bytes.Compare(box[i].c[:], box[j].c[:]) < 0
+	})
+
+	boxes := []colorBox{box}
+
+	for len(boxes) < n {
+		split, channel, width := -1, 0, 0
+
+		for i, b := range boxes {
+			if ch, w := b.widest(); w > width {
+				split, channel, width = i, ch, w
+			}
+		}
+
+		if split < 0 {
+			// every box holds a single color
+			break
+		}
+
+		b := boxes[split]
+		sort.SliceStable(b, func(i, j int) bool {
+			return b[i].c[channel] < b[j].c[channel]
+		})
+
+		half := b.pixels() / 2
+		k, sum := 0, 0
+
+		for k < len(b)-1 && sum+b[k].n <= half {
+			sum += b[k].n
+			k++
+		}
+
+		k = Max(k, 1)
+		boxes[split] = b[:k]
+		boxes = append(boxes, b[k:])
+	}
+
+	colors := make([][4]byte, len(boxes))
+	for i, b := range boxes {
+		colors[i] = b.mean()
+	}
+
+	return colors
+}
+
+// bayer is the 4x4 threshold matrix of ordered dithering
+var bayer = [4][4]int{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// dither returns an RGBA copy of the source whose pixels are replaced by
+// the colors nearest picks, spreading the difference as d selects. spread
+// is the distance between neighbouring output values of every channel,
+// ordered dithering offsets pixels by at most half of it.
+func dither(src pixelSource, d Dither, spread [4]int, nearest func(c [4]byte) [4]byte) pixelSource {
+	w, h := src.width, src.height
+	out := pixelSource{make([]byte, w*h*4), w * 4, 4, w, h}
+
+	// Floyd–Steinberg errors of the current and the next row in 16ths,
+	// padded by a pixel on both sides
+	cur, next := make([][4]int, w+2), make([][4]int, w+2)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := src.pixel(x, y)
+			var want [4]byte
+
+			for i := range want {
+				v := int(p[i])
+
+				switch d {
+				case DitherFloydSteinberg:
+					v += cur[x+1][i] / 16
+				case DitherOrdered:
+					v += (2*bayer[y%4][x%4] - 15) * spread[i] / 32
+				}
+
+				want[i] = uint8(Max(0, Min(255, v)))
+			}
+
+			c := nearest(want)
+			copy(out.pixel(x, y), c[:])
+
+			if d == DitherFloydSteinberg {
+				for i := range want {
+					e := int(want[i]) - int(c[i])
+					cur[x+2][i] += e * 7
+					next[x][i] += e * 3
+					next[x+1][i] += e * 5
+					next[x+2][i] += e
+				}
+			}
+		}
+
+		cur, next = next, cur
+		for i := range next {
+			next[i] = [4]int{}
+		}
+	}
+
+	return out
+}
+
+// round555 returns the 15-bit color closest to c, expanded the way the
+// decoder does. With alpha set, alpha becomes the 1-bit alpha of 5551.
+func round555(c [4]byte, alpha bool) [4]byte {
+	for i := 0; i < 3; i++ {
+		v := (int(c[i])*31 + 127) / 255
+		c[i] = uint8(v<<3 | v>>2)
+	}
+
+	if alpha {
+		if c[3] >= 0x80 {
+			c[3] = 0xff
+		} else {
+			c[3] = 0
+		}
+	}
+
+	return c
+}
@@ -0,0 +1,151 @@
+package tga
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// meanColor returns the average of every channel of an image, non-alpha
+// channels weighted by alpha
+func meanColor(m image.Image) (mean [4]float64) {
+	b := m.Bounds()
+	var alpha float64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, b, a := m.At(x, y).RGBA()
+			mean[0] += float64(r >> 8)
+			mean[1] += float64(g >> 8)
+			mean[2] += float64(b >> 8)
+			mean[3] += float64(a >> 8)
+			alpha += float64(a >> 8)
+		}
+	}
+	n := float64(b.Dx() * b.Dy())
+	for i := 0; i < 3; i++ {
+		mean[i] *= 255 / alpha
+	}
+	mean[3] /= n
+	return
+}
+
+func decodeBytes(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	m, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// rainbow returns an opaque image with more than 256 colors
+func rainbow(w, h int) *image.NRGBA {
+	m := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			m.SetNRGBA(x, y, color.NRGBA{uint8(x * 255 / w), uint8(y * 255 / h), uint8((x + y) * 127 / (w + h)), 0xff})
+		}
+	}
+	return m
+}
+
+func TestQuantize(t *testing.T) {
+	src := rainbow(64, 64)
+
+	if err := EncodeWithOptions(&bytes.Buffer{}, src, &Options{ColorMapped: true}); !errors.Is(err, ErrPaletteSize) {
+		t.Errorf("got %v without quantization", err)
+	}
+
+	for _, d := range []Dither{DitherNone, DitherFloydSteinberg, DitherOrdered} {
+		data := encodeOptions(t, src, &Options{ColorMapped: true, Quantize: true, Dither: d})
+
+		var h rawHeader
+		readHeader(t, data, &h)
+		if h.ImageType != imageTypePaletted || h.PaletteLength != 256 || h.PaletteBPP != 24 {
+			t.Errorf("dither %d: header %+v", d, h)
+		}
+
+		m := decodeBytes(t, data)
+		want, got := meanColor(src), meanColor(m)
+		for i := range want {
+			if diff := want[i] - got[i]; diff < -1 || diff > 1 {
+				t.Errorf("dither %d: mean color %v, want %v", d, got, want)
+				break
+			}
+		}
+
+		maxDiff := 0
+		for y := 0; y < 64; y++ {
+			for x := 0; x < 64; x++ {
+				c0, c1 := src.NRGBAAt(x, y), m.At(x, y).(color.NRGBA)
+				for _, d := range []int{int(c0.R) - int(c1.R), int(c0.G) - int(c1.G), int(c0.B) - int(c1.B)} {
+					maxDiff = Max(maxDiff, Max(d, -d))
+				}
+			}
+		}
+		if maxDiff > 48 {
+			t.Errorf("dither %d: colors differ by up to %d", d, maxDiff)
+		}
+	}
+}
+
+func TestMedianCut(t *testing.T) {
+	// shades of red and blue fall into one box each
+	src := image.NewNRGBA(image.Rect(0, 0, 8, 2))
+	for x := 0; x < 8; x++ {
+		src.SetNRGBA(x, 0, color.NRGBA{uint8(200 + x), 0, 0, 0xff})
+		src.SetNRGBA(x, 1, color.NRGBA{0, 0, uint8(100 + x), 0xff})
+	}
+
+	colors := medianCut(newPixelSource(src, false, false), 2)
+	if len(colors) != 2 {
+		t.Fatalf("got %d colors", len(colors))
+	}
+	for _, c := range colors {
+		if c != [4]byte{0, 0, 104, 0xff} && c != [4]byte{204, 0, 0, 0xff} {
+			t.Errorf("unexpected color %v", c)
+		}
+	}
+
+	// never more colors than the image has
+	if colors := medianCut(newPixelSource(src, false, false), 256); len(colors) != 16 {
+		t.Errorf("got %d colors for 16", len(colors))
+	}
+}
+
+func TestDither5551(t *testing.T) {
+	// gray 4 lies between the 5-bit levels 0 and 8, alpha 64 between 0 and 255
+	src := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for i := 0; i < len(src.Pix); i += 4 {
+		copy(src.Pix[i:], []byte{4, 4, 4, 64})
+	}
+
+	for _, d := range []Dither{DitherNone, DitherFloydSteinberg, DitherOrdered} {
+		m := decodeBytes(t, encodeOptions(t, src, &Options{BPP: 16, Dither: d}))
+		mean := meanColor(m)
+
+		if d == DitherNone {
+			if mean[3] != 0 {
+				t.Errorf("undithered alpha is %v", mean[3])
+			}
+			continue
+		}
+		if mean[3] < 54 || mean[3] > 74 {
+			t.Errorf("dither %d: mean alpha %v, want 64", d, mean[3])
+		}
+	}
+
+	// 15 bits keep no alpha, but the colors are dithered
+	opaque := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for i := 0; i < len(opaque.Pix); i += 4 {
+		copy(opaque.Pix[i:], []byte{4, 4, 4, 0xff})
+	}
+	for _, d := range []Dither{DitherFloydSteinberg, DitherOrdered} {
+		mean := meanColor(decodeBytes(t, encodeOptions(t, opaque, &Options{BPP: 15, Dither: d})))
+		if mean[0] < 3 || mean[0] > 5 || mean[3] != 255 {
+			t.Errorf("dither %d: mean color %v", d, mean)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package tga
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// stripes returns an image with runs of equal pixels that end mid-scanline
+// and at its end, next to pixels that change every time
+func stripes(w, h int) *image.NRGBA {
+	m := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{200, 10, 10, 255}
+			if x < w/3 {
+				c = color.NRGBA{uint8(x * 7), uint8(y), 50, uint8(128 + x)}
+			} else if y%2 == 0 {
+				c = color.NRGBA{0, 0, 255, 255}
+			}
+			m.SetNRGBA(x, y, c)
+		}
+	}
+	return m
+}
+
+func encodeRLE(t *testing.T, m image.Image) []byte {
+	var buf bytes.Buffer
+	if err := EncodeWithOptions(&buf, m, &Options{RLE: true}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestEncodeRLERoundTrip(t *testing.T) {
+	src := stripes(300, 7)
+	gray := image.NewGray(src.Bounds())
+	for i := range gray.Pix {
+		gray.Pix[i] = src.Pix[i*4]
+	}
+
+	for _, m := range []image.Image{src, (*image.RGBA)(src), gray, src.SubImage(image.Rect(5, 2, 290, 6))} {
+		data := encodeRLE(t, m)
+		if data[2]&imageTypeFlagRLE == 0 {
+			t.Errorf("%T: image type %d is not run-length encoded", m, data[2])
+		}
+
+		got, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%T: %v", m, err)
+		}
+		b := m.Bounds()
+		if got.Bounds().Dx() != b.Dx() || got.Bounds().Dy() != b.Dy() {
+			t.Fatalf("%T: got bounds %v, want %v", m, got.Bounds(), b)
+		}
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				r0, g0, b0, a0 := m.At(b.Min.X+x, b.Min.Y+y).RGBA()
+				r1, g1, b1, a1 := got.At(x, y).RGBA()
+				if r0 != r1 || g0 != g1 || b0 != b1 || a0 != a1 {
+					t.Fatalf("%T: pixel (%d, %d) is %v, want %v", m, x, y, got.At(x, y), m.At(b.Min.X+x, b.Min.Y+y))
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeRLEPackets(t *testing.T) {
+	const w, h = 300, 7
+	data := encodeRLE(t, stripes(w, h))
+
+	var raw bytes.Buffer
+	if err := Encode(&raw, stripes(w, h)); err != nil {
+		t.Fatal(err)
+	}
+	if len(data) >= raw.Len() {
+		t.Errorf("encoded %d bytes, raw is %d bytes", len(data), raw.Len())
+	}
+
+	// walk the packets and check that every scanline ends on a packet
+	// boundary
+	r := bytes.NewReader(data[tgaRawHeaderSize:])
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; {
+			b, err := r.ReadByte()
+			if err != nil {
+				t.Fatalf("line %d: %v", y, err)
+			}
+			count := int(b&0x7f) + 1
+			size := 4
+			if b&0x80 == 0 {
+				size *= count
+			}
+			r.Seek(int64(size), 1)
+			if x += count; x > w {
+				t.Fatalf("packet at line %d crosses the scanline", y)
+			}
+		}
+	}
+
+	// the footer points at the extension area behind the packets
+	var footer rawFooter
+	binary.Read(bytes.NewReader(data[len(data)-tgaRawFooterSize:]), binary.LittleEndian, &footer)
+	if want := len(data) - r.Len(); int(footer.ExtAreaOffset) != want {
+		t.Errorf("extension area offset is %d, want %d", footer.ExtAreaOffset, want)
+	}
+}
+
+func TestAppendRLE(t *testing.T) {
+	tests := []struct {
+		line []byte
+		want []byte
+	}{
+		{[]byte{1, 1, 1, 1}, []byte{0x83, 1}},
+		{[]byte{1, 2, 3}, []byte{2, 1, 2, 3}},
+		// two equal single byte pixels stay in the raw packet
+		{[]byte{1, 2, 2, 3}, []byte{3, 1, 2, 2, 3}},
+		{[]byte{1, 2, 2, 2, 3}, []byte{0, 1, 0x82, 2, 0, 3}},
+		{bytes.Repeat([]byte{9}, 130), []byte{0xff, 9, 1, 9, 9}},
+	}
+	for _, test := range tests {
+		if got := appendRLE(nil, test.line, 1); !bytes.Equal(got, test.want) {
+			t.Errorf("appendRLE(%v) = %v, want %v", test.line, got, test.want)
+		}
+	}
+}
+
+func readHeader(t *testing.T, data []byte, h *rawHeader) {
+	t.Helper()
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, h); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,124 @@
+package tga
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"io"
+)
+
+func init() {
+	for _, magic := range sniffPatterns() {
+		image.RegisterFormat("TGA", magic, Decode, DecodeConfig)
+	}
+}
+
+// sniffPatterns returns the header prefixes image.Decode recognizes as
+// TARGA. TARGA files have no magic number, so the patterns fix the color map
+// type, image type, color map entry size and bits per pixel of every pixel
+// format the decoder supports and leave the other fields open. Truecolor and
+// monochrome images may carry a color map they do not use.
+func sniffPatterns() (patterns []string) {
+	formats := []struct {
+		imageType byte
+		mapType   byte
+		entrySize []byte
+		bpp       []byte
+	}{
+		{imageTypePaletted, 1, []byte{15, 16, 24, 32}, []byte{8}},
+		{imageTypeTrueColor, 0, nil, []byte{16, 24, 32}},
+		{imageTypeTrueColor, 1, []byte{15, 16, 24, 32}, []byte{16, 24, 32}},
+		{imageTypeMonoChrome, 0, nil, []byte{8, 16}},
+		{imageTypeMonoChrome, 1, []byte{15, 16, 24, 32}, []byte{8, 16}},
+	}
+
+	for _, f := range formats {
+		entrySizes := f.entrySize
+		if entrySizes == nil {
+			entrySizes = []byte{'?'}
+		}
+
+		for _, rle := range []byte{0, imageTypeFlagRLE} {
+			for _, entrySize := range entrySizes {
+				for _, bpp := range f.bpp {
+					magic := bytes.Repeat([]byte{'?'}, 17)
+					magic[1] = f.mapType
+					magic[2] = f.imageType | rle
+					magic[7] = entrySize
+					magic[16] = bpp
+					patterns = append(patterns, string(magic))
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// Sniff reports whether r looks like a TARGA file. The header has to describe
+// a non-empty image in a pixel format the decoder supports, and a color map,
+// if there is one, with a valid entry size. Readers with random access must
+// also end in a TGA 2.0 footer or hold as much pixel data as the header
+// announces, they are read with ReadAt and left where they are. Streams are
+// only checked at the header: exactly its 18 bytes are read from them, none
+// if r is a *bufio.Reader.
+func Sniff(r io.Reader) bool {
+	var tga TGA
+
+	tga.opts.Mode = Strict
+	tga.r = newSource(r)
+	defer tga.r.release()
+
+	if !tga.r.random() {
+		var err error
+		header := make([]byte, tgaRawHeaderSize)
+
+		if br, ok := r.(*bufio.Reader); ok {
+			header, err = br.Peek(tgaRawHeaderSize)
+		} else {
+			_, err = io.ReadFull(r, header)
+		}
+
+		if err != nil {
+			return false
+		}
+
+		tga.r = &source{ra: bytes.NewReader(header), size: tgaRawHeaderSize}
+
+		return tga.getHeader() == nil && tga.plausible()
+	}
+
+	if tga.getHeader() != nil || !tga.plausible() {
+		return false
+	}
+
+	footer := make([]byte, tgaRawFooterSize)
+
+	if tga.r.size >= tgaRawHeaderSize+tgaRawFooterSize &&
+		tga.r.readAt(footer, tga.r.size-tgaRawFooterSize) == nil &&
+		bytes.Equal(footer[8:], tgaSignature) {
+		return true
+	}
+
+	// TGA 1.0 file
+	return tga.readPalette() == nil && tga.checkSize() == nil
+}
+
+// plausible checks the header fields that validate lets pass
+func (tga *TGA) plausible() bool {
+	if tga.width == 0 || tga.height == 0 {
+		return false
+	}
+
+	switch tga.raw.PaletteType {
+	case 0:
+		return true
+	case 1:
+		switch tga.raw.PaletteBPP {
+		case 15, 16, 24, 32:
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,146 @@
+package tga
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"image"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSniff(t *testing.T) {
+	for name, data := range streamTestFiles(t) {
+		if !Sniff(bytes.NewReader(data)) {
+			t.Errorf("%s: not recognized", name)
+		}
+		if !Sniff(bufio.NewReader(bytes.NewReader(data))) {
+			t.Errorf("%s: stream not recognized", name)
+		}
+		if _, format, err := image.DecodeConfig(bytes.NewReader(data)); err != nil || format != "TGA" {
+			t.Errorf("%s: image.DecodeConfig got %q, %v", name, format, err)
+		}
+	}
+
+	for _, o := range []*Options{{BPP: 8}, {BPP: 15}, {BPP: 16, RLE: true}, {BPP: 24}, {ColorMapped: true}} {
+		data := encodeOptions(t, gradient(3, 3), o)
+		if !Sniff(bytes.NewReader(data)) {
+			t.Errorf("%+v: not recognized", o)
+		}
+		if _, format, _ := image.DecodeConfig(bytes.NewReader(data)); format != "TGA" {
+			t.Errorf("%+v: image.DecodeConfig got %q", o, format)
+		}
+	}
+}
+
+func TestSniffRejects(t *testing.T) {
+	pngs, _ := filepath.Glob("testdata/*.png")
+	for _, path := range pngs {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if Sniff(bytes.NewReader(data)) {
+			t.Errorf("%s: recognized as TARGA", path)
+		}
+		if _, format, err := image.Decode(bytes.NewReader(data)); err != nil || format != "png" {
+			t.Errorf("%s: image.Decode got %q, %v", path, format, err)
+		}
+	}
+
+	text := []byte(strings.Repeat("not an image at all ", 10))
+	if Sniff(bytes.NewReader(text)) {
+		t.Error("text recognized as TARGA")
+	}
+	if _, _, err := image.Decode(bytes.NewReader(text)); err != image.ErrFormat {
+		t.Errorf("image.Decode got %v for text", err)
+	}
+
+	valid := encodeOptions(t, gradient(4, 4), &Options{BPP: 24})
+	for name, change := range map[string]func(data []byte) []byte{
+		"empty":          func(data []byte) []byte { data[12] = 0; return data },
+		"interleaved":    func(data []byte) []byte { data[17] |= 0x80; return data },
+		"unused palette": func(data []byte) []byte { data[1] = 1; return data },
+		"bad image type": func(data []byte) []byte { data[2] = 4; return data },
+		"truncated":      func(data []byte) []byte { return data[:tgaRawHeaderSize+40] },
+	} {
+		data := change(append([]byte(nil), valid...))
+		if Sniff(bytes.NewReader(data)) {
+			t.Errorf("%s: recognized as TARGA", name)
+		}
+	}
+
+	// without the footer the pixels have to be there
+	tga1 := valid[:len(valid)-tgaRawFooterSize]
+	if !Sniff(bytes.NewReader(tga1)) {
+		t.Error("TGA 1.0 file not recognized")
+	}
+	if Sniff(bytes.NewReader(tga1[:len(tga1)-1])) {
+		t.Error("truncated TGA 1.0 file recognized")
+	}
+}
+
+func TestSniffLeavesReader(t *testing.T) {
+	data := encodeOptions(t, gradient(4, 4), nil)
+
+	r := bytes.NewReader(data)
+	br := bufio.NewReader(bytes.NewReader(data))
+	if !Sniff(r) || !Sniff(br) {
+		t.Fatal("not recognized")
+	}
+
+	for _, r := range []io.Reader{r, br} {
+		if _, err := Decode(r); err != nil {
+			t.Errorf("%T: %v", r, err)
+		}
+	}
+	// other streams lose exactly the header
+	rest := bytes.NewReader(data)
+	if !Sniff(streamReader{rest}) {
+		t.Fatal("stream not recognized")
+	}
+	if rest.Len() != len(data)-tgaRawHeaderSize {
+		t.Errorf("sniffing read %d bytes of a stream", len(data)-rest.Len())
+	}
+}
+
+func TestSniffUnusedColorMap(t *testing.T) {
+	src := gradient(4, 4)
+	plain := encodeOptions(t, src, &Options{BPP: 24})
+
+	// a truecolor file carrying a color map of two 24-bit entries
+	data := append([]byte(nil), plain[:tgaRawHeaderSize]...)
+	data[1] = 1
+	binary.LittleEndian.PutUint16(data[5:], 2)
+	data[7] = 24
+	data = append(data, 1, 2, 3, 4, 5, 6)
+	data = append(data, plain[tgaRawHeaderSize:]...)
+
+	if !Sniff(bytes.NewReader(data)) {
+		t.Error("not recognized")
+	}
+
+	m, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil || format != "TGA" {
+		t.Fatalf("image.Decode got %q, %v", format, err)
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			want := src.NRGBAAt(x, y)
+			want.A = 0xff
+			if !sameColor(m.At(x, y), want) {
+				t.Fatalf("pixel %d, %d is %v, want %v", x, y, m.At(x, y), want)
+			}
+		}
+	}
+
+	// entry sizes other than 15, 16, 24 and 32 bits are not plausible
+	data[7] = 12
+	if Sniff(bytes.NewReader(data)) {
+		t.Error("invalid color map recognized")
+	}
+}
@@ -0,0 +1,221 @@
+package tga
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+)
+
+// errUnavailable is returned when a stream is asked for data it has
+// already passed
+var errUnavailable = errors.New("TGA: data precedes the stream position")
+
+// source reads a TARGA file. Readers implementing io.ReaderAt whose size is
+// known through io.Seeker or a Size method are read at random, nothing else
+// is read before it is needed. The file starts at the current position of
+// an io.Seeker, which is moved to the end once the file has been decoded.
+// Other readers are streamed from start to end: pixels are read as they are
+// decoded and the rest of the file after them is kept in memory, so that
+// the footer and the data it points to can be read at random as long as it
+// follows the pixels.
+type source struct {
+	// ra reads the file from base to size at random, for streams it is
+	// nil until their tail has been read
+	ra   io.ReaderAt
+	base int64
+	size int64
+
+	stream *bufio.Reader
+	r      *bufio.Reader // sequential reads
+	pos    int64         // file offset of the next sequential read
+
+	// seeker is the caller's reader with random access, it ends at end
+	seeker io.Seeker
+	end    int64
+
+	// pooled buffers, see release
+	own  *bufio.Reader
+	tail *bytes.Buffer
+}
+
+// Decoding many files reuses the buffered readers and stream tails of
+// earlier sources. Tails larger than maxPooledTail are left to the garbage
+// collector instead of being kept alive by the pool.
+var (
+	readerPool = sync.Pool{New: func() interface{} { return bufio.NewReader(nil) }}
+	tailPool   = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+)
+
+const maxPooledTail = 64 << 10
+
+func newSource(r io.Reader) *source {
+	if ra, ok := r.(io.ReaderAt); ok {
+		if start, size, ok := readerSpan(r); ok {
+			if start != 0 {
+				ra = io.NewSectionReader(ra, start, size)
+			}
+
+			s := &source{ra: ra, size: size}
+			s.seeker, _ = r.(io.Seeker)
+			s.end = start + size
+
+			return s
+		}
+	}
+
+	if br, ok := r.(*bufio.Reader); ok {
+		return &source{stream: br, r: br}
+	}
+
+	s := &source{}
+	s.stream = s.buffer(r)
+	s.r = s.stream
+
+	return s
+}
+
+// buffer returns the pooled reader of the source reading from r
+func (s *source) buffer(r io.Reader) *bufio.Reader {
+	if s.own == nil {
+		s.own = readerPool.Get().(*bufio.Reader)
+	}
+	s.own.Reset(r)
+	return s.own
+}
+
+// release returns the pooled buffers of the source, which must not be used
+// afterwards
+func (s *source) release() {
+	if s.own != nil {
+		s.own.Reset(nil)
+		readerPool.Put(s.own)
+	}
+
+	if s.tail != nil && s.tail.Cap() <= maxPooledTail {
+		tailPool.Put(s.tail)
+	}
+
+	*s = source{}
+}
+
+// readerSpan returns the offset and size of the file in a reader with
+// random access: from the current position of an io.Seeker to its end, or
+// all of a reader with a Size method
+func readerSpan(r io.Reader) (start, size int64, ok bool) {
+	switch r := r.(type) {
+	case io.Seeker:
+		cur, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, 0, false
+		}
+		end, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, 0, false
+		}
+		if _, err = r.Seek(cur, io.SeekStart); err != nil {
+			return 0, 0, false
+		}
+		return cur, end - cur, true
+
+	case interface{ Size() int64 }:
+		return 0, r.Size(), true
+	}
+
+	return 0, 0, false
+}
+
+// consume moves the caller's reader with random access to the end of the
+// file, where a stream is left after decoding
+func (s *source) consume() {
+	if s.seeker != nil {
+		s.seeker.Seek(s.end, io.SeekStart)
+	}
+}
+
+// random reports whether the whole file can be read at random
+func (s *source) random() bool {
+	return s.stream == nil
+}
+
+// seek moves sequential reads to a file offset. Streams can only skip
+// forward until their tail has been read.
+func (s *source) seek(off int64) (err error) {
+	if s.ra != nil && off >= s.base {
+		if off > s.size {
+			return io.ErrUnexpectedEOF
+		}
+		s.r = s.buffer(io.NewSectionReader(s.ra, off-s.base, s.size-off))
+		s.pos = off
+		return nil
+	}
+
+	if s.ra != nil || off < s.pos {
+		return errUnavailable
+	}
+
+	_, err = io.CopyN(io.Discard, s, off-s.pos)
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return
+}
+
+func (s *source) Read(p []byte) (n int, err error) {
+	n, err = s.r.Read(p)
+	s.pos += int64(n)
+	return
+}
+
+func (s *source) ReadByte() (b byte, err error) {
+	if b, err = s.r.ReadByte(); err == nil {
+		s.pos++
+	}
+	return
+}
+
+// readAt fills p from a file offset without moving sequential reads
+func (s *source) readAt(p []byte, off int64) error {
+	if s.ra == nil || off < s.base {
+		return errUnavailable
+	}
+
+	n, err := s.ra.ReadAt(p, off-s.base)
+
+	if n == len(p) {
+		return nil
+	} else if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// has reports whether the n bytes at a file offset lie within the file
+func (s *source) has(off, n int64) bool {
+	return off >= 0 && n >= 0 && off+n <= s.size
+}
+
+// readTail reads the rest of a stream into memory
+func (s *source) readTail() error {
+	if s.ra != nil {
+		return nil
+	}
+
+	s.tail = tailPool.Get().(*bytes.Buffer)
+	s.tail.Reset()
+
+	if _, err := s.tail.ReadFrom(s.r); err != nil {
+		return err
+	}
+
+	s.ra = bytes.NewReader(s.tail.Bytes())
+	s.base = s.pos
+	s.size = s.pos + int64(s.tail.Len())
+	s.pos = s.size
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package tga
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// quadrants returns an image with a different color in every quadrant
+func quadrants(w, h int) *image.NRGBA {
+	colors := []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {255, 255, 255, 255}}
+	m := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			m.SetNRGBA(x, y, colors[x*2/w+y*2/h*2])
+		}
+	}
+	return m
+}
+
+func decodeStamp(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	m, err := DecodeMetadata(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.PostageStamp == nil {
+		t.Fatal("no postage stamp")
+	}
+	return m.PostageStamp
+}
+
+func TestPostageStamp(t *testing.T) {
+	src := quadrants(200, 100)
+
+	for _, o := range []*Options{
+		{PostageStampSize: 64},
+		{PostageStampSize: 64, BPP: 24, Origin: OriginBottomLeft, RLE: true},
+		{PostageStampSize: 64, BPP: 16, Origin: OriginBottomRight},
+		{PostageStampSize: 64, ColorMapped: true},
+	} {
+		data := encodeOptions(t, src, o)
+		stamp := decodeStamp(t, data)
+		if b := stamp.Bounds(); b.Dx() != 64 || b.Dy() != 32 {
+			t.Fatalf("%+v: stamp is %v", o, b)
+		}
+		for _, p := range []image.Point{{0, 0}, {63, 0}, {0, 31}, {63, 31}, {20, 10}} {
+			if want := src.At(p.X*200/64, p.Y*100/32); !sameColor(stamp.At(p.X, p.Y), want) {
+				t.Errorf("%+v: stamp pixel %v is %v, want %v", o, p, stamp.At(p.X, p.Y), want)
+			}
+		}
+
+		m, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameColor(m.At(199, 99), src.At(199, 99)) {
+			t.Errorf("%+v: image pixel is %v", o, m.At(199, 99))
+		}
+	}
+}
+
+func TestPostageStampAverages(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		src.SetNRGBA(x, 0, color.NRGBA{200, 100, 0, 255})
+		// transparent pixels do not darken the average
+		src.SetNRGBA(x, 1, color.NRGBA{0, 0, 0, 0})
+	}
+	stamp := decodeStamp(t, encodeOptions(t, src, &Options{PostageStampSize: 2}))
+	if b := stamp.Bounds(); b.Dx() != 2 || b.Dy() != 1 {
+		t.Fatalf("stamp is %v", b)
+	}
+	if got, want := stamp.At(1, 0), (color.NRGBA{200, 100, 0, 128}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// small images are kept at their size
+	if b := decodeStamp(t, encodeOptions(t, src, &Options{PostageStampSize: 64})).Bounds(); b.Dx() != 4 || b.Dy() != 2 {
+		t.Errorf("stamp of a small image is %v", b)
+	}
+}
+
+func TestPostageStampFromMetadata(t *testing.T) {
+	given := quadrants(8, 8)
+	stamp := decodeStamp(t, encodeOptions(t, quadrants(40, 40), &Options{Metadata: &Metadata{PostageStamp: given}}))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if !sameColor(stamp.At(x, y), given.At(x, y)) {
+				t.Fatalf("pixel (%d, %d) is %v, want %v", x, y, stamp.At(x, y), given.At(x, y))
+			}
+		}
+	}
+
+	// colors outside the palette get the closest entry
+	given.SetNRGBA(0, 0, color.NRGBA{250, 10, 10, 255})
+	stamp = decodeStamp(t, encodeOptions(t, quadrants(40, 40), &Options{ColorMapped: true, Metadata: &Metadata{PostageStamp: given}}))
+	if !sameColor(stamp.At(0, 0), color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("got %v for a color outside the palette", stamp.At(0, 0))
+	}
+
+	err := EncodeWithOptions(&bytes.Buffer{}, given, &Options{Metadata: &Metadata{PostageStamp: quadrants(256, 2)}})
+	if err != ErrPostageStamp {
+		t.Errorf("got %v for a large stamp", err)
+	}
+}
+
+func TestSaveToFileRegeneratesStamp(t *testing.T) {
+	img, err := DecodeToTga(bytes.NewReader(encodeOptions(t, quadrants(20, 20), &Options{PostageStampSize: 10})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			img.SetPixel(x, y, NewColor(1, 2, 3, 255))
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "out.tga")
+	if err := img.SaveToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	loaded, err := DecodeToTga(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stamp := loaded.Metadata.PostageStamp
+	if b := stamp.Bounds(); b.Dx() != 10 || b.Dy() != 10 {
+		t.Fatalf("stamp is %v", b)
+	}
+	if !sameColor(stamp.At(9, 9), color.NRGBA{1, 2, 3, 255}) {
+		t.Errorf("stamp was not regenerated: %v", stamp.At(9, 9))
+	}
+}
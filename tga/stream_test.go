@@ -0,0 +1,193 @@
+package tga
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// streamReader hides every method but Read
+type streamReader struct {
+	r io.Reader
+}
+
+func (s streamReader) Read(p []byte) (int, error) {
+	return s.r.Read(p)
+}
+
+// countingReader counts the bytes read from it
+type countingReader struct {
+	*bytes.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.n += n
+	return n, err
+}
+
+func (c *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.Reader.ReadAt(p, off)
+	c.n += n
+	return n, err
+}
+
+func streamTestFiles(t testing.TB) map[string][]byte {
+	files := map[string][]byte{}
+
+	paths, _ := filepath.Glob("testdata/*.tga")
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[path] = data
+	}
+
+	src := gradient(9, 7)
+	premultiplied := image.NewRGBA(src.Bounds())
+	for y := 0; y < 7; y++ {
+		for x := 0; x < 9; x++ {
+			premultiplied.Set(x, y, src.At(x, y))
+		}
+	}
+	for name, data := range map[string][]byte{
+		"32":             encodeOptions(t, src, nil),
+		"premultiplied":  encodeOptions(t, premultiplied, nil),
+		"16 rle":         encodeOptions(t, src, &Options{BPP: 16, RLE: true}),
+		"16 ignored":     encodeOptions(t, src, &Options{BPP: 16, AttributeType: AttributeUndefinedIgnore}),
+		"15 with alpha":  encodeOptions(t, src, &Options{BPP: 15, AttributeType: AttributeAlpha}),
+		"32 ignored rle": encodeOptions(t, src, &Options{RLE: true, AttributeType: AttributeUndefinedIgnore}),
+		"color-mapped":   encodeOptions(t, quadrants(8, 8), &Options{ColorMapped: true, RLE: true, PostageStampSize: 4}),
+		"metadata":       encodeOptions(t, src, &Options{BPP: 24, Metadata: fullMetadata(), PostageStampSize: 3}),
+	} {
+		files[name] = data
+	}
+
+	return files
+}
+
+func TestStreamMatchesRandomAccess(t *testing.T) {
+	for name, data := range streamTestFiles(t) {
+		random, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		stream, err := Decode(streamReader{bytes.NewReader(data)})
+		if err != nil {
+			t.Errorf("%s: stream: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(random, stream) {
+			t.Errorf("%s: stream decodes to a different %T", name, stream)
+		}
+
+		randomConfig, _ := DecodeConfig(bytes.NewReader(data))
+		streamConfig, err := DecodeConfig(streamReader{bytes.NewReader(data)})
+		if err != nil || randomConfig != streamConfig {
+			t.Errorf("%s: stream config is %v (%v), want %v", name, streamConfig, err, randomConfig)
+		}
+
+		randomMetadata, _ := DecodeMetadata(bytes.NewReader(data))
+		streamMetadata, err := DecodeMetadata(streamReader{bytes.NewReader(data)})
+		if err != nil || !reflect.DeepEqual(randomMetadata, streamMetadata) {
+			t.Errorf("%s: stream metadata is %+v (%v), want %+v", name, streamMetadata, err, randomMetadata)
+		}
+	}
+}
+
+func TestStreamAttributeType(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 0})
+
+	data := encodeOptions(t, src, &Options{BPP: 16, AttributeType: AttributeUndefinedIgnore})
+	m, err := Decode(streamReader{bytes.NewReader(data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := m.At(0, 0).RGBA(); a != 0xffff {
+		t.Errorf("ignored alpha decoded as %d", a)
+	}
+
+	// the attribute type makes 24-bit truecolor invalid once it is read
+	data = encodeOptions(t, src, &Options{BPP: 24, AttributeType: AttributeAlpha})
+	if _, err := Decode(streamReader{bytes.NewReader(data)}); !errors.Is(err, ErrFormat) {
+		t.Errorf("got %v for 24 bits with alpha", err)
+	}
+}
+
+func TestRandomAccessReadsLittle(t *testing.T) {
+	data := encodeOptions(t, gradient(256, 256), &Options{Metadata: fullMetadata(), PostageStampSize: 16})
+
+	r := &countingReader{Reader: bytes.NewReader(data)}
+	if _, err := DecodeConfig(r); err != nil {
+		t.Fatal(err)
+	}
+	if r.n > 1024 {
+		t.Errorf("DecodeConfig read %d bytes", r.n)
+	}
+
+	r = &countingReader{Reader: bytes.NewReader(data)}
+	m, err := DecodeMetadata(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.PostageStamp == nil || r.n > len(data)/10 {
+		t.Errorf("DecodeMetadata read %d of %d bytes", r.n, len(data))
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	data := encodeOptions(t, gradient(9, 7), &Options{RLE: true})
+	for _, n := range []int{0, 10, tgaRawHeaderSize, tgaRawHeaderSize + 20} {
+		if _, err := Decode(bytes.NewReader(data[:n])); err == nil {
+			t.Errorf("no error for %d bytes", n)
+		}
+		if _, err := Decode(streamReader{bytes.NewReader(data[:n])}); err == nil {
+			t.Errorf("no error for a stream of %d bytes", n)
+		}
+	}
+}
+
+func TestDecodeAtOffset(t *testing.T) {
+	src := gradient(9, 7)
+	data := append([]byte("12-byte head"), encodeOptions(t, src, &Options{RLE: true, Metadata: fullMetadata()})...)
+
+	f, err := os.CreateTemp(t.TempDir(), "*.tga")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, r := range map[string]io.ReadSeeker{"file": f, "bytes": bytes.NewReader(data)} {
+		if _, err := r.Seek(12, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		m, err := Decode(r)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(m, image.Image(src)) {
+			t.Errorf("%s: decoded image differs", name)
+		}
+		if pos, _ := r.Seek(0, io.SeekCurrent); pos != int64(len(data)) {
+			t.Errorf("%s: reader left at %d of %d", name, pos, len(data))
+		}
+
+		r.Seek(12, io.SeekStart)
+		if md, err := DecodeMetadata(r); err != nil || md.AuthorName != fullMetadata().AuthorName {
+			t.Errorf("%s: metadata %+v, %v", name, md, err)
+		}
+	}
+}
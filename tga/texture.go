@@ -1,12 +1,24 @@
 package tga
 
+import "math"
+
 type UV struct {
 	U float64
 	V float64
 }
 
+// getTextureColor returns the texel nearest to u, v, where 0 and 1 are the
+// centers of the first and the last texel
 func getTextureColor(u float64, v float64, texture *TGA) Color {
-	x := int(u * float64(texture.GetWidth()-1))
-	y := int(v * float64(texture.GetHeight()-1))
+	x := int(u*float64(texture.GetWidth()-1) + 0.5)
+	y := int(v*float64(texture.GetHeight()-1) + 0.5)
 	return texture.GetPixel(x, y)
 }
+
+// Sample returns the texel at the texture coordinate u, v the same way the
+// textured triangle functions do, coordinates outside [0,1] are clamped
+func (tga *TGA) Sample(u float64, v float64) Color {
+	u = math.Max(0, math.Min(1, u))
+	v = math.Max(0, math.Min(1, v))
+	return getTextureColor(u, v, tga)
+}
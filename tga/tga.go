@@ -32,9 +32,10 @@ type rawFooter struct {
 }
 
 const (
-	flagOriginRight   = 1 << 4
-	flagOriginTop     = 1 << 5
-	flagAlphaSizeMask = 0x0f
+	flagOriginRight    = 1 << 4
+	flagOriginTop      = 1 << 5
+	flagAlphaSizeMask  = 0x0f
+	flagInterleaveMask = 0xc0
 )
 
 const (
@@ -67,16 +68,9 @@ func newFooter() *rawFooter {
 	return f
 }
 
-func newExtArea(attrType byte) []byte {
-	area := make([]byte, extAreaAttrTypeOffset+1)
-	area[0], area[1] = 0xef, 0x01 // size
-	area[extAreaAttrTypeOffset] = attrType
-	return area
-}
-
 func CreateTga(width int, height int) *TGA {
 	t := &TGA{
-		r: &bytes.Reader{},
+		r: nil,
 		raw: rawHeader{
 			IdLength:      0,
 			PaletteType:   0,
@@ -98,7 +92,7 @@ func CreateTga(width int, height int) *TGA {
 		pixelSize:     3,
 		palette:       nil,
 		paletteLength: 0,
-		ColorModel:    color.NRGBAModel,
+		colorModel:    color.NRGBAModel,
 		tmp:           [4]byte{},
 		pixels:        make([]byte, 4*width*height),
 		decode:        nil,
@@ -108,60 +102,196 @@ func CreateTga(width int, height int) *TGA {
 
 }
 
+// SaveToFile writes the image to a file in the format of its header, see
+// Options.
 func (tga *TGA) SaveToFile(filePath string) error {
+	return tga.SaveToFileWithOptions(filePath, tga.Options())
+}
+
+// Options returns encoder options matching the header the image was created
+// with or decoded from, including its metadata and a postage stamp of the
+// same size if it has one. Monochrome images with alpha are saved as 32-bit
+// truecolor. Saving a color-mapped image fails with ErrPaletteSize once more
+// than 256 colors have been drawn into it.
+func (tga *TGA) Options() *Options {
+	o := &Options{
+		BPP: int(tga.raw.BPP),
+		RLE: tga.rle,
+	}
+
+	switch tga.raw.ImageType {
+	case imageTypePaletted:
+		o.ColorMapped = true
+
+	case imageTypeMonoChrome:
+		if o.BPP != 8 {
+			o.BPP = 32
+		}
+
+	case imageTypeTrueColor:
+		if o.BPP == 16 && tga.raw.Flags&flagAlphaSizeMask == 0 {
+			o.BPP = 15
+		}
+	}
+
+	switch tga.raw.Flags & (flagOriginTop | flagOriginRight) {
+	case flagOriginTop:
+		o.Origin = OriginTopLeft
+	case flagOriginTop | flagOriginRight:
+		o.Origin = OriginTopRight
+	case flagOriginRight:
+		o.Origin = OriginBottomRight
+	default:
+		o.Origin = OriginBottomLeft
+	}
+
+	if tga.colorModel == color.RGBAModel {
+		o.AttributeType = AttributePremultipliedAlpha
+	}
+
+	o.Metadata = tga.Metadata
+
+	if o.Metadata != nil && o.Metadata.PostageStamp != nil {
+		// regenerate the stamp from the current pixels
+		b := o.Metadata.PostageStamp.Bounds()
+		o.PostageStampSize = Max(b.Dx(), b.Dy())
+	}
+
+	return o
+}
+
+// SaveToFileWithOptions writes the image to a file, see EncodeWithOptions.
+func (tga *TGA) SaveToFileWithOptions(filePath string, o *Options) error {
 	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
 	if err != nil {
 		return err
 	}
-	rect := image.Rect(0, 0, tga.width, tga.height)
-	var img image.Image
-	if tga.ColorModel == color.NRGBAModel {
-		im := image.NewNRGBA(rect)
-		im.Pix = tga.pixels
-		img = im
-	} else {
-		im := image.NewRGBA(rect)
-		im.Pix = tga.pixels
-		img = im
-	}
+	defer f.Close()
 
-	return Encode(f, img)
+	return EncodeWithOptions(f, tga.Image(), o)
 }
 
-// applyExtensions reads extensions section (if it exists) and parses attribute type.
-func (tga *TGA) applyExtensions() (err error) {
-	var rawFooter rawFooter
-
-	if _, err = tga.r.Seek(int64(-tgaRawFooterSize), 2); err != nil {
+// readExtensions reads the footer and applies the attribute type of the
+// extension area, if there is one. With withMetadata the image ID, the
+// extension area with its tables and postage stamp and the developer area
+// end up in tga.Metadata. Parts a stream has already passed are skipped.
+func (tga *TGA) readExtensions(withMetadata bool) (err error) {
+	var raw rawFooter
+	footer := make([]byte, tgaRawFooterSize)
+
+	if tga.r.size < tgaRawHeaderSize+tgaRawFooterSize {
+		// too small for a footer
+	} else if err = tga.r.readAt(footer, tga.r.size-tgaRawFooterSize); err != nil {
+		return skipUnavailable(err)
+	} else if err = binary.Read(bytes.NewReader(footer), binary.LittleEndian, &raw); err != nil {
 		return
-	} else if err = binary.Read(tga.r, binary.LittleEndian, &rawFooter); err != nil {
+	}
+
+	if !bytes.Equal(raw.Signature[:], tgaSignature[:]) {
+		// TGA 1.0 file
 		return
-	} else if bytes.Equal(rawFooter.Signature[:], tgaSignature[:]) && rawFooter.ExtAreaOffset != 0 {
-		offset := int64(rawFooter.ExtAreaOffset + extAreaAttrTypeOffset)
+	}
 
-		var n int64
-		var t byte
+	m := &Metadata{ImageID: tga.imageID}
+	found := len(tga.imageID) != 0
 
-		if n, err = tga.r.Seek(offset, 0); err != nil || n != offset {
-			return
-		} else if t, err = tga.r.ReadByte(); err != nil {
+	if raw.ExtAreaOffset != 0 {
+		area := make([]byte, extAreaSize)
+
+		if err = tga.r.readAt(area, int64(raw.ExtAreaOffset)); err == nil {
+			if tga.opts.Mode == Strict && binary.LittleEndian.Uint16(area) != extAreaSize {
+				return &FormatError{Reason: "invalid extension area size"}
+			}
+
+			tga.applyAttributeType(area[extAreaAttrTypeOffset])
+
+			if withMetadata {
+				err = tga.readExtArea(area, m)
+				found = true
+			}
+		}
+
+		if err = skipUnavailable(err); err != nil {
 			return
-		} else if t == attrTypeAlpha {
-			// alpha
-			tga.hasAlpha = true
-		} else if t == attrTypePremultipliedAlpha {
-			// premultiplied alpha
-			tga.hasAlpha = true
-			tga.ColorModel = color.RGBAModel
-		} else {
-			// attribute is not an alpha channel value, ignore it
-			tga.hasAlpha = false
 		}
 	}
 
+	if withMetadata && raw.DevDirOffset != 0 {
+		if m.Developer, err = readDeveloperArea(tga.r, int64(raw.DevDirOffset)); err != nil {
+			if err = skipUnavailable(err); err != nil {
+				return
+			}
+		}
+
+		found = true
+	}
+
+	if found {
+		tga.Metadata = m
+	}
+
 	return
 }
 
+// applyAttributeType sets alpha and color model from the attribute type.
+func (tga *TGA) applyAttributeType(t byte) {
+	if t == attrTypeAlpha {
+		// alpha
+		tga.hasAlpha = true
+	} else if t == attrTypePremultipliedAlpha {
+		// premultiplied alpha
+		tga.hasAlpha = true
+		tga.colorModel = color.RGBAModel
+	} else {
+		// attribute is not an alpha channel value, ignore it
+		tga.hasAlpha = false
+	}
+}
+
+// readExtArea parses the extension area and reads the tables and postage
+// stamp it points to into m.
+func (tga *TGA) readExtArea(area []byte, m *Metadata) (err error) {
+	offsets, _ := parseExtArea(area, m)
+	tga.stampOffset = int64(offsets.postageStamp)
+
+	if offsets.colorCorrection != 0 {
+		raw := make([]byte, colorCorrectionSize)
+
+		if err = tga.r.readAt(raw, int64(offsets.colorCorrection)); err == nil {
+			m.ColorCorrection = parseColorCorrection(raw)
+		} else if err = skipUnavailable(err); err != nil {
+			return
+		}
+	}
+
+	if offsets.scanLine != 0 {
+		raw := make([]byte, 4*tga.height)
+
+		if err = tga.r.readAt(raw, int64(offsets.scanLine)); err == nil {
+			m.ScanLines = make([]uint32, tga.height)
+			for i := range m.ScanLines {
+				m.ScanLines[i] = binary.LittleEndian.Uint32(raw[i*4:])
+			}
+		} else if err = skipUnavailable(err); err != nil {
+			return
+		}
+	}
+
+	if tga.stampOffset != 0 {
+		m.PostageStamp, err = tga.decodePostageStamp()
+	}
+
+	return skipUnavailable(err)
+}
+
+// skipUnavailable ignores errors about data a stream has already passed
+func skipUnavailable(err error) error {
+	if err == errUnavailable {
+		return nil
+	}
+	return err
+}
+
 // flip flips pixels of image based on its origin.
 func (tga *TGA) flip(out []byte) {
 	flipH := tga.raw.Flags&flagOriginRight != 0
@@ -191,13 +321,26 @@ func (tga *TGA) flip(out []byte) {
 	}
 }
 
-// getHeader reads and validates TGA header.
+// getHeader reads and validates TGA header. Random access sources get the
+// attribute type from the extension area right away, streams only after
+// their pixels, see finishStream.
 func (tga *TGA) getHeader() (err error) {
-	if err = binary.Read(tga.r, binary.LittleEndian, &tga.raw); err != nil {
+	header := make([]byte, tgaRawHeaderSize)
+
+	if tga.r.random() {
+		err = tga.r.readAt(header, 0)
+	} else {
+		_, err = io.ReadFull(tga.r, header)
+	}
+
+	if err != nil {
+		return
+	} else if err = binary.Read(bytes.NewReader(header), binary.LittleEndian, &tga.raw); err != nil {
 		return
 	}
 
 	if tga.raw.ImageType&imageTypeFlagRLE != 0 {
+		tga.rle = true
 		tga.decode = decodeRLE
 	} else {
 		tga.decode = decodeRaw
@@ -207,25 +350,47 @@ func (tga *TGA) getHeader() (err error) {
 	alphaSize := tga.raw.Flags & flagAlphaSizeMask
 
 	if alphaSize != 0 && alphaSize != 1 && alphaSize != 8 {
-		err = ErrAlphaSize
-		return
+		if tga.opts.Mode != Lenient {
+			return &FormatError{"invalid alpha size", ErrAlphaSize}
+		}
+
+		tga.raw.Flags &^= flagAlphaSizeMask
 	}
 
-	tga.hasAlpha = ((alphaSize != 0 || tga.raw.BPP == 32) ||
-		(tga.raw.ImageType == imageTypeMonoChrome && tga.raw.BPP == 16) ||
-		(tga.raw.ImageType == imageTypePaletted && tga.raw.PaletteBPP == 32))
+	if tga.opts.Mode == Strict && tga.raw.Flags&flagInterleaveMask != 0 {
+		return &FormatError{Reason: "interleaved pixels"}
+	}
 
+	tga.hasAlpha = tga.headerHasAlpha()
 	tga.width = int(tga.raw.Width)
 	tga.height = int(tga.raw.Height)
 	tga.pixelSize = int(tga.raw.BPP) >> 3
 
 	// default is NOT premultiplied alpha model
-	tga.ColorModel = color.NRGBAModel
+	tga.colorModel = color.NRGBAModel
 
-	if err = tga.applyExtensions(); err != nil {
-		return
+	if tga.r.random() {
+		if err = tga.readExtensions(false); err != nil && !tga.lenient(err) {
+			return
+		}
+	} else if tga.raw.BPP == 16 {
+		// the attribute type may still turn the top bit of 16-bit
+		// truecolor into alpha
+		tga.hasAlpha = true
 	}
 
+	return tga.validate()
+}
+
+// headerHasAlpha reports whether the header alone describes an alpha channel
+func (tga *TGA) headerHasAlpha() bool {
+	return ((tga.raw.Flags&flagAlphaSizeMask != 0 || tga.raw.BPP == 32) ||
+		(tga.raw.ImageType == imageTypeMonoChrome && tga.raw.BPP == 16) ||
+		(tga.raw.ImageType == imageTypePaletted && tga.raw.PaletteBPP == 32))
+}
+
+// validate checks the pixel format of the header
+func (tga *TGA) validate() (err error) {
 	var formatIsInvalid bool
 
 	switch tga.raw.ImageType {
@@ -246,11 +411,42 @@ func (tga *TGA) getHeader() (err error) {
 			(!tga.hasAlpha && tga.raw.BPP != 8))
 
 	default:
-		err = fmt.Errorf("TGA: unknown image type %d", tga.raw.ImageType)
+		err = &FormatError{Reason: fmt.Sprintf("unknown image type %d", tga.raw.ImageType)}
 	}
 
 	if err == nil && formatIsInvalid {
-		err = ErrFormat
+		err = &FormatError{Reason: "unsupported pixel format"}
+	}
+
+	return
+}
+
+// decodePostageStamp decodes the thumbnail in the extension area, it has
+// the pixel format and origin of the image but is never compressed.
+func (tga *TGA) decodePostageStamp() (m image.Image, err error) {
+	var size [2]byte
+
+	if err = tga.r.seek(tga.stampOffset); err != nil {
+		return
+	} else if _, err = io.ReadFull(tga.r, size[:]); err != nil {
+		return
+	}
+
+	stamp := *tga
+	stamp.width, stamp.height = int(size[0]), int(size[1])
+	rect := image.Rect(0, 0, stamp.width, stamp.height)
+	var pixels []byte
+
+	if tga.colorModel == color.NRGBAModel {
+		im := image.NewNRGBA(rect)
+		m, pixels = im, im.Pix
+	} else {
+		im := image.NewRGBA(rect)
+		m, pixels = im, im.Pix
+	}
+
+	if err = decodeRaw(&stamp, pixels); err == nil {
+		stamp.flip(pixels)
 	}
 
 	return
@@ -258,7 +454,7 @@ func (tga *TGA) getHeader() (err error) {
 
 func (tga *TGA) getPixel(dst []byte) (err error) {
 	var R, G, B, A uint8 = 0xff, 0xff, 0xff, 0xff
-	src := tga.tmp
+	src := tga.tmp[:]
 
 	if _, err = io.ReadFull(tga.r, src[0:tga.pixelSize]); err != nil {
 		return
@@ -295,7 +491,12 @@ func (tga *TGA) getPixel(dst []byte) (err error) {
 			index := int(src[0])
 
 			if int(index) >= tga.paletteLength {
-				return ErrPaletteIndex
+				if tga.opts.Mode == Lenient {
+					dst[0], dst[1], dst[2], dst[3] = 0, 0, 0, 0
+					return nil
+				}
+
+				return &FormatError{"palette index out of range", ErrPaletteIndex}
 			}
 
 			var m int
@@ -310,7 +511,7 @@ func (tga *TGA) getPixel(dst []byte) (err error) {
 				if tga.hasAlpha {
 					A = tga.palette[m+3]
 				}
-			} else if tga.raw.PaletteBPP == 16 {
+			} else if tga.raw.PaletteBPP == 16 || tga.raw.PaletteBPP == 15 {
 				m = index * 2
 				word := uint16(tga.palette[m+0]) | (uint16(tga.palette[m+1]) << 8)
 				B, G, R = wordToBGR(word)
@@ -1,6 +1,9 @@
 package tga
 
-import "tinyrender-golang/util"
+import (
+	"math"
+	"tinyrender-golang/util"
+)
 
 type Color struct {
 	R byte
@@ -221,3 +224,68 @@ func (tga *TGA) DrawTriangleWithTexture(tri *util.Triangle, zBuffer []float64, t
 		}
 	}
 }
+
+// DrawSplat fills the ellipse center + s*a + t*b with s*s + t*t <= 1, a and
+// b are screen space axes whose Z is the depth change along them. Pixels
+// are depth tested unless zBuffer is nil. Splats seen edge-on cover just
+// their center pixel.
+func (tga *TGA) DrawSplat(center util.Vector3, a util.Vector3, b util.Vector3, c Color, zBuffer []float64) {
+	plot := func(x, y int, z float64) {
+		if x < 0 || y < 0 || x >= tga.width || y >= tga.height {
+			return
+		}
+		if zBuffer != nil {
+			if zBuffer[x+y*tga.width] >= z {
+				return
+			}
+			zBuffer[x+y*tga.width] = z
+		}
+		tga.SetPixel(x, y, c)
+	}
+
+	det := a.X*b.Y - a.Y*b.X
+	if det*det < 0.25 {
+		plot(int(center.X), int(center.Y), center.Z)
+		return
+	}
+
+	rx := math.Sqrt(a.X*a.X + b.X*b.X)
+	ry := math.Sqrt(a.Y*a.Y + b.Y*b.Y)
+	minX := Max(0, int(math.Floor(center.X-rx)))
+	maxX := Min(tga.width-1, int(math.Ceil(center.X+rx)))
+	minY := Max(0, int(math.Floor(center.Y-ry)))
+	maxY := Min(tga.height-1, int(math.Ceil(center.Y+ry)))
+
+	for j := minY; j <= maxY; j++ {
+		for i := minX; i <= maxX; i++ {
+			// solve the pixel center for s and t
+			dx := float64(i) + 0.5 - center.X
+			dy := float64(j) + 0.5 - center.Y
+			s := (dx*b.Y - dy*b.X) / det
+			t := (a.X*dy - a.Y*dx) / det
+			if s*s+t*t > 1 {
+				continue
+			}
+			plot(i, j, center.Z+s*a.Z+t*b.Z)
+		}
+	}
+}
+
+// DrawLineWithZBuffer draws a depth tested line of the given width in
+// pixels, the depth is interpolated between the end points
+func (tga *TGA) DrawLineWithZBuffer(p1 util.Vector3, p2 util.Vector3, width float64, c Color, zBuffer []float64) {
+	d := p2.Sub(p1)
+	steps := int(math.Ceil(math.Max(math.Abs(d.X), math.Abs(d.Y))))
+	r := width / 2
+	for i := 0; i <= steps; i++ {
+		p := p1
+		if steps > 0 {
+			p = p1.Add(d.Scale(float64(i) / float64(steps)))
+		}
+		if width <= 1 {
+			tga.DrawSplat(p, util.Vector3{}, util.Vector3{}, c, zBuffer)
+		} else {
+			tga.DrawSplat(p, util.NewVec3(r, 0, 0), util.NewVec3(0, r, 0), c, zBuffer)
+		}
+	}
+}
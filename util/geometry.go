@@ -49,6 +49,26 @@ func (v1 Vector3) Sub(v2 Vector3) Vector3 {
 	}
 }
 
+func (v1 Vector3) Add(v2 Vector3) Vector3 {
+	return Vector3{
+		X: v1.X + v2.X,
+		Y: v1.Y + v2.Y,
+		Z: v1.Z + v2.Z,
+	}
+}
+
+func (v1 Vector3) Scale(s float64) Vector3 {
+	return Vector3{
+		X: v1.X * s,
+		Y: v1.Y * s,
+		Z: v1.Z * s,
+	}
+}
+
+func (v1 Vector3) Length() float64 {
+	return math.Sqrt(v1.DotProduct(v1))
+}
+
 func (v1 Vector3) DotProduct(v2 Vector3) float64 {
 	return v1.X*v2.X + v1.Y*v2.Y + v1.Z*v2.Z
 }
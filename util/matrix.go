@@ -1,6 +1,9 @@
 package util
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+)
 
 type Matrix struct {
 	Col  int
@@ -115,3 +118,76 @@ func (m *Matrix) Sub(to *Matrix) *Matrix {
 	}
 	return r
 }
+
+// Inverse returns the inverse of a square matrix by Gauss-Jordan
+// elimination, ok is false when the matrix is singular
+func (m *Matrix) Inverse() (inv *Matrix, ok bool) {
+	if m.Row != m.Col {
+		panic("matrix is not square")
+	}
+	n := m.Row
+	a := NewEmpty(n, n)
+	for i := range a.Data {
+		copy(a.Data[i], m.Data[i])
+	}
+	inv = NewIdentity(n)
+
+	for c := 0; c < n; c++ {
+		pivot := c
+		for r := c + 1; r < n; r++ {
+			if math.Abs(a.Data[r][c]) > math.Abs(a.Data[pivot][c]) {
+				pivot = r
+			}
+		}
+		if math.Abs(a.Data[pivot][c]) < 1e-12 {
+			return nil, false
+		}
+		a.Data[c], a.Data[pivot] = a.Data[pivot], a.Data[c]
+		inv.Data[c], inv.Data[pivot] = inv.Data[pivot], inv.Data[c]
+
+		scale := 1 / a.Data[c][c]
+		for j := 0; j < n; j++ {
+			a.Data[c][j] *= scale
+			inv.Data[c][j] *= scale
+		}
+		for r := 0; r < n; r++ {
+			if r == c || a.Data[r][c] == 0 {
+				continue
+			}
+			f := a.Data[r][c]
+			for j := 0; j < n; j++ {
+				a.Data[r][j] -= f * a.Data[c][j]
+				inv.Data[r][j] -= f * inv.Data[c][j]
+			}
+		}
+	}
+	return inv, true
+}
+
+// NewTranslation returns the 4x4 matrix moving points by v
+func NewTranslation(v Vector3) *Matrix {
+	m := NewIdentity(4)
+	m.Data[0][3] = v.X
+	m.Data[1][3] = v.Y
+	m.Data[2][3] = v.Z
+	return m
+}
+
+// NewRotation returns the 4x4 matrix turning points counter-clockwise by
+// angle radians around axis
+func NewRotation(axis Vector3, angle float64) *Matrix {
+	a := axis.Normalize()
+	c, s := math.Cos(angle), math.Sin(angle)
+	t := 1 - c
+	m := NewIdentity(4)
+	m.Data[0][0] = t*a.X*a.X + c
+	m.Data[0][1] = t*a.X*a.Y - s*a.Z
+	m.Data[0][2] = t*a.X*a.Z + s*a.Y
+	m.Data[1][0] = t*a.X*a.Y + s*a.Z
+	m.Data[1][1] = t*a.Y*a.Y + c
+	m.Data[1][2] = t*a.Y*a.Z - s*a.X
+	m.Data[2][0] = t*a.X*a.Z - s*a.Y
+	m.Data[2][1] = t*a.Y*a.Z + s*a.X
+	m.Data[2][2] = t*a.Z*a.Z + c
+	return m
+}
@@ -1,6 +1,9 @@
 package util
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func Test001(t *testing.T) {
 	f := [][]float64{
@@ -21,3 +24,34 @@ func Test001(t *testing.T) {
 	m.Add(m).Print()
 	m.Sub(m).Print()
 }
+
+func TestInverse(t *testing.T) {
+	m := NewRotation(NewVec3(1, 2, 3), 0.7).Mul(NewTranslation(NewVec3(4, -5, 6)))
+	inv, ok := m.Inverse()
+	if !ok {
+		t.Fatal("matrix is reported singular")
+	}
+	id := m.Mul(inv)
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			want := 0.0
+			if i == j {
+				want = 1
+			}
+			if math.Abs(id.Data[i][j]-want) > 1e-12 {
+				t.Fatalf("m * m^-1 is not the identity at %d %d: %f", i, j, id.Data[i][j])
+			}
+		}
+	}
+
+	if _, ok := NewEmpty(4, 4).Inverse(); ok {
+		t.Errorf("zero matrix has an inverse")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	p := NewRotation(NewVec3(0, 0, 1), math.Pi/2).Mul(NewFromVector3(NewVec3(1, 0, 0))).ToVector3()
+	if math.Abs(p.X) > 1e-12 || math.Abs(p.Y-1) > 1e-12 {
+		t.Errorf("got %v, expected (0, 1, 0)", p)
+	}
+}